@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/allwsaa/project-api/database"
+	"github.com/allwsaa/project-api/internal/auth"
+	"github.com/allwsaa/project-api/internal/config"
+	"github.com/allwsaa/project-api/internal/handlers"
+	"github.com/allwsaa/project-api/internal/health"
+	"github.com/allwsaa/project-api/internal/idempotency"
+	"github.com/allwsaa/project-api/internal/metrics"
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/ratelimit"
+	"github.com/allwsaa/project-api/internal/workers"
+)
+
+// The tests in this package run the whole API, middleware included, in an
+// httptest.Server against a fresh SQLite database per test, and talk to it
+// over HTTP like a client would. The handlers share handlers.DB, so these
+// tests must not run in parallel.
+
+// testAPI is a running API and the database behind it.
+type testAPI struct {
+	t   *testing.T
+	URL string
+	DB  *sql.DB
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Path = filepath.Join(t.TempDir(), "api.db")
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	handlers.DB = db
+	handlers.RequireIfMatch = false
+	handlers.SearchLanguage = cfg.SearchLanguage
+
+	// Requests are not rate limited: the limiter has no store.
+	limiter := &ratelimit.Limiter{}
+	idempotent := &idempotency.Store{DB: db, Window: cfg.IdempotencyWindow}
+	r := newRouter(cfg, metrics.New(db, cfg.Database.Driver), limiter, idempotent)
+
+	latest, err := database.LatestMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := &health.Checker{
+		DB:      db,
+		Timeout: cfg.HealthTimeout,
+		SchemaVersion: func(ctx context.Context) (int, error) {
+			return database.SchemaVersion(ctx, db)
+		},
+		ExpectedSchema: latest,
+		Workers:        workers.NewGroup(context.Background()),
+	}
+	checker.Start()
+
+	srv := httptest.NewServer(newRoot(r, checker, ""))
+	t.Cleanup(srv.Close)
+	return &testAPI{t: t, URL: srv.URL, DB: db}
+}
+
+// response is an API response with its body read.
+type response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// decode unmarshals the body into v, failing the test if it is not JSON.
+func (res *response) decode(t *testing.T, v any) {
+	t.Helper()
+	if err := json.Unmarshal(res.Body, v); err != nil {
+		t.Fatalf("decoding %s: %v", res.Body, err)
+	}
+}
+
+// problem decodes the body as problem details, failing the test unless it is
+// one describing status.
+func (res *response) problem(t *testing.T, status int) problem.Details {
+	t.Helper()
+	if ct := res.Header.Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("Content-Type %q, want %q: %s", ct, problem.ContentType, res.Body)
+	}
+	var details problem.Details
+	res.decode(t, &details)
+	if details.Status != status || details.Title != http.StatusText(status) || details.Detail == "" {
+		t.Fatalf("problem %+v, want status %d with a detail", details, status)
+	}
+	return details
+}
+
+// do sends a request as the given user, or anonymously if userID is 0.
+// body is sent as JSON unless it is a string, which is sent as is.
+func (api *testAPI) do(method, path string, userID int, body any, header ...string) *response {
+	api.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			api.t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, api.URL+path, reader)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if userID != 0 {
+		req.Header.Set(auth.UserHeader, strconv.Itoa(userID))
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	return &response{StatusCode: res.StatusCode, Header: res.Header, Body: b}
+}
+
+// mustDo is like do but fails the test unless the response has status want.
+func (api *testAPI) mustDo(want int, method, path string, userID int, body any, header ...string) *response {
+	api.t.Helper()
+	res := api.do(method, path, userID, body, header...)
+	if res.StatusCode != want {
+		api.t.Fatalf("%s %s: status %d, want %d: %s", method, path, res.StatusCode, want, res.Body)
+	}
+	return res
+}
+
+// created returns the "id" of a 201 response to a POST.
+func (api *testAPI) created(path string, userID int, body any) int {
+	api.t.Helper()
+	var ids map[string]int
+	api.mustDo(http.StatusCreated, http.MethodPost, path, userID, body).decode(api.t, &ids)
+	return ids["id"]
+}
+
+// The factories below create the resources through the API, so that the
+// data the tests see is the data a client would have created.
+
+// createOrg creates an organization and returns the ID of its admin.
+func (api *testAPI) createOrg(name string) (orgID, adminID int) {
+	api.t.Helper()
+	var ids map[string]int
+	api.mustDo(http.StatusCreated, http.MethodPost, "/organizations", 0, map[string]any{
+		"name":  name,
+		"admin": map[string]any{"name": name + " Admin", "email": "admin@" + name + ".example.com", "role": "manager"},
+	}).decode(api.t, &ids)
+	return ids["id"], ids["adminId"]
+}
+
+// createUser creates a member of the admin's organization.
+func (api *testAPI) createUser(adminID int, name string) int {
+	api.t.Helper()
+	var user struct{ ID int }
+	api.mustDo(http.StatusCreated, http.MethodPost, "/users", adminID, map[string]any{
+		"name": name, "email": name + "@example.com", "role": "developer",
+	}).decode(api.t, &user)
+	return user.ID
+}
+
+// createProject creates a project managed, and owned, by managerID.
+func (api *testAPI) createProject(callerID, managerID int, title string) int {
+	api.t.Helper()
+	return api.created("/projects", callerID, map[string]any{
+		"projectTitle": title, "projectDescription": "About " + title, "managerId": managerID,
+		"completed": time.Now().Add(30 * 24 * time.Hour).Format(time.RFC3339),
+	})
+}
+
+// addMember makes userID a member of the project with the given role.
+func (api *testAPI) addMember(callerID, projectID, userID int, role string) {
+	api.t.Helper()
+	api.mustDo(http.StatusOK, http.MethodPut, fmt.Sprintf("/projects/%d/members/%d", projectID, userID), callerID,
+		map[string]any{"role": role})
+}
+
+// createTask creates a task in the project assigned to respID.
+func (api *testAPI) createTask(callerID, projectID, respID int, title string) int {
+	api.t.Helper()
+	return api.created("/tasks", callerID, map[string]any{
+		"title": title, "description": "Details of " + title, "priority": "high", "status": "new",
+		"respId": respID, "projectId": projectID,
+		"completionDate": time.Now().Add(48 * time.Hour).Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,262 @@
+// Package client calls the project API from Go.
+//
+// A Client has a method for each endpoint, taking and returning the API's
+// own types:
+//
+//	c := client.New("https://project-api.example.com", adminID)
+//	id, err := c.CreateTask(ctx, client.Task{Title: "Write spec", RespId: 2, ProjectID: 1})
+//	task, err := c.GetTask(ctx, id)
+//	task.Status = "done"
+//	task, err = c.UpdateTask(ctx, task)
+//
+// Error responses are returned as *Error, which matches ErrBadRequest,
+// ErrNotFound, ErrConflict, ErrPreconditionFailed and ErrUnprocessable with
+// errors.Is. Requests failing with a 5xx status or a network error are
+// retried with exponential backoff; POST requests carry an Idempotency-Key,
+// so that retrying them is safe.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/problem"
+)
+
+// Client calls the API at BaseURL as the user UserID. Create it with New and
+// change its fields before using it.
+type Client struct {
+	// BaseURL is the API's address, such as https://project-api.example.com.
+	BaseURL string
+	// UserID is sent as X-User-ID. Only CreateOrganization works without it.
+	UserID int
+	// Token, when set, is sent as a bearer token.
+	Token string
+	// HTTPClient sends the requests; http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// MaxRetries is how many times a request failing with a 5xx status or a
+	// network error is retried.
+	MaxRetries int
+	// Backoff is the wait before the first retry. It doubles with each retry
+	// and is randomized by up to half of it.
+	Backoff time.Duration
+	// PageSize is the number of items the iterators fetch per request.
+	PageSize int
+}
+
+// New returns a client calling the API at baseURL as userID, retrying failed
+// requests 3 times.
+func New(baseURL string, userID int) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		UserID:     userID,
+		MaxRetries: 3,
+		Backoff:    200 * time.Millisecond,
+		PageSize:   100,
+	}
+}
+
+// As returns a copy of c acting as userID.
+func (c *Client) As(userID int) *Client {
+	as := *c
+	as.UserID = userID
+	return &as
+}
+
+// request is a call to the API.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	// body, when not nil, is sent as JSON, or with contentType if set.
+	body        any
+	contentType string
+	// version, when not zero, is sent as If-Match, so that the request fails
+	// with ErrPreconditionFailed if the resource has changed since.
+	version int
+}
+
+// do sends req, retrying it as configured, and decodes the JSON response into
+// out unless out is nil.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return err
+		}
+	}
+	var key string
+	if req.method == http.MethodPost {
+		key = newIdempotencyKey()
+	}
+
+	for retry := 0; ; retry++ {
+		res, err := c.send(ctx, req, body, key)
+		if err == nil && res.StatusCode < 500 {
+			defer res.Body.Close()
+			return decodeResponse(req, res, out)
+		}
+		if err == nil {
+			if retry == c.MaxRetries {
+				defer res.Body.Close()
+				return decodeResponse(req, res, out)
+			}
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		} else if retry == c.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		wait := c.Backoff << retry
+		if wait > 0 {
+			wait += time.Duration(mathrand.Int63n(int64(wait)/2 + 1))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, body []byte, idempotencyKey string) (*http.Response, error) {
+	u := strings.TrimSuffix(c.BaseURL, "/") + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	r, err := http.NewRequestWithContext(ctx, req.method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Accept", "application/json")
+	if body != nil {
+		contentType := req.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		r.Header.Set("Content-Type", contentType)
+	}
+	if c.UserID != 0 {
+		r.Header.Set("X-User-ID", strconv.Itoa(c.UserID))
+	}
+	if c.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if req.version != 0 {
+		r.Header.Set("If-Match", `"`+strconv.Itoa(req.version)+`"`)
+	}
+	if idempotencyKey != "" {
+		r.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(r)
+}
+
+func decodeResponse(req request, res *http.Response, out any) error {
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		apiErr := &Error{
+			Method:     req.method,
+			Path:       req.path,
+			StatusCode: res.StatusCode,
+			Message:    strings.TrimSpace(string(data)),
+		}
+		// The API explains its errors with problem details; a proxy in
+		// front of it may not.
+		var details problem.Details
+		if strings.HasPrefix(res.Header.Get("Content-Type"), problem.ContentType) && json.Unmarshal(data, &details) == nil {
+			apiErr.Message = details.Detail
+			apiErr.RequestID = details.RequestID
+			apiErr.TraceID = details.TraceID
+		}
+		return apiErr
+	}
+	if out == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding the response to %s %s: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// path joins the API path segments, escaping the values.
+func path(segments ...any) string {
+	var b strings.Builder
+	for _, segment := range segments {
+		b.WriteByte('/')
+		switch s := segment.(type) {
+		case int:
+			b.WriteString(strconv.Itoa(s))
+		case time.Time:
+			b.WriteString(url.PathEscape(s.Format(time.RFC3339)))
+		default:
+			b.WriteString(url.PathEscape(s.(string)))
+		}
+	}
+	return b.String()
+}
+
+// pageQuery returns the query parameters selecting page.
+func pageQuery(query url.Values, page Page) url.Values {
+	if query == nil {
+		query = url.Values{}
+	}
+	if page.Limit > 0 {
+		query.Set("limit", strconv.Itoa(page.Limit))
+	}
+	if page.After > 0 {
+		query.Set("after", strconv.Itoa(page.After))
+	}
+	return query
+}
+
+// create posts v to path and returns the ID of the resource it created.
+func (c *Client) create(ctx context.Context, path string, v any) (int, error) {
+	var created struct {
+		ID int `json:"id"`
+	}
+	err := c.do(ctx, request{method: http.MethodPost, path: path, body: v}, &created)
+	return created.ID, err
+}
+
+// patchRequest returns the request sending patch to path, conditioned on
+// version unless it is zero.
+func patchRequest(path string, version int, patch any) request {
+	contentType := "application/merge-patch+json"
+	if _, ok := patch.(JSONPatch); ok {
+		contentType = "application/json-patch+json"
+	}
+	return request{method: "PATCH", path: path, body: patch, contentType: contentType, version: version}
+}
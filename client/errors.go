@@ -0,0 +1,59 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// The errors an *Error matches with errors.Is, by status code.
+var (
+	// ErrBadRequest is a 400: the request is malformed or invalid.
+	ErrBadRequest = errors.New("bad request")
+	// ErrNotFound is a 404: the resource does not exist, or is not visible
+	// to the user.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is a 409: the request conflicts with the state of the
+	// resource, such as removing the last owner of a project.
+	ErrConflict = errors.New("conflict")
+	// ErrPreconditionFailed is a 412: the resource has changed since the
+	// version the request was based on.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrUnprocessable is a 422: the request refers to a resource that does
+	// not exist, such as a task's project.
+	ErrUnprocessable = errors.New("unprocessable entity")
+)
+
+// Error is an error response from the API.
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Message is the server's explanation.
+	Message string
+	// RequestID identifies the request in the server's logs, if it said.
+	RequestID string
+	// TraceID identifies the request's trace, if the server said.
+	TraceID string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Unwrap returns the error matching e's status code, or nil.
+func (e *Error) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	case http.StatusUnprocessableEntity:
+		return ErrUnprocessable
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ListFilters returns the user's saved filters and the filters shared with
+// their projects.
+func (c *Client) ListFilters(ctx context.Context) ([]SavedFilter, error) {
+	var filters []SavedFilter
+	err := c.do(ctx, request{method: http.MethodGet, path: "/filters"}, &filters)
+	return filters, err
+}
+
+// CreateFilter saves a filter and returns its ID.
+func (c *Client) CreateFilter(ctx context.Context, filter SavedFilter) (int, error) {
+	return c.create(ctx, "/filters", filter)
+}
+
+func (c *Client) GetFilter(ctx context.Context, id int) (SavedFilter, error) {
+	var filter SavedFilter
+	err := c.do(ctx, request{method: http.MethodGet, path: path("filters", id)}, &filter)
+	return filter, err
+}
+
+// DeleteFilter deletes a saved filter. Only its owner can.
+func (c *Client) DeleteFilter(ctx context.Context, id int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: path("filters", id)}, nil)
+}
+
+// ListFilterTasks returns the tasks the saved filter matches.
+func (c *Client) ListFilterTasks(ctx context.Context, id int) ([]Task, error) {
+	var tasks []Task
+	err := c.do(ctx, request{method: http.MethodGet, path: path("filters", id, "tasks")}, &tasks)
+	return tasks, err
+}
+
+// FilterCounts returns the number of tasks each filter ListFilters returns
+// matches.
+func (c *Client) FilterCounts(ctx context.Context) ([]FilterCount, error) {
+	var counts []FilterCount
+	err := c.do(ctx, request{method: http.MethodGet, path: "/filters/counts"}, &counts)
+	return counts, err
+}
@@ -0,0 +1,62 @@
+package client
+
+// Iterator walks a list that the API returns page by page, fetching the next
+// page when the current one is used up:
+//
+//	it := c.IterTasks(ctx)
+//	for it.Next() {
+//		task := it.Value()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	fetch func(page Page) ([]T, error)
+	id    func(T) int
+	size  int
+
+	page  []T
+	after int
+	value T
+	done  bool
+	err   error
+}
+
+func newIterator[T any](size int, id func(T) int, fetch func(Page) ([]T, error)) *Iterator[T] {
+	if size <= 0 {
+		size = 100
+	}
+	return &Iterator[T]{fetch: fetch, id: id, size: size}
+}
+
+// Next advances to the next item, which Value returns. It returns false at the
+// end of the list or when fetching a page fails, in which case Err returns
+// the error.
+func (it *Iterator[T]) Next() bool {
+	if len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+		it.page, it.err = it.fetch(Page{Limit: it.size, After: it.after})
+		if it.err != nil || len(it.page) < it.size {
+			it.done = true
+		}
+		if len(it.page) == 0 {
+			return false
+		}
+		it.after = it.id(it.page[len(it.page)-1])
+	}
+	it.value, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Value returns the current item.
+func (it *Iterator[T]) Value() T {
+	return it.value
+}
+
+// Err returns the error that ended the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
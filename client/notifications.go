@@ -0,0 +1,23 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListNotifications returns the user's notifications, newest first, or only
+// the unread ones.
+func (c *Client) ListNotifications(ctx context.Context, unreadOnly bool) ([]Notification, error) {
+	var query url.Values
+	if unreadOnly {
+		query = url.Values{"unread": {"true"}}
+	}
+	var notifications []Notification
+	err := c.do(ctx, request{method: http.MethodGet, path: "/notifications", query: query}, &notifications)
+	return notifications, err
+}
+
+func (c *Client) MarkNotificationRead(ctx context.Context, id int) error {
+	return c.do(ctx, request{method: http.MethodPost, path: path("notifications", id, "read")}, nil)
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// CreateOrganization creates an organization with its first admin. It is the
+// only call that needs no UserID; it returns the admin's ID to use after it.
+func (c *Client) CreateOrganization(ctx context.Context, name string, admin User) (orgID, adminID int, err error) {
+	var ids struct {
+		ID      int `json:"id"`
+		AdminID int `json:"adminId"`
+	}
+	err = c.do(ctx, request{method: http.MethodPost, path: "/organizations",
+		body: map[string]any{"name": name, "admin": admin}}, &ids)
+	return ids.ID, ids.AdminID, err
+}
+
+// GetOrganization returns the user's organization.
+func (c *Client) GetOrganization(ctx context.Context) (Organization, error) {
+	var org Organization
+	err := c.do(ctx, request{method: http.MethodGet, path: "/organization"}, &org)
+	return org, err
+}
+
+// RenameOrganization renames the user's organization. Only admins can.
+func (c *Client) RenameOrganization(ctx context.Context, name string) (Organization, error) {
+	var org Organization
+	err := c.do(ctx, request{method: http.MethodPut, path: "/organization", body: Organization{Name: name}}, &org)
+	return org, err
+}
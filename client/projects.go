@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ListProjects returns a page of the user's projects. The projects are listed
+// without their manager and due date; GetProject returns them.
+func (c *Client) ListProjects(ctx context.Context, page Page) ([]Project, error) {
+	var projects []Project
+	err := c.do(ctx, request{method: http.MethodGet, path: "/projects", query: pageQuery(nil, page)}, &projects)
+	return projects, err
+}
+
+// IterProjects iterates over the user's projects, as ListProjects lists them.
+func (c *Client) IterProjects(ctx context.Context) *Iterator[Project] {
+	return newIterator(c.PageSize, func(p Project) int { return p.ID }, func(page Page) ([]Project, error) {
+		return c.ListProjects(ctx, page)
+	})
+}
+
+// CreateProject creates a project, owned by its manager.
+func (c *Client) CreateProject(ctx context.Context, project Project) (Project, error) {
+	var created Project
+	err := c.do(ctx, request{method: http.MethodPost, path: "/projects", body: project}, &created)
+	return created, err
+}
+
+func (c *Client) GetProject(ctx context.Context, id int) (Project, error) {
+	var project Project
+	err := c.do(ctx, request{method: http.MethodGet, path: path("projects", id)}, &project)
+	return project, err
+}
+
+// UpdateProject replaces the project with the ID of project. Unless
+// project.Version is zero, the update fails with ErrPreconditionFailed if the
+// project has changed since that version.
+func (c *Client) UpdateProject(ctx context.Context, project Project) (Project, error) {
+	var updated Project
+	err := c.do(ctx, request{method: http.MethodPut, path: path("projects", project.ID), body: project, version: project.Version}, &updated)
+	return updated, err
+}
+
+// PatchProject changes the project with a merge patch or a JSONPatch. Unless
+// version is zero, it fails with ErrPreconditionFailed if the project has
+// changed since.
+func (c *Client) PatchProject(ctx context.Context, id, version int, patch any) (Project, error) {
+	var project Project
+	err := c.do(ctx, patchRequest(path("projects", id), version, patch), &project)
+	return project, err
+}
+
+// DeleteProject moves the project and its tasks to the trash. Unless version
+// is zero, it fails with ErrPreconditionFailed if the project has changed
+// since.
+func (c *Client) DeleteProject(ctx context.Context, id, version int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: path("projects", id), version: version}, nil)
+}
+
+// RestoreProject brings the project back from the trash, with the tasks
+// deleted with it.
+func (c *Client) RestoreProject(ctx context.Context, id int) (Project, error) {
+	var project Project
+	err := c.do(ctx, request{method: http.MethodPost, path: path("projects", id, "restore")}, &project)
+	return project, err
+}
+
+func (c *Client) ListProjectTasks(ctx context.Context, projectID int) ([]Task, error) {
+	var tasks []Task
+	err := c.do(ctx, request{method: http.MethodGet, path: path("projects", projectID, "tasks")}, &tasks)
+	return tasks, err
+}
+
+func (c *Client) ListProjectMembers(ctx context.Context, projectID int) ([]ProjectMember, error) {
+	var members []ProjectMember
+	err := c.do(ctx, request{method: http.MethodGet, path: path("projects", projectID, "members")}, &members)
+	return members, err
+}
+
+// SetProjectMember adds the user to the project, or changes their role: one
+// of RoleOwner, RoleMaintainer, RoleContributor and RoleViewer.
+func (c *Client) SetProjectMember(ctx context.Context, projectID, userID int, role string) (ProjectMember, error) {
+	var member ProjectMember
+	err := c.do(ctx, request{method: http.MethodPut, path: path("projects", projectID, "members", userID),
+		body: ProjectMember{Role: role}}, &member)
+	return member, err
+}
+
+func (c *Client) RemoveProjectMember(ctx context.Context, projectID, userID int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: path("projects", projectID, "members", userID)}, nil)
+}
+
+// SearchProjectsByTitle returns the projects whose title contains title.
+func (c *Client) SearchProjectsByTitle(ctx context.Context, title string) ([]Project, error) {
+	var projects []Project
+	err := c.do(ctx, request{method: http.MethodGet, path: "/projects/search/title", query: url.Values{"title": {title}}}, &projects)
+	return projects, err
+}
+
+func (c *Client) SearchProjectsByManager(ctx context.Context, managerID int) ([]Project, error) {
+	var projects []Project
+	err := c.do(ctx, request{method: http.MethodGet, path: "/projects/search/manager",
+		query: url.Values{"managerId": {strconv.Itoa(managerID)}}}, &projects)
+	return projects, err
+}
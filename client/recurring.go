@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func (c *Client) ListRecurringTasks(ctx context.Context) ([]RecurringTask, error) {
+	var rts []RecurringTask
+	err := c.do(ctx, request{method: http.MethodGet, path: "/recurring-tasks"}, &rts)
+	return rts, err
+}
+
+// CreateRecurringTask creates a recurring task and returns its ID.
+func (c *Client) CreateRecurringTask(ctx context.Context, rt RecurringTask) (int, error) {
+	return c.create(ctx, "/recurring-tasks", rt)
+}
+
+func (c *Client) GetRecurringTask(ctx context.Context, id int) (RecurringTask, error) {
+	var rt RecurringTask
+	err := c.do(ctx, request{method: http.MethodGet, path: path("recurring-tasks", id)}, &rt)
+	return rt, err
+}
+
+// DeleteRecurringTask stops the recurring task. The tasks already created
+// from it are kept.
+func (c *Client) DeleteRecurringTask(ctx context.Context, id int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: path("recurring-tasks", id)}, nil)
+}
+
+// ListOccurrences returns the occurrences of the recurring task from the time
+// from, or from now if it is zero, at most limit of them, or the server's
+// default number if limit is zero.
+func (c *Client) ListOccurrences(ctx context.Context, id int, from time.Time, limit int) ([]Occurrence, error) {
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var occurrences []Occurrence
+	err := c.do(ctx, request{method: http.MethodGet, path: path("recurring-tasks", id, "occurrences"), query: query}, &occurrences)
+	return occurrences, err
+}
+
+// UpdateOccurrence edits one occurrence of the recurring task, creating its
+// task if it does not exist yet. The fields of task left empty are taken from
+// the recurring task.
+func (c *Client) UpdateOccurrence(ctx context.Context, id int, occurrence time.Time, task Task) (Task, error) {
+	var updated Task
+	err := c.do(ctx, request{method: http.MethodPut, path: path("recurring-tasks", id, "occurrences", occurrence), body: task}, &updated)
+	return updated, err
+}
+
+// SkipOccurrence skips one occurrence of the recurring task, moving its task
+// to the trash if it was already created.
+func (c *Client) SkipOccurrence(ctx context.Context, id int, occurrence time.Time) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: path("recurring-tasks", id, "occurrences", occurrence)}, nil)
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Search searches the titles and descriptions of tasks and projects for text,
+// matching every word as a prefix.
+func (c *Client) Search(ctx context.Context, text string, opts SearchOptions) (SearchResults, error) {
+	query := url.Values{"q": {text}}
+	if opts.Language != "" {
+		query.Set("lang", opts.Language)
+	}
+	if len(opts.Types) > 0 {
+		query.Set("types", strings.Join(opts.Types, ","))
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	var results SearchResults
+	err := c.do(ctx, request{method: http.MethodGet, path: "/search", query: query}, &results)
+	return results, err
+}
+
+// GetTrash returns the deleted users, projects and tasks that can still be
+// restored.
+func (c *Client) GetTrash(ctx context.Context) (Trash, error) {
+	var trash Trash
+	err := c.do(ctx, request{method: http.MethodGet, path: "/trash"}, &trash)
+	return trash, err
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ListTasks returns a page of the tasks of the user's projects.
+func (c *Client) ListTasks(ctx context.Context, page Page) ([]Task, error) {
+	var tasks []Task
+	err := c.do(ctx, request{method: http.MethodGet, path: "/tasks", query: pageQuery(nil, page)}, &tasks)
+	return tasks, err
+}
+
+// IterTasks iterates over the tasks of the user's projects.
+func (c *Client) IterTasks(ctx context.Context) *Iterator[Task] {
+	return newIterator(c.PageSize, taskID, func(page Page) ([]Task, error) {
+		return c.ListTasks(ctx, page)
+	})
+}
+
+// CreateTask creates a task and returns its ID.
+func (c *Client) CreateTask(ctx context.Context, task Task) (int, error) {
+	return c.create(ctx, "/tasks", task)
+}
+
+func (c *Client) GetTask(ctx context.Context, id int) (Task, error) {
+	var task Task
+	err := c.do(ctx, request{method: http.MethodGet, path: path("tasks", id)}, &task)
+	return task, err
+}
+
+// UpdateTask replaces the task with the ID of task. Unless task.Version is
+// zero, the update fails with ErrPreconditionFailed if the task has changed
+// since that version.
+func (c *Client) UpdateTask(ctx context.Context, task Task) (Task, error) {
+	var updated Task
+	err := c.do(ctx, request{method: http.MethodPut, path: path("tasks", task.ID), body: task, version: task.Version}, &updated)
+	return updated, err
+}
+
+// PatchTask changes the task with a merge patch, such as
+// map[string]any{"status": "done"}, or a JSONPatch. Unless version is zero,
+// it fails with ErrPreconditionFailed if the task has changed since.
+func (c *Client) PatchTask(ctx context.Context, id, version int, patch any) (Task, error) {
+	var task Task
+	err := c.do(ctx, patchRequest(path("tasks", id), version, patch), &task)
+	return task, err
+}
+
+// DeleteTask moves the task to the trash. Unless version is zero, it fails
+// with ErrPreconditionFailed if the task has changed since.
+func (c *Client) DeleteTask(ctx context.Context, id, version int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: path("tasks", id), version: version}, nil)
+}
+
+// RestoreTask brings the task back from the trash.
+func (c *Client) RestoreTask(ctx context.Context, id int) (Task, error) {
+	var task Task
+	err := c.do(ctx, request{method: http.MethodPost, path: path("tasks", id, "restore")}, &task)
+	return task, err
+}
+
+// ListTaskComments returns the comments on the task, oldest first.
+func (c *Client) ListTaskComments(ctx context.Context, taskID int) ([]Comment, error) {
+	var comments []Comment
+	err := c.do(ctx, request{method: http.MethodGet, path: path("tasks", taskID, "comments")}, &comments)
+	return comments, err
+}
+
+// CreateTaskComment comments on the task and returns the comment's ID. The
+// members of the task's project it mentions as @name are emailed.
+func (c *Client) CreateTaskComment(ctx context.Context, taskID int, body string) (int, error) {
+	return c.create(ctx, path("tasks", taskID, "comments"), Comment{Body: body})
+}
+
+// SearchTasks returns a page of the tasks matching every criterion of filter.
+func (c *Client) SearchTasks(ctx context.Context, filter TaskFilter, page Page) ([]Task, error) {
+	query := url.Values{}
+	set := func(key, value string) {
+		if value != "" && value != "0" {
+			query.Set(key, value)
+		}
+	}
+	set("title", filter.Title)
+	set("status", filter.Status)
+	set("priority", filter.Priority)
+	set("respId", strconv.Itoa(filter.RespId))
+	set("projectId", strconv.Itoa(filter.ProjectID))
+
+	var tasks []Task
+	err := c.do(ctx, request{method: http.MethodGet, path: "/tasks/search", query: pageQuery(query, page)}, &tasks)
+	return tasks, err
+}
+
+// IterSearchTasks iterates over the tasks matching every criterion of filter.
+func (c *Client) IterSearchTasks(ctx context.Context, filter TaskFilter) *Iterator[Task] {
+	return newIterator(c.PageSize, taskID, func(page Page) ([]Task, error) {
+		return c.SearchTasks(ctx, filter, page)
+	})
+}
+
+// BulkTasks applies an operation to many tasks in a single transaction.
+func (c *Client) BulkTasks(ctx context.Context, req BulkTaskRequest) (BulkTaskResponse, error) {
+	var res BulkTaskResponse
+	err := c.do(ctx, request{method: http.MethodPost, path: "/tasks/bulk", body: req}, &res)
+	return res, err
+}
+
+func taskID(task Task) int { return task.ID }
@@ -0,0 +1,120 @@
+package client
+
+import "github.com/allwsaa/project-api/internal/models"
+
+// The API's resources, as the server defines them.
+type (
+	Organization            = models.Organization
+	User                    = models.User
+	Project                 = models.Project
+	ProjectMember           = models.ProjectMember
+	Task                    = models.Task
+	Comment                 = models.Comment
+	TaskFilter              = models.TaskFilter
+	SavedFilter             = models.SavedFilter
+	RecurringTask           = models.RecurringTask
+	Occurrence              = models.Occurrence
+	Notification            = models.Notification
+	NotificationPreferences = models.NotificationPreferences
+
+	// Page selects part of a list ordered by ID, for the methods listing
+	// one page at a time. The zero Page selects the whole list.
+	Page = models.Page
+)
+
+// Project roles, from most to least privileged.
+const (
+	RoleOwner       = models.RoleOwner
+	RoleMaintainer  = models.RoleMaintainer
+	RoleContributor = models.RoleContributor
+	RoleViewer      = models.RoleViewer
+)
+
+// Organization roles.
+const (
+	OrgAdmin  = models.OrgAdmin
+	OrgMember = models.OrgMember
+)
+
+// BulkTaskRequest applies one operation to the tasks listed in IDs, or to the
+// tasks matching Filter.
+type BulkTaskRequest struct {
+	// Operation is set_status, set_priority, reassign, move or delete.
+	Operation string      `json:"operation"`
+	Status    string      `json:"status,omitempty"`
+	Priority  string      `json:"priority,omitempty"`
+	RespId    int         `json:"respId,omitempty"`
+	ProjectID int         `json:"projectId,omitempty"`
+	IDs       []int       `json:"ids,omitempty"`
+	Filter    *TaskFilter `json:"filter,omitempty"`
+	// DryRun only reports what would change.
+	DryRun bool `json:"dryRun"`
+}
+
+type BulkTaskResponse struct {
+	Operation string           `json:"operation"`
+	DryRun    bool             `json:"dryRun"`
+	Matched   int              `json:"matched"`
+	Results   []BulkTaskResult `json:"results"`
+}
+
+// BulkTaskResult is the outcome for one task: updated, deleted, unchanged,
+// not_found, not_member or forbidden.
+type BulkTaskResult struct {
+	ID     int    `json:"id"`
+	Result string `json:"result"`
+	Task   *Task  `json:"task,omitempty"`
+}
+
+// FilterCount is the number of tasks a saved filter matches.
+type FilterCount struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// SearchOptions refine a full-text search. The zero value searches tasks and
+// projects in the server's default language.
+type SearchOptions struct {
+	// Language is the text search language, such as english or simple.
+	Language string
+	// Types are the types of results: tasks, projects or both.
+	Types []string
+	// Limit is the maximum number of results of each type.
+	Limit int
+}
+
+type SearchResults struct {
+	Query    string      `json:"query"`
+	Language string      `json:"language"`
+	Tasks    []SearchHit `json:"tasks,omitempty"`
+	Projects []SearchHit `json:"projects,omitempty"`
+}
+
+// SearchHit is a matching task or project, with a snippet of its text in
+// which the matches are marked with <mark>.
+type SearchHit struct {
+	ID        int     `json:"id"`
+	Title     string  `json:"title"`
+	Snippet   string  `json:"snippet"`
+	Rank      float64 `json:"rank"`
+	ProjectID int     `json:"projectId,omitempty"`
+}
+
+// Trash holds the deleted resources that can still be restored.
+type Trash struct {
+	Users    []User    `json:"users"`
+	Projects []Project `json:"projects"`
+	Tasks    []Task    `json:"tasks"`
+}
+
+// JSONPatch is an RFC 6902 JSON Patch. The Patch methods send it as such, and
+// any other patch as an RFC 7396 merge patch.
+type JSONPatch []PatchOperation
+
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
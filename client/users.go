@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListUsers returns a page of the users of the organization.
+func (c *Client) ListUsers(ctx context.Context, page Page) ([]User, error) {
+	var users []User
+	err := c.do(ctx, request{method: http.MethodGet, path: "/users", query: pageQuery(nil, page)}, &users)
+	return users, err
+}
+
+// IterUsers iterates over the users of the organization.
+func (c *Client) IterUsers(ctx context.Context) *Iterator[User] {
+	return newIterator(c.PageSize, func(u User) int { return u.ID }, func(page Page) ([]User, error) {
+		return c.ListUsers(ctx, page)
+	})
+}
+
+// CreateUser adds a member to the organization. Only admins can.
+func (c *Client) CreateUser(ctx context.Context, user User) (User, error) {
+	var created User
+	err := c.do(ctx, request{method: http.MethodPost, path: "/users", body: user}, &created)
+	return created, err
+}
+
+func (c *Client) GetUser(ctx context.Context, id int) (User, error) {
+	var user User
+	err := c.do(ctx, request{method: http.MethodGet, path: path("users", id)}, &user)
+	return user, err
+}
+
+// UpdateUser replaces the user with the ID of user. Unless user.Version is
+// zero, the update fails with ErrPreconditionFailed if the user has changed
+// since that version.
+func (c *Client) UpdateUser(ctx context.Context, user User) error {
+	return c.do(ctx, request{method: http.MethodPut, path: path("users", user.ID), body: user, version: user.Version}, nil)
+}
+
+// PatchUser changes the user with a merge patch or a JSONPatch. Unless
+// version is zero, it fails with ErrPreconditionFailed if the user has
+// changed since.
+func (c *Client) PatchUser(ctx context.Context, id, version int, patch any) (User, error) {
+	var user User
+	err := c.do(ctx, patchRequest(path("users", id), version, patch), &user)
+	return user, err
+}
+
+// DeleteUser moves the user to the trash. Unless version is zero, it fails
+// with ErrPreconditionFailed if the user has changed since.
+func (c *Client) DeleteUser(ctx context.Context, id, version int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: path("users", id), version: version}, nil)
+}
+
+// RestoreUser brings the user back from the trash.
+func (c *Client) RestoreUser(ctx context.Context, id int) (User, error) {
+	var user User
+	err := c.do(ctx, request{method: http.MethodPost, path: path("users", id, "restore")}, &user)
+	return user, err
+}
+
+// SetOrgRole makes the user an OrgAdmin or an OrgMember.
+func (c *Client) SetOrgRole(ctx context.Context, id int, role string) error {
+	return c.do(ctx, request{method: http.MethodPut, path: path("users", id, "org-role"),
+		body: map[string]string{"orgRole": role}}, nil)
+}
+
+// ListUserTasks returns the tasks assigned to the user.
+func (c *Client) ListUserTasks(ctx context.Context, userID int) ([]Task, error) {
+	var tasks []Task
+	err := c.do(ctx, request{method: http.MethodGet, path: path("users", userID, "tasks")}, &tasks)
+	return tasks, err
+}
+
+// FindUsersByName returns the users whose name matches name.
+func (c *Client) FindUsersByName(ctx context.Context, name string) ([]User, error) {
+	return c.findUsers(ctx, url.Values{"name": {name}})
+}
+
+// FindUsersByEmail returns the user with the email address, if any.
+func (c *Client) FindUsersByEmail(ctx context.Context, email string) ([]User, error) {
+	return c.findUsers(ctx, url.Values{"email": {email}})
+}
+
+func (c *Client) findUsers(ctx context.Context, query url.Values) ([]User, error) {
+	var users []User
+	err := c.do(ctx, request{method: http.MethodGet, path: "/users/search", query: query}, &users)
+	return users, err
+}
+
+func (c *Client) GetNotificationPreferences(ctx context.Context, userID int) (NotificationPreferences, error) {
+	var prefs NotificationPreferences
+	err := c.do(ctx, request{method: http.MethodGet, path: path("users", userID, "notification-preferences")}, &prefs)
+	return prefs, err
+}
+
+func (c *Client) UpdateNotificationPreferences(ctx context.Context, userID int, prefs NotificationPreferences) (NotificationPreferences, error) {
+	var updated NotificationPreferences
+	err := c.do(ctx, request{method: http.MethodPut, path: path("users", userID, "notification-preferences"), body: prefs}, &updated)
+	return updated, err
+}
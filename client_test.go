@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allwsaa/project-api/client"
+)
+
+// The tests in this file use the client package against the real API, so
+// that its paths, request bodies and response types are checked against the
+// handlers they call.
+
+// newTestClient returns an anonymous client of the API at baseURL that
+// retries almost without waiting.
+func newTestClient(baseURL string) *client.Client {
+	c := client.New(baseURL, 0)
+	c.Backoff = time.Millisecond
+	return c
+}
+
+func TestClient(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+
+	_, adminID, err := newTestClient(api.URL).CreateOrganization(ctx, "acme",
+		client.User{Name: "Ada", Email: "ada@acme.example.com", Role: "manager"})
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	admin := newTestClient(api.URL).As(adminID)
+	if org, err := admin.GetOrganization(ctx); err != nil || org.Name != "acme" {
+		t.Fatalf("GetOrganization = %+v, %v", org, err)
+	}
+
+	bob, err := admin.CreateUser(ctx, client.User{Name: "Bob", Email: "bob@acme.example.com", Role: "developer"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	project, err := admin.CreateProject(ctx, client.Project{
+		ProjectTitle: "Launch", ManagerId: adminID, Completed: time.Now().Add(30 * 24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	if _, err := admin.SetProjectMember(ctx, project.ID, bob.ID, client.RoleContributor); err != nil {
+		t.Fatalf("SetProjectMember: %v", err)
+	}
+
+	var taskIDs []int
+	for _, title := range []string{"Plan", "Build", "Test", "Release", "Announce"} {
+		id, err := admin.CreateTask(ctx, client.Task{
+			Title: title, Priority: "medium", Status: "new", RespId: bob.ID, ProjectID: project.ID,
+			CompletionDate: time.Now().Add(48 * time.Hour)})
+		if err != nil {
+			t.Fatalf("CreateTask: %v", err)
+		}
+		taskIDs = append(taskIDs, id)
+	}
+
+	// Updates are conditioned on the version they were based on.
+	task, err := admin.GetTask(ctx, taskIDs[0])
+	if err != nil {
+		t.Fatalf("GetTask: %v", err)
+	}
+	stale := task
+	task.Status = "inprogress"
+	if task, err = admin.UpdateTask(ctx, task); err != nil || task.Version != 2 {
+		t.Fatalf("UpdateTask = %+v, %v", task, err)
+	}
+	if _, err := admin.UpdateTask(ctx, stale); !errors.Is(err, client.ErrPreconditionFailed) {
+		t.Errorf("UpdateTask of a stale version: %v, want ErrPreconditionFailed", err)
+	}
+	task, err = admin.PatchTask(ctx, task.ID, task.Version, map[string]any{"status": "done"})
+	if err != nil || task.Status != "done" {
+		t.Fatalf("PatchTask with a merge patch = %+v, %v", task, err)
+	}
+	task, err = admin.PatchTask(ctx, task.ID, 0, client.JSONPatch{{Op: "replace", Path: "/priority", Value: "high"}})
+	if err != nil || task.Priority != "high" {
+		t.Fatalf("PatchTask with a JSON Patch = %+v, %v", task, err)
+	}
+
+	// Comments are listed oldest first.
+	if _, err := admin.As(bob.ID).CreateTaskComment(ctx, task.ID, "Done, @ada please check"); err != nil {
+		t.Fatalf("CreateTaskComment: %v", err)
+	}
+	comments, err := admin.ListTaskComments(ctx, task.ID)
+	if err != nil || len(comments) != 1 || *comments[0].AuthorID != bob.ID {
+		t.Errorf("ListTaskComments = %+v, %v", comments, err)
+	}
+
+	// The iterators page through the lists.
+	paged := admin.As(bob.ID)
+	paged.PageSize = 2
+	var got []int
+	it := paged.IterTasks(ctx)
+	for it.Next() {
+		got = append(got, it.Value().ID)
+	}
+	if err := it.Err(); err != nil || len(got) != len(taskIDs) || got[0] != taskIDs[0] || got[4] != taskIDs[4] {
+		t.Errorf("IterTasks = %v, %v; want %v", got, err, taskIDs)
+	}
+	got = nil
+	search := paged.IterSearchTasks(ctx, client.TaskFilter{Status: "new"})
+	for search.Next() {
+		got = append(got, search.Value().ID)
+	}
+	if err := search.Err(); err != nil || len(got) != 4 {
+		t.Errorf("IterSearchTasks = %v, %v; want the 4 new tasks", got, err)
+	}
+	var users int
+	for it := paged.IterUsers(ctx); it.Next(); {
+		users++
+	}
+	if users != 2 {
+		t.Errorf("IterUsers returned %d users, want 2", users)
+	}
+
+	results, err := admin.Search(ctx, "releas", client.SearchOptions{Types: []string{"tasks"}})
+	if err != nil || len(results.Tasks) != 1 || results.Tasks[0].ID != taskIDs[3] {
+		t.Errorf("Search = %+v, %v", results, err)
+	}
+	bulk, err := admin.BulkTasks(ctx, client.BulkTaskRequest{Operation: "set_priority", Priority: "low", IDs: taskIDs[1:3]})
+	if err != nil || bulk.Matched != 2 {
+		t.Errorf("BulkTasks = %+v, %v", bulk, err)
+	}
+
+	if err := admin.DeleteTask(ctx, taskIDs[4], 0); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	if trash, err := admin.GetTrash(ctx); err != nil || len(trash.Tasks) != 1 {
+		t.Errorf("GetTrash = %+v, %v", trash, err)
+	}
+	if task, err := admin.RestoreTask(ctx, taskIDs[4]); err != nil || task.DeletedAt != nil {
+		t.Errorf("RestoreTask = %+v, %v", task, err)
+	}
+
+	filterID, err := admin.CreateFilter(ctx, client.SavedFilter{Name: "Low", Criteria: client.TaskFilter{Priority: "low"}})
+	if err != nil {
+		t.Fatalf("CreateFilter: %v", err)
+	}
+	if counts, err := admin.FilterCounts(ctx); err != nil || len(counts) != 1 || counts[0].ID != filterID || counts[0].Count != 2 {
+		t.Errorf("FilterCounts = %+v, %v", counts, err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	api := newTestAPI(t)
+	seed(t, api)
+	ctx := context.Background()
+	admin := newTestClient(api.URL).As(adminID)
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"bad request", func() error {
+			_, err := admin.SearchTasks(ctx, client.TaskFilter{}, client.Page{})
+			return err
+		}(), client.ErrBadRequest},
+		{"not found", func() error {
+			_, err := admin.GetTask(ctx, 999)
+			return err
+		}(), client.ErrNotFound},
+		{"conflict", admin.RemoveProjectMember(ctx, projectID, adminID), client.ErrConflict},
+		{"unprocessable", func() error {
+			_, err := admin.CreateTask(ctx, client.Task{Title: "Orphan", RespId: adminID, ProjectID: 999})
+			return err
+		}(), client.ErrUnprocessable},
+	}
+	for _, tt := range tests {
+		var apiErr *client.Error
+		if !errors.Is(tt.err, tt.want) || !errors.As(tt.err, &apiErr) || apiErr.Message == "" || apiErr.RequestID == "" {
+			t.Errorf("%s: got %v, want %v with the server's message and request ID", tt.name, tt.err, tt.want)
+		}
+	}
+}
+
+// TestClientRetries checks that server errors are retried, and that a
+// retried POST creates its resource only once.
+func TestClientRetries(t *testing.T) {
+	api := newTestAPI(t)
+	seed(t, api)
+	ctx := context.Background()
+
+	// The proxy passes requests on to the API but answers the first one
+	// with 503, as if the response had been lost.
+	target, err := url.Parse(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attempts atomic.Int32
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ModifyResponse = func(res *http.Response) error {
+		if attempts.Add(1) == 1 {
+			res.StatusCode = http.StatusServiceUnavailable
+		}
+		return nil
+	}
+	srv := httptest.NewServer(proxy)
+	t.Cleanup(srv.Close)
+
+	c := newTestClient(srv.URL).As(adminID)
+	before, err := c.ListTasks(ctx, client.Page{})
+	if err != nil {
+		t.Fatalf("ListTasks: %v", err)
+	}
+	attempts.Store(0)
+	id, err := c.CreateTask(ctx, client.Task{Title: "Retried", Priority: "low", Status: "new", RespId: adminID, ProjectID: projectID})
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("CreateTask took %d attempts, want 2", attempts.Load())
+	}
+	after, err := c.ListTasks(ctx, client.Page{})
+	if err != nil || len(after) != len(before)+1 || after[len(after)-1].ID != id {
+		t.Errorf("tasks after a retried CreateTask: %d, %v; want %d", len(after), err, len(before)+1)
+	}
+
+	// A server that keeps failing is given up on after MaxRetries.
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+	attempts.Store(0)
+	_, err = newTestClient(failing.URL).GetTask(ctx, 1)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || attempts.Load() != 4 {
+		t.Errorf("GetTask from a failing server: %v after %d attempts; want a 500 after 4", err, attempts.Load())
+	}
+}
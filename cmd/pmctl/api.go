@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/problem"
+)
+
+// cli sends requests to the API and prints their results.
+type cli struct {
+	opts options
+	http *http.Client
+	out  io.Writer
+}
+
+func newCLI(opts options, out io.Writer) *cli {
+	return &cli{opts: opts, http: &http.Client{Timeout: 30 * time.Second}, out: out}
+}
+
+// get sends a GET request and returns the decoded JSON response.
+func (c *cli) get(path string, query url.Values) (any, error) {
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return c.send(http.MethodGet, path, "", nil)
+}
+
+// send sends a request with body, if not nil, encoded as JSON and returns
+// the decoded JSON response, or nil if it has no body. Responses other than
+// 2xx are returned as errors carrying the server's message.
+func (c *cli) send(method, path, contentType string, body any) (any, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+		if contentType == "" {
+			contentType = "application/json"
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.opts.Server, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	if c.opts.User != 0 {
+		req.Header.Set("X-User-ID", strconv.Itoa(c.opts.User))
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		message := strings.TrimSpace(string(data))
+		var details problem.Details
+		if strings.HasPrefix(res.Header.Get("Content-Type"), problem.ContentType) && json.Unmarshal(data, &details) == nil {
+			message = details.Detail
+			if details.RequestID != "" {
+				message += " (request " + details.RequestID + ")"
+			}
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, res.Status, message)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("%s %s: decoding response: %w", method, path, err)
+	}
+	return v, nil
+}
+
+// createdID returns the "id" of the response to a POST that created a
+// resource.
+func createdID(v any) (string, error) {
+	m, _ := v.(map[string]any)
+	id, ok := m["id"].(float64)
+	if !ok {
+		return "", fmt.Errorf("the response has no id: %v", v)
+	}
+	return strconv.FormatFloat(id, 'f', -1, 64), nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// command is a node of the command tree: either a group of subcommands or a
+// command that can be run.
+type command struct {
+	name    string
+	args    string // the positional arguments, e.g. "ID" or "QUERY..."
+	summary string
+
+	subcommands []*command
+
+	// run defines the command's flags on fs and returns the function that
+	// runs the command once they are parsed.
+	run func(fs *flag.FlagSet) func(c *cli, args []string) error
+}
+
+func (cmd *command) subcommand(name string) *command {
+	for _, sub := range cmd.subcommands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// checkArgs checks the number of positional arguments against cmd.args.
+func (cmd *command) checkArgs(args []string) error {
+	names := strings.Fields(cmd.args)
+	if n := len(names); n > 0 && strings.HasSuffix(names[n-1], "...") {
+		if len(args) < n {
+			return fmt.Errorf("expected %s", cmd.args)
+		}
+		return nil
+	}
+	if len(args) != len(names) {
+		if len(names) == 0 {
+			return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+		}
+		return fmt.Errorf("expected %s", cmd.args)
+	}
+	return nil
+}
+
+// flags returns the flags cmd takes, including the options every command
+// takes.
+func (cmd *command) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	var opts options
+	opts.register(fs)
+	if cmd.run != nil {
+		cmd.run(fs)
+	}
+	return fs
+}
+
+func (cmd *command) usage(w io.Writer, path []string) {
+	name := strings.Join(append([]string{"pmctl"}, path...), " ")
+	if cmd.run != nil {
+		if cmd.args != "" {
+			name += " " + cmd.args
+		}
+		fmt.Fprintf(w, "Usage: %s [flags]\n\n%s.\n\nFlags:\n", name, cmd.summary)
+		fs := cmd.flags()
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+		return
+	}
+
+	fmt.Fprintf(w, "Usage: %s <command> [arguments] [flags]\n\n", name)
+	if cmd == root {
+		fmt.Fprint(w, rootHelp)
+	}
+	fmt.Fprint(w, "Commands:\n")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, sub := range cmd.subcommands {
+		fmt.Fprintf(tw, "  %s\t%s\n", sub.name, sub.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for more about a command.\n", name)
+}
+
+const rootHelp = `pmctl talks to the project API. Every command takes -server, -token and
+-user, which are read from the config file (-config, $PMCTL_CONFIG or
+~/.config/pmctl/config.yaml), e.g.
+
+  server: https://project-api.example.com
+  token: secret
+  user: 1
+  output: table
+
+and can be overridden by $PMCTL_SERVER, $PMCTL_TOKEN, $PMCTL_USER and
+$PMCTL_OUTPUT, and by flags. Results are printed as a table, or with
+-o json or -o yaml as the API returned them.
+
+`
+
+// group returns a command grouping subcommands.
+func group(name, summary string, subcommands ...*command) *command {
+	return &command{name: name, summary: summary, subcommands: subcommands}
+}
+
+// get returns a command printing the response to a GET of path, in which
+// each {} is replaced by the next argument.
+func get(name, args, summary, path string, cols []column) *command {
+	return &command{name: name, args: args, summary: summary, run: func(*flag.FlagSet) func(*cli, []string) error {
+		return func(c *cli, args []string) error {
+			v, err := c.get(expand(path, args), nil)
+			if err != nil {
+				return err
+			}
+			return c.print(v, cols)
+		}
+	}}
+}
+
+// remove returns a command deleting the resource at path, and reporting it
+// with message, formatted with the arguments.
+func remove(name, args, summary, path, message string) *command {
+	return &command{name: name, args: args, summary: summary, run: func(*flag.FlagSet) func(*cli, []string) error {
+		return func(c *cli, args []string) error {
+			if _, err := c.send("DELETE", expand(path, args), "", nil); err != nil {
+				return err
+			}
+			values := make([]any, len(args))
+			for i, arg := range args {
+				values[i] = arg
+			}
+			return c.done(message, values...)
+		}
+	}}
+}
+
+// restore returns a command bringing the resource at path back from the
+// trash.
+func restore(noun, path string, cols []column) *command {
+	return &command{name: "restore", args: "ID", summary: "Restore a " + noun + " from the trash", run: func(*flag.FlagSet) func(*cli, []string) error {
+		return func(c *cli, args []string) error {
+			v, err := c.send("POST", expand(path, args), "", nil)
+			if err != nil {
+				return err
+			}
+			return c.print(v, cols)
+		}
+	}}
+}
+
+// expand replaces each {} in path by the next argument.
+func expand(path string, args []string) string {
+	for _, arg := range args {
+		path = strings.Replace(path, "{}", url.PathEscape(arg), 1)
+	}
+	return path
+}
+
+// field is a flag setting a field of a request body.
+type field struct {
+	flag, key, kind, usage, def string
+}
+
+// Kinds of fields.
+const (
+	text    = "text"
+	integer = "integer"
+	date    = "date"
+)
+
+// fieldFlags are the values of the flags defined for a list of fields.
+type fieldFlags struct {
+	fs     *flag.FlagSet
+	fields []field
+	values map[string]*string
+}
+
+// defineFields defines a flag for each field, with the field's default if
+// defaults is set.
+func defineFields(fs *flag.FlagSet, fields []field, defaults bool) *fieldFlags {
+	ff := &fieldFlags{fs: fs, fields: fields, values: make(map[string]*string)}
+	for _, f := range fields {
+		def := ""
+		if defaults {
+			def = f.def
+		}
+		ff.values[f.flag] = fs.String(f.flag, def, f.usage)
+	}
+	return ff
+}
+
+// body returns the request body the flags describe: every flag with a
+// value, or with onlyGiven only the flags given on the command line, as a
+// merge patch needs. The required flags must have a value.
+func (ff *fieldFlags) body(onlyGiven bool, required ...string) (map[string]any, error) {
+	given := make(map[string]bool)
+	ff.fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, name := range required {
+		if *ff.values[name] == "" {
+			return nil, fmt.Errorf("-%s is required", name)
+		}
+	}
+
+	body := make(map[string]any)
+	for _, f := range ff.fields {
+		value := *ff.values[f.flag]
+		if onlyGiven && !given[f.flag] || !onlyGiven && value == "" {
+			continue
+		}
+		switch f.kind {
+		case integer:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("-%s: %q is not a number", f.flag, value)
+			}
+			body[f.key] = n
+		case date:
+			t, err := parseTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("-%s: %w", f.flag, err)
+			}
+			body[f.key] = t.Format(time.RFC3339)
+		default:
+			body[f.key] = value
+		}
+	}
+	return body, nil
+}
+
+// parseTime accepts a date, taken as midnight UTC, or an RFC 3339 time.
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date (2006-01-02) nor an RFC 3339 time", value)
+	}
+	return t, nil
+}
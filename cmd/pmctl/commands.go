@@ -0,0 +1,552 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The tables' columns for each kind of resource.
+var (
+	taskColumns = columns("ID", "id", "TITLE", "title", "STATUS", "status", "PRIORITY", "priority",
+		"ASSIGNEE", "respId", "PROJECT", "projectId", "DUE", "completionDate", "VERSION", "version")
+	projectColumns = columns("ID", "id", "TITLE", "projectTitle", "MANAGER", "managerId",
+		"STARTED", "started", "DUE", "completed", "VERSION", "version")
+	// The project lists leave out the manager and due date.
+	projectListColumns = columns("ID", "id", "TITLE", "projectTitle", "DESCRIPTION", "projectDescription",
+		"STARTED", "started", "VERSION", "version")
+	userColumns = columns("ID", "id", "NAME", "name", "EMAIL", "email", "ROLE", "role",
+		"ORG ROLE", "orgRole", "VERSION", "version")
+	memberColumns       = columns("USER", "userId", "ROLE", "role", "ADDED", "addedAt")
+	organizationColumns = columns("ID", "id", "NAME", "name", "CREATED", "createdAt")
+	recurringColumns    = columns("ID", "id", "TITLE", "title", "RRULE", "rrule", "TIME ZONE", "timeZone",
+		"NEXT", "nextOccurrence", "ASSIGNEE", "respId", "PROJECT", "projectId")
+	occurrenceColumns   = columns("OCCURRENCE", "occurrence", "STATUS", "status", "TASK", "taskId")
+	filterColumns       = columns("ID", "id", "NAME", "name", "OWNER", "ownerId", "PROJECT", "projectId", "CRITERIA", "criteria")
+	filterCountColumns  = columns("ID", "id", "NAME", "name", "COUNT", "count")
+	notificationColumns = columns("ID", "id", "TASK", "taskId", "KIND", "kind", "DUE", "dueAt",
+		"MESSAGE", "message", "READ", "readAt")
+	hitColumns        = columns("ID", "id", "TITLE", "title", "RANK", "rank", "SNIPPET", "snippet")
+	bulkColumns       = columns("ID", "id", "RESULT", "result")
+	preferenceColumns = columns("EMAIL", "email")
+)
+
+// The flags setting the fields of each kind of resource.
+var (
+	taskFields = []field{
+		{"title", "title", text, "title", ""},
+		{"description", "description", text, "description", ""},
+		{"priority", "priority", text, "priority: low, medium or high", "medium"},
+		{"status", "status", text, "status: new, inprogress or done", "new"},
+		{"assignee", "respId", integer, "ID of the assigned user", ""},
+		{"project", "projectId", integer, "project ID", ""},
+		{"due", "completionDate", date, "due date, as 2006-01-02 or an RFC 3339 time", ""},
+	}
+	projectFields = []field{
+		{"title", "projectTitle", text, "title", ""},
+		{"description", "projectDescription", text, "description", ""},
+		{"manager", "managerId", integer, "ID of the managing user", ""},
+		{"due", "completed", date, "due date, as 2006-01-02 or an RFC 3339 time", ""},
+	}
+	userFields = []field{
+		{"name", "name", text, "name", ""},
+		{"email", "email", text, "email address", ""},
+		{"role", "role", text, "job role, e.g. developer", ""},
+	}
+	recurringFields = []field{
+		{"title", "title", text, "title", ""},
+		{"description", "description", text, "description", ""},
+		{"priority", "priority", text, "priority: low, medium or high", "medium"},
+		{"assignee", "respId", integer, "ID of the assigned user", ""},
+		{"project", "projectId", integer, "project ID", ""},
+		{"rrule", "rrule", text, "recurrence rule, e.g. FREQ=WEEKLY;BYDAY=MO", ""},
+		{"time-zone", "timeZone", text, "time zone of the rule, e.g. Europe/Berlin", ""},
+		{"starts", "startsAt", date, "first occurrence, as 2006-01-02 or an RFC 3339 time", ""},
+	}
+	// criteriaFields are the criteria of a saved filter.
+	criteriaFields = []field{
+		{"title", "title", text, "title contains", ""},
+		{"status", "status", text, "status", ""},
+		{"priority", "priority", text, "priority", ""},
+		{"assignee", "respId", integer, "assigned user ID", ""},
+		{"in-project", "projectId", integer, "project ID", ""},
+	}
+)
+
+var root = group("pmctl", "",
+	group("tasks", "List, create and change tasks",
+		listTasks(),
+		get("show", "ID", "Show a task", "/tasks/{}", taskColumns),
+		create("task", "/tasks", "/tasks/", taskFields, taskColumns, "title", "assignee", "project"),
+		update("task", "/tasks/{}", taskFields, taskColumns),
+		remove("delete", "ID", "Move a task to the trash", "/tasks/{}", "Moved task %s to the trash."),
+		restore("task", "/tasks/{}/restore", taskColumns),
+		search("tasks", taskColumns),
+		bulkTasks(),
+	),
+	group("projects", "List, create and change projects and their members",
+		get("list", "", "List the projects", "/projects", projectListColumns),
+		get("show", "ID", "Show a project", "/projects/{}", projectColumns),
+		create("project", "/projects", "/projects/", projectFields, projectColumns, "title", "manager"),
+		update("project", "/projects/{}", projectFields, projectColumns),
+		remove("delete", "ID", "Move a project and its tasks to the trash", "/projects/{}", "Moved project %s to the trash."),
+		restore("project", "/projects/{}/restore", projectColumns),
+		get("tasks", "ID", "List a project's tasks", "/projects/{}/tasks", taskColumns),
+		get("members", "ID", "List a project's members", "/projects/{}/members", memberColumns),
+		setMember(),
+		remove("remove-member", "ID USER", "Remove a member from a project", "/projects/{}/members/{}", "Removed user %[2]s from project %[1]s."),
+		searchProjects(),
+	),
+	group("users", "List, create and change the users of the organization",
+		get("list", "", "List the users", "/users", userColumns),
+		get("show", "ID", "Show a user", "/users/{}", userColumns),
+		create("user", "/users", "/users/", userFields, userColumns, "name", "email", "role"),
+		update("user", "/users/{}", userFields, userColumns),
+		remove("delete", "ID", "Move a user to the trash", "/users/{}", "Moved user %s to the trash."),
+		restore("user", "/users/{}/restore", userColumns),
+		get("tasks", "ID", "List the tasks assigned to a user", "/users/{}/tasks", taskColumns),
+		searchUsers(),
+		setOrgRole(),
+		get("preferences", "ID", "Show a user's notification preferences", "/users/{}/notification-preferences", preferenceColumns),
+		setPreferences(),
+	),
+	group("organization", "Show, rename and create organizations",
+		get("show", "", "Show the organization", "/organization", organizationColumns),
+		renameOrganization(),
+		createOrganization(),
+	),
+	group("recurring", "Manage recurring tasks and their occurrences",
+		get("list", "", "List the recurring tasks", "/recurring-tasks", recurringColumns),
+		get("show", "ID", "Show a recurring task", "/recurring-tasks/{}", recurringColumns),
+		create("recurring task", "/recurring-tasks", "/recurring-tasks/", recurringFields, recurringColumns, "title", "assignee", "project", "rrule"),
+		remove("delete", "ID", "Stop a recurring task", "/recurring-tasks/{}", "Stopped recurring task %s."),
+		listOccurrences(),
+		editOccurrence(),
+		remove("skip", "ID OCCURRENCE", "Skip an occurrence of a recurring task", "/recurring-tasks/{}/occurrences/{}", "Skipped occurrence %[2]s of recurring task %[1]s."),
+	),
+	group("filters", "Manage saved task filters",
+		get("list", "", "List your filters and those shared with your projects", "/filters", filterColumns),
+		get("show", "ID", "Show a filter", "/filters/{}", filterColumns),
+		get("counts", "", "Count the tasks each filter matches", "/filters/counts", filterCountColumns),
+		get("tasks", "ID", "List the tasks a filter matches", "/filters/{}/tasks", taskColumns),
+		createFilter(),
+		remove("delete", "ID", "Delete a filter", "/filters/{}", "Deleted filter %s."),
+	),
+	group("notifications", "List and read notifications",
+		listNotifications(),
+		markRead(),
+	),
+	searchAll(),
+	trash(),
+	completion(),
+)
+
+func listTasks() *command {
+	return &command{name: "list", summary: "List tasks, optionally only those matching the flags", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		title := fs.String("title", "", "title contains")
+		status := fs.String("status", "", "status: new, inprogress or done")
+		priority := fs.String("priority", "", "priority: low, medium or high")
+		assignee := fs.Int("assignee", 0, "assigned user ID")
+		project := fs.Int("project", 0, "project ID")
+		return func(c *cli, _ []string) error {
+			query := url.Values{}
+			for key, value := range map[string]string{"title": *title, "status": *status, "priority": *priority} {
+				if value != "" {
+					query.Set(key, value)
+				}
+			}
+			if *assignee != 0 {
+				query.Set("respId", strconv.Itoa(*assignee))
+			}
+			if *project != 0 {
+				query.Set("projectId", strconv.Itoa(*project))
+			}
+			path := "/tasks"
+			if len(query) > 0 {
+				path = "/tasks/search"
+			}
+			v, err := c.get(path, query)
+			if err != nil {
+				return err
+			}
+			return c.print(v, taskColumns)
+		}
+	}}
+}
+
+// create returns a command creating a resource from the fields' flags and
+// printing it. The API answers with the new resource's ID, so the resource
+// is fetched from showPath.
+func create(noun, path, showPath string, fields []field, cols []column, required ...string) *command {
+	return &command{name: "create", summary: "Create a " + noun, run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		ff := defineFields(fs, fields, true)
+		return func(c *cli, _ []string) error {
+			body, err := ff.body(false, required...)
+			if err != nil {
+				return err
+			}
+			v, err := c.send("POST", path, "", body)
+			if err != nil {
+				return err
+			}
+			id, err := createdID(v)
+			if err != nil {
+				return err
+			}
+			if v, err = c.get(showPath+id, nil); err != nil {
+				return err
+			}
+			return c.print(v, cols)
+		}
+	}}
+}
+
+// update returns a command changing the fields given as flags with a merge
+// patch.
+func update(noun, path string, fields []field, cols []column) *command {
+	return &command{name: "update", args: "ID", summary: "Change the given fields of a " + noun, run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		ff := defineFields(fs, fields, false)
+		return func(c *cli, args []string) error {
+			patch, err := ff.body(true)
+			if err != nil {
+				return err
+			}
+			if len(patch) == 0 {
+				return fmt.Errorf("nothing to change: give the fields to change as flags")
+			}
+			v, err := c.send("PATCH", expand(path, args), "application/merge-patch+json", patch)
+			if err != nil {
+				return err
+			}
+			return c.print(v, cols)
+		}
+	}}
+}
+
+// search returns a command searching the given type of resource by text.
+func search(types string, cols []column) *command {
+	return &command{name: "search", args: "QUERY...", summary: "Search " + types + " by the words of their title and description", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		limit := fs.Int("limit", 0, "maximum number of results")
+		return func(c *cli, args []string) error {
+			query := url.Values{"q": {strings.Join(args, " ")}, "types": {types}}
+			if *limit > 0 {
+				query.Set("limit", strconv.Itoa(*limit))
+			}
+			v, err := c.get("/search", query)
+			if err != nil {
+				return err
+			}
+			if c.opts.Output == "table" {
+				m, _ := v.(map[string]any)
+				v = m[types]
+				if v == nil {
+					v = []any{}
+				}
+			}
+			return c.print(v, hitColumns)
+		}
+	}}
+}
+
+func bulkTasks() *command {
+	return &command{name: "bulk", args: "OPERATION ID...", summary: "Apply set_status, set_priority, reassign, move or delete to several tasks", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		status := fs.String("status", "", "new status, for set_status")
+		priority := fs.String("priority", "", "new priority, for set_priority")
+		assignee := fs.Int("assignee", 0, "new assignee, for reassign")
+		project := fs.Int("project", 0, "new project, for move")
+		dryRun := fs.Bool("dry-run", false, "only report what would change")
+		return func(c *cli, args []string) error {
+			ids := make([]int, len(args)-1)
+			for i, arg := range args[1:] {
+				id, err := strconv.Atoi(arg)
+				if err != nil {
+					return fmt.Errorf("%q is not a task ID", arg)
+				}
+				ids[i] = id
+			}
+			v, err := c.send("POST", "/tasks/bulk", "", map[string]any{
+				"operation": args[0], "ids": ids, "dryRun": *dryRun,
+				"status": *status, "priority": *priority, "respId": *assignee, "projectId": *project,
+			})
+			if err != nil {
+				return err
+			}
+			if c.opts.Output == "table" {
+				m, _ := v.(map[string]any)
+				v = m["results"]
+			}
+			return c.print(v, bulkColumns)
+		}
+	}}
+}
+
+func setMember() *command {
+	return &command{name: "set-member", args: "ID USER", summary: "Add a user to a project or change their role", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		role := fs.String("role", "contributor", "role: owner, maintainer, contributor or viewer")
+		return func(c *cli, args []string) error {
+			v, err := c.send("PUT", expand("/projects/{}/members/{}", args), "", map[string]string{"role": *role})
+			if err != nil {
+				return err
+			}
+			return c.print(v, memberColumns)
+		}
+	}}
+}
+
+func searchProjects() *command {
+	return &command{name: "search", summary: "Find projects by title or manager", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		title := fs.String("title", "", "title contains")
+		manager := fs.Int("manager", 0, "ID of the managing user")
+		return func(c *cli, _ []string) error {
+			var v any
+			var err error
+			switch {
+			case *title != "":
+				v, err = c.get("/projects/search/title", url.Values{"title": {*title}})
+			case *manager != 0:
+				v, err = c.get("/projects/search/manager", url.Values{"managerId": {strconv.Itoa(*manager)}})
+			default:
+				return fmt.Errorf("-title or -manager is required")
+			}
+			if err != nil {
+				return err
+			}
+			return c.print(v, projectColumns)
+		}
+	}}
+}
+
+func searchUsers() *command {
+	return &command{name: "search", summary: "Find users by name or email address", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		name := fs.String("name", "", "name contains")
+		email := fs.String("email", "", "email address contains")
+		return func(c *cli, _ []string) error {
+			query := url.Values{}
+			switch {
+			case *email != "":
+				query.Set("email", *email)
+			case *name != "":
+				query.Set("name", *name)
+			default:
+				return fmt.Errorf("-name or -email is required")
+			}
+			v, err := c.get("/users/search", query)
+			if err != nil {
+				return err
+			}
+			return c.print(v, userColumns)
+		}
+	}}
+}
+
+func setOrgRole() *command {
+	return &command{name: "set-org-role", args: "ID ROLE", summary: "Make a user an admin or member of the organization", run: func(*flag.FlagSet) func(*cli, []string) error {
+		return func(c *cli, args []string) error {
+			if _, err := c.send("PUT", expand("/users/{}/org-role", args[:1]), "", map[string]string{"orgRole": args[1]}); err != nil {
+				return err
+			}
+			return c.done("User %s is now an organization %s.", args[0], args[1])
+		}
+	}}
+}
+
+func setPreferences() *command {
+	return &command{name: "set-preferences", args: "ID", summary: "Choose how a user is emailed", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		email := fs.String("email", "immediate", "immediate, digest or off")
+		return func(c *cli, args []string) error {
+			v, err := c.send("PUT", expand("/users/{}/notification-preferences", args), "", map[string]string{"email": *email})
+			if err != nil {
+				return err
+			}
+			return c.print(v, preferenceColumns)
+		}
+	}}
+}
+
+func renameOrganization() *command {
+	return &command{name: "rename", args: "NAME", summary: "Rename the organization", run: func(*flag.FlagSet) func(*cli, []string) error {
+		return func(c *cli, args []string) error {
+			v, err := c.send("PUT", "/organization", "", map[string]string{"name": args[0]})
+			if err != nil {
+				return err
+			}
+			return c.print(v, organizationColumns)
+		}
+	}}
+}
+
+func createOrganization() *command {
+	return &command{name: "create", args: "NAME", summary: "Create an organization with its first admin, whose ID the later commands use", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		admin := defineFields(fs, []field{
+			{"admin-name", "name", text, "name of the admin", ""},
+			{"admin-email", "email", text, "email address of the admin", ""},
+			{"admin-role", "role", text, "job role of the admin", "manager"},
+		}, true)
+		return func(c *cli, args []string) error {
+			body, err := admin.body(false, "admin-name", "admin-email")
+			if err != nil {
+				return err
+			}
+			v, err := c.send("POST", "/organizations", "", map[string]any{"name": args[0], "admin": body})
+			if err != nil {
+				return err
+			}
+			return c.print(v, columns("ID", "id", "ADMIN", "adminId"))
+		}
+	}}
+}
+
+func listOccurrences() *command {
+	return &command{name: "occurrences", args: "ID", summary: "List the next occurrences of a recurring task", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		from := fs.String("from", "", "list from this date or RFC 3339 time instead of now")
+		limit := fs.Int("limit", 0, "maximum number of occurrences (default 10)")
+		return func(c *cli, args []string) error {
+			query := url.Values{}
+			if *from != "" {
+				t, err := parseTime(*from)
+				if err != nil {
+					return fmt.Errorf("-from: %w", err)
+				}
+				query.Set("from", t.Format(time.RFC3339))
+			}
+			if *limit > 0 {
+				query.Set("limit", strconv.Itoa(*limit))
+			}
+			v, err := c.get(expand("/recurring-tasks/{}/occurrences", args), query)
+			if err != nil {
+				return err
+			}
+			return c.print(v, occurrenceColumns)
+		}
+	}}
+}
+
+func editOccurrence() *command {
+	return &command{name: "edit-occurrence", args: "ID OCCURRENCE", summary: "Change the task of one occurrence; fields not given are taken from the recurring task", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		// The project is the recurring task's, and the due date has its own default.
+		ff := defineFields(fs, taskFields[:5], false)
+		due := fs.String("due", "", "due date, as 2006-01-02 or an RFC 3339 time (default the occurrence)")
+		return func(c *cli, args []string) error {
+			body, err := ff.body(true)
+			if err != nil {
+				return err
+			}
+			if *due != "" {
+				t, err := parseTime(*due)
+				if err != nil {
+					return fmt.Errorf("-due: %w", err)
+				}
+				body["completionDate"] = t.Format(time.RFC3339)
+			}
+			v, err := c.send("PUT", expand("/recurring-tasks/{}/occurrences/{}", args), "", body)
+			if err != nil {
+				return err
+			}
+			return c.print(v, taskColumns)
+		}
+	}}
+}
+
+func createFilter() *command {
+	return &command{name: "create", args: "NAME", summary: "Save a task filter", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		criteria := defineFields(fs, criteriaFields, false)
+		project := fs.Int("share", 0, "ID of a project whose members may use the filter")
+		return func(c *cli, args []string) error {
+			body, err := criteria.body(false)
+			if err != nil {
+				return err
+			}
+			filter := map[string]any{"name": args[0], "criteria": body}
+			if *project != 0 {
+				filter["projectId"] = *project
+			}
+			v, err := c.send("POST", "/filters", "", filter)
+			if err != nil {
+				return err
+			}
+			id, err := createdID(v)
+			if err != nil {
+				return err
+			}
+			if v, err = c.get("/filters/"+id, nil); err != nil {
+				return err
+			}
+			return c.print(v, filterColumns)
+		}
+	}}
+}
+
+func listNotifications() *command {
+	return &command{name: "list", summary: "List your notifications", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		unread := fs.Bool("unread", false, "only unread notifications")
+		return func(c *cli, _ []string) error {
+			query := url.Values{}
+			if *unread {
+				query.Set("unread", "true")
+			}
+			v, err := c.get("/notifications", query)
+			if err != nil {
+				return err
+			}
+			return c.print(v, notificationColumns)
+		}
+	}}
+}
+
+func markRead() *command {
+	return &command{name: "read", args: "ID", summary: "Mark a notification as read", run: func(*flag.FlagSet) func(*cli, []string) error {
+		return func(c *cli, args []string) error {
+			if _, err := c.send("POST", expand("/notifications/{}/read", args), "", nil); err != nil {
+				return err
+			}
+			return c.done("Marked notification %s as read.", args[0])
+		}
+	}}
+}
+
+func searchAll() *command {
+	return &command{name: "search", args: "QUERY...", summary: "Search tasks and projects by text", run: func(fs *flag.FlagSet) func(*cli, []string) error {
+		types := fs.String("types", "", "comma-separated types to search: tasks, projects (default all)")
+		lang := fs.String("lang", "", "text search language, e.g. english or simple")
+		limit := fs.Int("limit", 0, "maximum number of results per type")
+		return func(c *cli, args []string) error {
+			query := url.Values{"q": {strings.Join(args, " ")}}
+			if *types != "" {
+				query.Set("types", *types)
+			}
+			if *lang != "" {
+				query.Set("lang", *lang)
+			}
+			if *limit > 0 {
+				query.Set("limit", strconv.Itoa(*limit))
+			}
+			v, err := c.get("/search", query)
+			if err != nil {
+				return err
+			}
+			return c.printSections(v, []section{
+				{"Tasks", "tasks", hitColumns},
+				{"Projects", "projects", hitColumns},
+			})
+		}
+	}}
+}
+
+func trash() *command {
+	return &command{name: "trash", summary: "List the deleted users, projects and tasks", run: func(*flag.FlagSet) func(*cli, []string) error {
+		return func(c *cli, _ []string) error {
+			v, err := c.get("/trash", nil)
+			if err != nil {
+				return err
+			}
+			return c.printSections(v, []section{
+				{"Users", "users", userColumns},
+				{"Projects", "projects", projectColumns},
+				{"Tasks", "tasks", taskColumns},
+			})
+		}
+	}}
+}
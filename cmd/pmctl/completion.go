@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// completeCommand is the hidden command the completion scripts run to get
+// the candidates for the word being completed, given the words before it.
+const completeCommand = "__complete"
+
+var completionScripts = map[string]string{
+	"bash": `_pmctl() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	COMPREPLY=($(compgen -W "$(pmctl __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}")" -- "$cur"))
+}
+complete -F _pmctl pmctl
+`,
+	"zsh": `#compdef pmctl
+_pmctl() {
+	local -a candidates
+	candidates=(${(f)"$(pmctl __complete ${words[2,CURRENT-1]})"})
+	compadd -a candidates
+}
+compdef _pmctl pmctl
+`,
+	"fish": `complete -c pmctl -f -a '(pmctl __complete (commandline -opc)[2..-1])'
+`,
+}
+
+func completion() *command {
+	return &command{name: "completion", args: "SHELL", summary: "Print the completion script for bash, zsh or fish, e.g. source <(pmctl completion bash)", run: func(*flag.FlagSet) func(*cli, []string) error {
+		return func(c *cli, args []string) error {
+			script, ok := completionScripts[args[0]]
+			if !ok {
+				return fmt.Errorf("no completion for %q: choose bash, zsh or fish", args[0])
+			}
+			_, err := io.WriteString(c.out, script)
+			return err
+		}
+	}}
+}
+
+// complete writes the candidates for the word following words, one per
+// line: the subcommands of the command words name, or its flags.
+func complete(w io.Writer, words []string) {
+	cmd := root
+	for _, word := range words {
+		if sub := cmd.subcommand(word); sub != nil {
+			cmd = sub
+		}
+	}
+	if n := len(words); n > 0 {
+		switch strings.TrimLeft(words[n-1], "-") {
+		case "o", "output":
+			fmt.Fprintln(w, "table\njson\nyaml")
+			return
+		}
+	}
+	if cmd.name == "completion" {
+		fmt.Fprintln(w, "bash\nzsh\nfish")
+		return
+	}
+	for _, sub := range cmd.subcommands {
+		fmt.Fprintln(w, sub.name)
+	}
+	if cmd.run != nil {
+		cmd.flags().VisitAll(func(f *flag.Flag) {
+			fmt.Fprintln(w, "--"+f.Name)
+		})
+	}
+}
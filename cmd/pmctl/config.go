@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// options are the settings every command takes. They are read from the
+// config file, then from PMCTL_* environment variables, then from flags,
+// each overriding the one before.
+type options struct {
+	Server string `yaml:"server"`
+	Token  string `yaml:"token"`
+	User   int    `yaml:"user"`
+	Output string `yaml:"output"`
+
+	config string
+	flags  flagValues
+}
+
+// flagValues holds the values of the flags, which only override the file
+// and the environment when they are given.
+type flagValues struct {
+	server, token, output string
+	user                  int
+}
+
+const (
+	defaultServer = "http://localhost:8080"
+	defaultOutput = "table"
+)
+
+func (o *options) register(set *flag.FlagSet) {
+	set.StringVar(&o.config, "config", "", "config file (default $PMCTL_CONFIG or "+displayPath(defaultConfigPath())+")")
+	set.StringVar(&o.flags.server, "server", "", "API server URL (default "+defaultServer+")")
+	set.StringVar(&o.flags.token, "token", "", "bearer token sent to the server")
+	set.IntVar(&o.flags.user, "user", 0, "ID of the user to act as, sent as X-User-ID")
+	set.StringVar(&o.flags.output, "output", "", "output format: table, json or yaml (default "+defaultOutput+")")
+	set.StringVar(&o.flags.output, "o", "", "shorthand for -output")
+}
+
+// load fills in the options once set is parsed.
+func (o *options) load(set *flag.FlagSet) error {
+	o.Server, o.Output = defaultServer, defaultOutput
+
+	path, explicit := o.config, o.config != ""
+	if !explicit {
+		path, explicit = os.LookupEnv("PMCTL_CONFIG")
+	}
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && !explicit:
+		case err != nil:
+			return fmt.Errorf("reading config: %w", err)
+		default:
+			if err := yaml.Unmarshal(data, o); err != nil {
+				return fmt.Errorf("reading config %s: %w", path, err)
+			}
+		}
+	}
+
+	if v, ok := os.LookupEnv("PMCTL_SERVER"); ok {
+		o.Server = v
+	}
+	if v, ok := os.LookupEnv("PMCTL_TOKEN"); ok {
+		o.Token = v
+	}
+	if v, ok := os.LookupEnv("PMCTL_USER"); ok {
+		user, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("PMCTL_USER: %q is not a user ID", v)
+		}
+		o.User = user
+	}
+	if v, ok := os.LookupEnv("PMCTL_OUTPUT"); ok {
+		o.Output = v
+	}
+
+	set.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "server":
+			o.Server = o.flags.server
+		case "token":
+			o.Token = o.flags.token
+		case "user":
+			o.User = o.flags.user
+		case "output", "o":
+			o.Output = o.flags.output
+		}
+	})
+
+	switch o.Output {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("output must be table, json or yaml, got %q", o.Output)
+	}
+	return nil
+}
+
+// defaultConfigPath returns where the config file is looked for when none
+// is named, e.g. ~/.config/pmctl/config.yaml.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pmctl", "config.yaml")
+}
+
+// displayPath shortens a path in the home directory for help texts.
+func displayPath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && filepath.IsLocal(rel) {
+		return filepath.Join("~", rel)
+	}
+	return path
+}
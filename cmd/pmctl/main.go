@@ -0,0 +1,110 @@
+// Command pmctl is a command-line client for the project API. Its commands
+// mirror the API's routes, e.g.
+//
+//	pmctl tasks list --status inprogress --project 3
+//	pmctl tasks create --title "Write release notes" --project 3 --assignee 7
+//	pmctl projects show 5 -o yaml
+//
+// The server, token and user are read from a config file, the environment
+// or flags; see pmctl help.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pmctl:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command named by args.
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) > 0 && args[0] == completeCommand {
+		complete(stdout, args[1:])
+		return nil
+	}
+
+	cmd, path, args, err := find(args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		fmt.Fprintln(stderr)
+		cmd.usage(stderr, path)
+		return errors.New("invalid command")
+	}
+	if cmd.run == nil {
+		cmd.usage(stdout, path)
+		return flag.ErrHelp
+	}
+
+	fs := flag.NewFlagSet("pmctl "+strings.Join(path, " "), flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { cmd.usage(stderr, path) }
+	var opts options
+	opts.register(fs)
+	runCmd := cmd.run(fs)
+	positional, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := cmd.checkArgs(positional); err != nil {
+		fmt.Fprintln(stderr, err)
+		fmt.Fprintln(stderr)
+		cmd.usage(stderr, path)
+		return errors.New("invalid arguments")
+	}
+	if err := opts.load(fs); err != nil {
+		return err
+	}
+	return runCmd(newCLI(opts, stdout), positional)
+}
+
+// find walks the command tree along args and returns the command they name,
+// the names leading to it and the arguments after them.
+func find(args []string) (*command, []string, []string, error) {
+	cmd := root
+	var path []string
+	for len(args) > 0 && cmd.subcommands != nil {
+		name := args[0]
+		if name == "help" || name == "-h" || name == "--help" {
+			return cmd, path, nil, nil
+		}
+		sub := cmd.subcommand(name)
+		if sub == nil {
+			return cmd, path, nil, fmt.Errorf("unknown command %q", strings.Join(append(path, name), " "))
+		}
+		cmd, path, args = sub, append(path, name), args[1:]
+	}
+	return cmd, path, args, nil
+}
+
+// parse parses the flags in args, which unlike with fs.Parse may follow the
+// positional arguments, and returns the positional arguments.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
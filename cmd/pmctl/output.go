@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// column is a column of a table: its heading and the JSON field it shows.
+type column struct {
+	heading, field string
+}
+
+func columns(pairs ...string) []column {
+	cols := make([]column, len(pairs)/2)
+	for i := range cols {
+		cols[i] = column{pairs[2*i], pairs[2*i+1]}
+	}
+	return cols
+}
+
+// section is a list inside a response object, such as the tasks of the
+// trash, shown as a table of its own.
+type section struct {
+	title, field string
+	cols         []column
+}
+
+// print writes v, a decoded JSON response, in the chosen output format. In a
+// table a list has a row per item and an object a row per column.
+func (c *cli) print(v any, cols []column) error {
+	switch c.opts.Output {
+	case "json":
+		return c.printJSON(v)
+	case "yaml":
+		return c.printYAML(v)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	switch v := v.(type) {
+	case []any:
+		if len(v) == 0 {
+			fmt.Fprintln(c.out, "No results.")
+			return nil
+		}
+		headings := make([]string, len(cols))
+		for i, col := range cols {
+			headings[i] = col.heading
+		}
+		fmt.Fprintln(w, strings.Join(headings, "\t"))
+		for _, item := range v {
+			m, _ := item.(map[string]any)
+			cells := make([]string, len(cols))
+			for i, col := range cols {
+				cells[i] = cell(m[col.field])
+			}
+			fmt.Fprintln(w, strings.Join(cells, "\t"))
+		}
+	case map[string]any:
+		for _, col := range cols {
+			fmt.Fprintf(w, "%s\t%s\n", col.heading, cell(v[col.field]))
+		}
+	default:
+		fmt.Fprintln(w, cell(v))
+	}
+	return w.Flush()
+}
+
+// printSections writes an object holding several lists, in a table as one
+// table per list.
+func (c *cli) printSections(v any, sections []section) error {
+	if c.opts.Output != "table" {
+		return c.print(v, nil)
+	}
+	m, _ := v.(map[string]any)
+	for i, s := range sections {
+		items, _ := m[s.field].([]any)
+		if i > 0 {
+			fmt.Fprintln(c.out)
+		}
+		fmt.Fprintf(c.out, "%s:\n", s.title)
+		if err := c.print(items, s.cols); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// done reports the outcome of a request that has no response body. Only
+// tables get a message, so that JSON and YAML output stays parseable.
+func (c *cli) done(format string, args ...any) error {
+	if c.opts.Output == "table" {
+		fmt.Fprintf(c.out, format+"\n", args...)
+	}
+	return nil
+}
+
+func (c *cli) printJSON(v any) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (c *cli) printYAML(v any) error {
+	enc := yaml.NewEncoder(c.out)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// cell formats a JSON value for a table: times to the minute, and objects
+// and lists as compact JSON.
+func cell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.Format("2006-01-02 15:04")
+		}
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
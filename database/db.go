@@ -1,35 +1,93 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/allwsaa/project-api/internal/config"
+	"github.com/allwsaa/project-api/internal/dialect"
+	"github.com/allwsaa/project-api/internal/tracing"
+	"github.com/lib/pq"
 )
 
 var datab *sql.DB
 
-func SetupDB() {
-	var err error
-
-	connectionString := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), os.Getenv("POSTGRES_USER"),
-		os.Getenv("POSTGRES_PASSWORD"), os.Getenv("POSTGRES_DB"))
-	datab, err = sql.Open("postgres", connectionString)
+// SetupDB opens the database for GetDB.
+func SetupDB(cfg config.Database) error {
+	db, err := Open(cfg)
 	if err != nil {
-		log.Fatal("Error opening database connection: ", err)
+		return err
 	}
+	datab = db
+	return nil
+}
 
-	err = datab.Ping()
-	if err != nil {
-		log.Fatal("Error pinging database: ", err)
+func GetDB() *sql.DB {
+	return datab
+}
+
+// Open connects to the database, sizes its connection pool and applies the
+// migrations it is missing.
+func Open(cfg config.Database) (*sql.DB, error) {
+	var connector driver.Connector
+	switch cfg.Driver {
+	case "sqlite":
+		connector = tracing.WrapConnector(dialect.SQLiteConnector(cfg.Path), "sqlite")
+	default:
+		c, err := pq.NewConnector(connectionString(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("opening database connection: %w", err)
+		}
+		connector = tracing.WrapConnector(c, "postgresql")
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("pinging database: %w", err)
 	}
 
-	log.Println("Database connected successfully")
+	slog.Info("Database connected successfully", "driver", cfg.Driver)
+
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("applying migrations: %w", err)
+	}
+	return db, nil
 }
 
-func GetDB() *sql.DB {
-	return datab
+// connectionString returns the libpq connection string for cfg. Statements
+// running longer than the statement timeout are cancelled by the server.
+func connectionString(cfg config.Database) string {
+	params := []struct{ key, value string }{
+		{"host", cfg.Host},
+		{"port", fmt.Sprint(cfg.Port)},
+		{"user", cfg.User},
+		{"password", cfg.Password},
+		{"dbname", cfg.Name},
+		{"sslmode", cfg.SSLMode},
+		{"connect_timeout", fmt.Sprint(int(cfg.ConnectTimeout.Seconds()))},
+		{"statement_timeout", fmt.Sprint(cfg.StatementTimeout.Milliseconds())},
+	}
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.key + "=" + quote(p.value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// quote quotes a value of a connection string, which may contain spaces or
+// quotes, such as a password.
+func quote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
 }
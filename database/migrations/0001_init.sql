@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    registrationDate TIMESTAMPTZ NOT NULL DEFAULT now(),
+    role TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS projects (
+    id SERIAL PRIMARY KEY,
+    projectTitle TEXT NOT NULL,
+    projectDescription TEXT NOT NULL DEFAULT '',
+    started TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completed TIMESTAMPTZ NOT NULL,
+    managerId INT NOT NULL REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS tasks (
+    id SERIAL PRIMARY KEY,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    priority TEXT NOT NULL,
+    status TEXT NOT NULL,
+    respId INT NOT NULL REFERENCES users(id),
+    projectId INT NOT NULL REFERENCES projects(id),
+    creationDate TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completionDate TIMESTAMPTZ NOT NULL
+);
+
+-- Tables created before there were migrations have these columns without a
+-- time zone, which drops the offset of times written in any zone but UTC.
+-- Their values are taken to be in UTC, which is what the API meant to store.
+ALTER TABLE users ALTER COLUMN registrationDate TYPE TIMESTAMPTZ USING registrationDate AT TIME ZONE 'UTC';
+ALTER TABLE projects ALTER COLUMN started TYPE TIMESTAMPTZ USING started AT TIME ZONE 'UTC';
+ALTER TABLE projects ALTER COLUMN completed TYPE TIMESTAMPTZ USING completed AT TIME ZONE 'UTC';
+ALTER TABLE tasks ALTER COLUMN creationDate TYPE TIMESTAMPTZ USING creationDate AT TIME ZONE 'UTC';
+ALTER TABLE tasks ALTER COLUMN completionDate TYPE TIMESTAMPTZ USING completionDate AT TIME ZONE 'UTC';
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ, ADD COLUMN deleted_by INT;
+ALTER TABLE projects ADD COLUMN deleted_at TIMESTAMPTZ, ADD COLUMN deleted_by INT;
+ALTER TABLE tasks ADD COLUMN deleted_at TIMESTAMPTZ, ADD COLUMN deleted_by INT;
+
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX projects_deleted_at_idx ON projects (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX tasks_deleted_at_idx ON tasks (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,14 @@
+-- Full-text search vectors. They are built with the 'english' configuration;
+-- searches in other languages compute the vector on the fly instead.
+ALTER TABLE tasks ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B')
+) STORED;
+
+ALTER TABLE projects ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(projectTitle, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(projectDescription, '')), 'B')
+) STORED;
+
+CREATE INDEX tasks_search_idx ON tasks USING GIN (search_vector);
+CREATE INDEX projects_search_idx ON projects USING GIN (search_vector);
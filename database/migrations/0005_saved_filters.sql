@@ -0,0 +1,11 @@
+CREATE TABLE saved_filters (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    owner_id INT NOT NULL REFERENCES users(id),
+    project_id INT REFERENCES projects(id),
+    criteria JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (owner_id, name)
+);
+
+CREATE INDEX saved_filters_project_id_idx ON saved_filters (project_id) WHERE project_id IS NOT NULL;
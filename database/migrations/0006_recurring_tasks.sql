@@ -0,0 +1,27 @@
+CREATE TABLE recurring_tasks (
+    id SERIAL PRIMARY KEY,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    priority TEXT NOT NULL,
+    respId INT NOT NULL REFERENCES users(id),
+    projectId INT NOT NULL REFERENCES projects(id),
+    rrule TEXT NOT NULL,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    starts_at TIMESTAMPTZ NOT NULL,
+    next_occurrence TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX recurring_tasks_next_occurrence_idx ON recurring_tasks (next_occurrence) WHERE next_occurrence IS NOT NULL;
+
+CREATE TABLE recurrence_exceptions (
+    recurring_task_id INT NOT NULL REFERENCES recurring_tasks(id) ON DELETE CASCADE,
+    occurrence TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (recurring_task_id, occurrence)
+);
+
+ALTER TABLE tasks
+    ADD COLUMN recurring_task_id INT REFERENCES recurring_tasks(id) ON DELETE SET NULL,
+    ADD COLUMN occurrence TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX tasks_recurring_occurrence_idx ON tasks (recurring_task_id, occurrence);
@@ -0,0 +1,14 @@
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    threshold TEXT NOT NULL,
+    due_at TIMESTAMPTZ NOT NULL,
+    message TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    read_at TIMESTAMPTZ,
+    UNIQUE (task_id, user_id, kind, threshold, due_at)
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at DESC);
@@ -0,0 +1,20 @@
+CREATE TABLE project_members (
+    project_id INT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (project_id, user_id)
+);
+
+CREATE INDEX project_members_user_id_idx ON project_members (user_id);
+
+-- Existing managers own their projects and existing assignees keep working
+-- on their tasks.
+INSERT INTO project_members (project_id, user_id, role)
+SELECT id, managerId, 'owner' FROM projects;
+
+INSERT INTO project_members (project_id, user_id, role)
+SELECT DISTINCT projectId, respId, 'contributor' FROM tasks
+UNION
+SELECT DISTINCT projectId, respId, 'contributor' FROM recurring_tasks
+ON CONFLICT DO NOTHING;
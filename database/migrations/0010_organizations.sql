@@ -0,0 +1,25 @@
+CREATE TABLE organizations (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE users ADD COLUMN org_id INT REFERENCES organizations(id), ADD COLUMN org_role TEXT NOT NULL DEFAULT 'member';
+ALTER TABLE projects ADD COLUMN org_id INT REFERENCES organizations(id);
+
+-- Existing users and projects move into a single organization, administered
+-- by the oldest user.
+INSERT INTO organizations (name) SELECT 'Default' WHERE EXISTS (SELECT 1 FROM users);
+UPDATE users SET org_id = (SELECT min(id) FROM organizations);
+UPDATE projects SET org_id = (SELECT min(id) FROM organizations);
+UPDATE users SET org_role = 'admin' WHERE id = (SELECT min(id) FROM users WHERE deleted_at IS NULL);
+
+ALTER TABLE users ALTER COLUMN org_id SET NOT NULL;
+ALTER TABLE projects ALTER COLUMN org_id SET NOT NULL;
+
+-- An email is unique within an organization rather than across all of them.
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+ALTER TABLE users ADD CONSTRAINT users_org_id_email_key UNIQUE (org_id, email);
+
+CREATE INDEX users_org_id_idx ON users (org_id);
+CREATE INDEX projects_org_id_idx ON projects (org_id);
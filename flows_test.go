@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/allwsaa/project-api/internal/handlers"
+	"github.com/allwsaa/project-api/internal/models"
+)
+
+// The tests in this file follow a resource through several requests and
+// check the bodies of the responses, not only their status.
+
+func TestTaskLifecycle(t *testing.T) {
+	api := newTestAPI(t)
+	seed(t, api)
+	path := fmt.Sprintf("/tasks/%d", taskID)
+
+	res := api.mustDo(http.StatusOK, http.MethodGet, path, memberID, nil)
+	var task models.Task
+	res.decode(t, &task)
+	if task.Title != "Write release notes" || task.Status != "new" || task.Version != 1 {
+		t.Fatalf("GET %s = %+v", path, task)
+	}
+	etag := res.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("GET of a task set no ETag")
+	}
+
+	res = api.mustDo(http.StatusOK, http.MethodPatch, path, memberID, `{"status":"done"}`,
+		"Content-Type", "application/merge-patch+json", "If-Match", etag)
+	res.decode(t, &task)
+	if task.Status != "done" || task.Version != 2 {
+		t.Fatalf("PATCH %s = %+v", path, task)
+	}
+	// The ETag the task was fetched with no longer matches.
+	api.mustDo(http.StatusPreconditionFailed, http.MethodPatch, path, memberID, `{"status":"new"}`,
+		"Content-Type", "application/merge-patch+json", "If-Match", etag)
+
+	api.mustDo(http.StatusNoContent, http.MethodDelete, path, adminID, nil)
+	api.mustDo(http.StatusNotFound, http.MethodGet, path, adminID, nil)
+
+	var trash handlers.Trash
+	api.mustDo(http.StatusOK, http.MethodGet, "/trash", adminID, nil).decode(t, &trash)
+	if len(trash.Tasks) != 2 {
+		t.Errorf("trash holds %d tasks, want 2", len(trash.Tasks))
+	}
+
+	api.mustDo(http.StatusOK, http.MethodPost, path+"/restore", adminID, nil).decode(t, &task)
+	if task.ID != taskID || task.DeletedAt != nil {
+		t.Errorf("restored task = %+v", task)
+	}
+}
+
+// TestTrashedReferences checks that nothing new can refer to a project or
+// user in the trash.
+func TestTrashedReferences(t *testing.T) {
+	api := newTestAPI(t)
+	seed(t, api)
+
+	api.mustDo(http.StatusNoContent, http.MethodDelete, fmt.Sprintf("/users/%d", memberID), adminID, nil)
+	api.mustDo(http.StatusUnprocessableEntity, http.MethodPost, "/tasks", adminID, validTask).problem(t, http.StatusUnprocessableEntity)
+
+	api.mustDo(http.StatusOK, http.MethodDelete, fmt.Sprintf("/projects/%d", projectID), adminID, nil)
+	api.mustDo(http.StatusUnprocessableEntity, http.MethodPost, "/tasks", adminID, with(validTask, "respId", adminID)).problem(t, http.StatusUnprocessableEntity)
+}
+
+// TestOrganizationIsolation checks that lists only show the caller's
+// organization.
+func TestOrganizationIsolation(t *testing.T) {
+	api := newTestAPI(t)
+	seed(t, api)
+
+	var tasks []models.Task
+	api.mustDo(http.StatusOK, http.MethodGet, "/tasks", adminID, nil).decode(t, &tasks)
+	for _, task := range tasks {
+		if task.ID == otherTaskID {
+			t.Errorf("GET /tasks as %d lists task %d of another organization", adminID, otherTaskID)
+		}
+	}
+	var users []models.User
+	api.mustDo(http.StatusOK, http.MethodGet, "/users", otherAdminID, nil).decode(t, &users)
+	if len(users) != 1 || users[0].ID != otherAdminID {
+		t.Errorf("GET /users as %d = %+v, want only themselves", otherAdminID, users)
+	}
+	var projects []models.Project
+	api.mustDo(http.StatusOK, http.MethodGet, "/projects/search/title?title=secret", adminID, nil).decode(t, &projects)
+	if len(projects) != 0 {
+		t.Errorf("project search as %d found %+v of another organization", adminID, projects)
+	}
+}
+
+// TestProjectRoles checks what the members of a project who may not edit its
+// tasks get from the requests that are answered 200 either way.
+func TestProjectRoles(t *testing.T) {
+	api := newTestAPI(t)
+	seed(t, api)
+
+	for _, body := range []map[string]any{
+		{"operation": "set_status", "status": "done", "ids": []int{taskID}},
+		{"operation": "set_status", "status": "done", "filter": map[string]any{"projectId": projectID}},
+	} {
+		var bulk handlers.BulkTaskResponse
+		api.mustDo(http.StatusOK, http.MethodPost, "/tasks/bulk", viewerID, body).decode(t, &bulk)
+		if len(bulk.Results) != 1 || bulk.Results[0].Result != "forbidden" {
+			t.Errorf("bulk update %v as viewer = %+v, want task %d forbidden", body, bulk.Results, taskID)
+		}
+	}
+	var task models.Task
+	api.mustDo(http.StatusOK, http.MethodGet, fmt.Sprintf("/tasks/%d", taskID), viewerID, nil).decode(t, &task)
+	if task.Status != "new" {
+		t.Errorf("task status = %q after the viewer's bulk update, want new", task.Status)
+	}
+
+	var trash handlers.Trash
+	api.mustDo(http.StatusOK, http.MethodGet, "/trash", viewerID, nil).decode(t, &trash)
+	if len(trash.Tasks) != 1 || trash.Tasks[0].ID != trashedTaskID {
+		t.Errorf("trash of viewer holds %+v, want task %d", trash.Tasks, trashedTaskID)
+	}
+	trash = handlers.Trash{}
+	api.mustDo(http.StatusNoContent, http.MethodDelete, fmt.Sprintf("/users/%d", memberID), adminID, nil)
+	api.mustDo(http.StatusOK, http.MethodGet, "/trash", outsiderID, nil).decode(t, &trash)
+	if len(trash.Users)+len(trash.Projects)+len(trash.Tasks) != 0 {
+		t.Errorf("trash of non-member = %+v, want it empty", trash)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	api := newTestAPI(t)
+	seed(t, api)
+
+	var results handlers.SearchResults
+	api.mustDo(http.StatusOK, http.MethodGet, "/search?q=release+no&types=tasks", memberID, nil).decode(t, &results)
+	if len(results.Tasks) != 1 || results.Tasks[0].ID != taskID {
+		t.Fatalf("search hits = %+v, want task %d", results.Tasks, taskID)
+	}
+	if want := "Write <mark>release</mark> <mark>notes</mark>"; !strings.HasPrefix(results.Tasks[0].Snippet, want) {
+		t.Errorf("snippet = %q, want it to start with %q", results.Tasks[0].Snippet, want)
+	}
+}
+
+func TestIdempotentRetry(t *testing.T) {
+	api := newTestAPI(t)
+	seed(t, api)
+	body := map[string]any{
+		"title": "Book a venue", "priority": "medium", "status": "new",
+		"respId": memberID, "projectId": projectID, "completionDate": "2030-01-01T00:00:00Z",
+	}
+
+	first := api.mustDo(http.StatusCreated, http.MethodPost, "/tasks", adminID, body, "Idempotency-Key", "venue-1")
+	retry := api.mustDo(http.StatusCreated, http.MethodPost, "/tasks", adminID, body, "Idempotency-Key", "venue-1")
+	if string(retry.Body) != string(first.Body) || retry.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry = %s (replayed %q), want the first response %s replayed",
+			retry.Body, retry.Header.Get("Idempotent-Replayed"), first.Body)
+	}
+	api.mustDo(http.StatusConflict, http.MethodPost, "/tasks", adminID, with(body, "title", "Other"), "Idempotency-Key", "venue-1")
+}
+
+// TestMetrics checks that the pool statistics name the database in use.
+func TestMetrics(t *testing.T) {
+	api := newTestAPI(t)
+	res := api.mustDo(http.StatusOK, http.MethodGet, "/metrics", 0, nil)
+	if !strings.Contains(string(res.Body), `go_sql_open_connections{db_name="sqlite"}`) {
+		t.Errorf("GET /metrics has no pool statistics for sqlite:\n%s", res.Body)
+	}
+}
@@ -0,0 +1,94 @@
+// Package apperr classifies the errors the API reports to its clients. The
+// repositories and handlers return an *Error to say what went wrong in terms a
+// client can act on; every other error is internal, and its details are only
+// logged.
+package apperr
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Kind is what went wrong, from the client's point of view. Each kind is
+// answered with one HTTP status.
+type Kind int
+
+const (
+	// Internal is a failure of the server, such as a database error.
+	Internal Kind = iota
+	// Validation is a malformed or invalid request.
+	Validation
+	// Unauthorized is a request without a known caller.
+	Unauthorized
+	// Forbidden is a request the caller is not allowed to make.
+	Forbidden
+	// NotFound is a request for a resource that does not exist or that the
+	// caller cannot see.
+	NotFound
+	// Conflict is a request that conflicts with the state of a resource,
+	// such as removing the last owner of a project.
+	Conflict
+	// PreconditionFailed is a conditional write of a resource that has
+	// changed since the version it was based on.
+	PreconditionFailed
+	// Unprocessable is a valid request referring to another resource that
+	// does not exist, such as a task's project.
+	Unprocessable
+)
+
+var statuses = map[Kind]int{
+	Internal:           http.StatusInternalServerError,
+	Validation:         http.StatusBadRequest,
+	Unauthorized:       http.StatusUnauthorized,
+	Forbidden:          http.StatusForbidden,
+	NotFound:           http.StatusNotFound,
+	Conflict:           http.StatusConflict,
+	PreconditionFailed: http.StatusPreconditionFailed,
+	Unprocessable:      http.StatusUnprocessableEntity,
+}
+
+// Status returns the HTTP status errors of kind k are answered with.
+func (k Kind) Status() int {
+	return statuses[k]
+}
+
+// Error is an error of a known kind with a message for the client.
+type Error struct {
+	Kind Kind
+	// Message explains the error to the client, so it must not reveal
+	// anything about the server, such as SQL.
+	Message string
+	// Err is the underlying error, if any. It is only logged.
+	Err error
+}
+
+// New returns an error of the given kind.
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Wrap returns an error of the given kind caused by err.
+func Wrap(kind Kind, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of the first *Error in err's chain, or Internal if
+// there is none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Internal
+}
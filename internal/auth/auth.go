@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/allwsaa/project-api/internal/problem"
+)
+
+// UserHeader carries the ID of the user making the request. The API sits
+// behind a gateway that authenticates callers and sets this header.
+const UserHeader = "X-User-ID"
+
+type contextKey struct{}
+
+// Middleware stores the caller's user ID from UserHeader in the request
+// context. Requests without the header are anonymous.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(UserHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, err := strconv.Atoi(value)
+		if err != nil || userID <= 0 {
+			problem.Write(w, r, http.StatusBadRequest, "Invalid "+UserHeader+" header")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, userID)))
+	})
+}
+
+// UserID returns the caller's user ID, if the request carried one.
+func UserID(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(contextKey{}).(int)
+	return userID, ok
+}
+
+// UserRef is like UserID but returns nil for anonymous callers, which is
+// convenient for nullable columns such as deleted_by.
+func UserRef(ctx context.Context) *int {
+	if userID, ok := UserID(ctx); ok {
+		return &userID
+	}
+	return nil
+}
+
+type orgKey struct{}
+
+type org struct {
+	id    int
+	admin bool
+}
+
+// WithOrg returns a copy of ctx carrying the caller's organization and
+// whether they are one of its admins.
+func WithOrg(ctx context.Context, orgID int, admin bool) context.Context {
+	return context.WithValue(ctx, orgKey{}, org{id: orgID, admin: admin})
+}
+
+// OrgID returns the caller's organization, or 0 if it is not known.
+func OrgID(ctx context.Context) int {
+	o, _ := ctx.Value(orgKey{}).(org)
+	return o.id
+}
+
+// IsOrgAdmin reports whether the caller is an admin of their organization.
+func IsOrgAdmin(ctx context.Context) bool {
+	o, _ := ctx.Value(orgKey{}).(org)
+	return o.admin
+}
@@ -0,0 +1,214 @@
+// Package config holds the server's settings. Each setting is read from, in
+// order of precedence, a command line flag, an environment variable, a YAML
+// file and finally its default.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/ratelimit"
+)
+
+// Config is the configuration of the server. The env tag of a setting names
+// its environment variable; its YAML key is the same name in lower case, and
+// its flag is that with dashes, e.g. POSTGRES_HOST, postgres_host and
+// -postgres-host. Settings tagged file:"true" can also be read from the file
+// named by the variable with a _FILE suffix, e.g. POSTGRES_PASSWORD_FILE.
+type Config struct {
+	Port int `env:"PORT"`
+
+	ReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `env:"HTTP_IDLE_TIMEOUT"`
+	ShutdownDelay     time.Duration `env:"SHUTDOWN_DELAY"`
+	ShutdownTimeout   time.Duration `env:"SHUTDOWN_TIMEOUT"`
+
+	Database Database
+
+	TrashRetention     time.Duration `env:"TRASH_RETENTION"`
+	TrashPurgeInterval time.Duration `env:"TRASH_PURGE_INTERVAL"`
+	RequireIfMatch     bool          `env:"REQUIRE_IF_MATCH"`
+	SearchLanguage     string        `env:"SEARCH_LANGUAGE"`
+
+	RecurrenceInterval time.Duration   `env:"RECURRENCE_INTERVAL"`
+	ReminderLeadTimes  []time.Duration `env:"REMINDER_LEAD_TIMES"`
+	EscalationGrace    time.Duration   `env:"ESCALATION_GRACE"`
+	ReminderInterval   time.Duration   `env:"REMINDER_INTERVAL"`
+
+	SMTP           SMTP
+	OutboxInterval time.Duration `env:"OUTBOX_INTERVAL"`
+	DigestHour     int           `env:"DIGEST_HOUR"`
+
+	RateLimitBackend string          `env:"RATE_LIMIT_BACKEND"`
+	RateLimitIP      ratelimit.Limit `env:"RATE_LIMIT_IP"`
+	RateLimit        ratelimit.Limit `env:"RATE_LIMIT"`
+	RateLimitWrite   ratelimit.Limit `env:"RATE_LIMIT_WRITE"`
+	RateLimitSearch  ratelimit.Limit `env:"RATE_LIMIT_SEARCH"`
+	TrustProxy       bool            `env:"TRUST_PROXY"`
+
+	IdempotencyWindow time.Duration `env:"IDEMPOTENCY_WINDOW"`
+	MetricsToken      string        `env:"METRICS_TOKEN" file:"true"`
+	HealthToken       string        `env:"HEALTH_TOKEN" file:"true"`
+	HealthTimeout     time.Duration `env:"HEALTH_TIMEOUT"`
+
+	LogLevel  string `env:"LOG_LEVEL"`
+	LogFormat string `env:"LOG_FORMAT"`
+}
+
+// Database is the database connection and its pool. Driver is postgres, or
+// sqlite for an embedded database in the file at Path, which needs no
+// server.
+type Database struct {
+	Driver string `env:"DB_DRIVER"`
+	Path   string `env:"SQLITE_PATH"`
+
+	Host     string `env:"POSTGRES_HOST"`
+	Port     int    `env:"POSTGRES_PORT"`
+	User     string `env:"POSTGRES_USER"`
+	Password string `env:"POSTGRES_PASSWORD" file:"true"`
+	Name     string `env:"POSTGRES_DB"`
+	SSLMode  string `env:"POSTGRES_SSLMODE"`
+
+	MaxOpenConns     int           `env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns     int           `env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime  time.Duration `env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime  time.Duration `env:"DB_CONN_MAX_IDLE_TIME"`
+	ConnectTimeout   time.Duration `env:"DB_CONNECT_TIMEOUT"`
+	StatementTimeout time.Duration `env:"DB_STATEMENT_TIMEOUT"`
+}
+
+// SMTP is the server email is sent through. Email is only logged when Host
+// is empty.
+type SMTP struct {
+	Host     string `env:"SMTP_HOST"`
+	Port     int    `env:"SMTP_PORT"`
+	Username string `env:"SMTP_USERNAME"`
+	Password string `env:"SMTP_PASSWORD" file:"true"`
+	From     string `env:"SMTP_FROM"`
+}
+
+// Default returns the configuration used for settings that are not set.
+func Default() Config {
+	return Config{
+		Port:              8080,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownDelay:     5 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+		HealthTimeout:     2 * time.Second,
+		Database: Database{
+			Driver:           "postgres",
+			Path:             "project-api.db",
+			Port:             5432,
+			SSLMode:          "disable",
+			MaxOpenConns:     25,
+			MaxIdleConns:     25,
+			ConnMaxLifetime:  30 * time.Minute,
+			ConnMaxIdleTime:  5 * time.Minute,
+			ConnectTimeout:   5 * time.Second,
+			StatementTimeout: 30 * time.Second,
+		},
+		TrashRetention:     30 * 24 * time.Hour,
+		TrashPurgeInterval: time.Hour,
+		SearchLanguage:     "english",
+		RecurrenceInterval: time.Minute,
+		ReminderLeadTimes:  []time.Duration{24 * time.Hour, time.Hour},
+		EscalationGrace:    24 * time.Hour,
+		ReminderInterval:   time.Minute,
+		SMTP:               SMTP{Port: 587},
+		OutboxInterval:     30 * time.Second,
+		DigestHour:         8,
+		RateLimitBackend:   "memory",
+		RateLimitIP:        ratelimit.Limit{Requests: 1200, Period: time.Minute},
+		RateLimit:          ratelimit.Limit{Requests: 300, Period: time.Minute},
+		RateLimitWrite:     ratelimit.Limit{Requests: 60, Period: time.Minute},
+		RateLimitSearch:    ratelimit.Limit{Requests: 30, Period: time.Minute},
+		IdempotencyWindow:  24 * time.Hour,
+		LogLevel:           "info",
+		LogFormat:          "json",
+	}
+}
+
+// Validate reports every setting that is missing or out of range.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+	positive := func(d time.Duration, key string) {
+		check(d > 0, key, "must be a positive duration, got %s", d)
+	}
+
+	check(c.Port > 0 && c.Port < 65536, "PORT", "must be a port number, got %d", c.Port)
+	positive(c.ReadHeaderTimeout, "HTTP_READ_HEADER_TIMEOUT")
+	positive(c.ReadTimeout, "HTTP_READ_TIMEOUT")
+	positive(c.WriteTimeout, "HTTP_WRITE_TIMEOUT")
+	positive(c.IdleTimeout, "HTTP_IDLE_TIMEOUT")
+	check(c.ShutdownDelay >= 0, "SHUTDOWN_DELAY", "must not be negative, got %s", c.ShutdownDelay)
+	positive(c.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+
+	db := c.Database
+	switch db.Driver {
+	case "postgres":
+		check(db.Host != "", "POSTGRES_HOST", "is required")
+		check(db.Port > 0 && db.Port < 65536, "POSTGRES_PORT", "must be a port number, got %d", db.Port)
+		check(db.User != "", "POSTGRES_USER", "is required")
+		check(db.Name != "", "POSTGRES_DB", "is required")
+		check(oneOf(db.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"),
+			"POSTGRES_SSLMODE", "must be a libpq sslmode, got %q", db.SSLMode)
+	case "sqlite":
+		check(db.Path != "", "SQLITE_PATH", "is required")
+		check(c.RateLimitBackend != "postgres", "RATE_LIMIT_BACKEND", "cannot be postgres when DB_DRIVER is sqlite")
+	default:
+		check(false, "DB_DRIVER", "must be postgres or sqlite, got %q", db.Driver)
+	}
+	check(db.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS", "must not be negative, 0 means unlimited")
+	check(db.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS", "must not be negative")
+	check(db.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME", "must not be negative, 0 means forever")
+	check(db.ConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME", "must not be negative, 0 means forever")
+	check(db.ConnectTimeout >= time.Second, "DB_CONNECT_TIMEOUT", "must be at least 1s, got %s", db.ConnectTimeout)
+	check(db.StatementTimeout >= 0, "DB_STATEMENT_TIMEOUT", "must not be negative, 0 means none")
+
+	positive(c.TrashRetention, "TRASH_RETENTION")
+	positive(c.TrashPurgeInterval, "TRASH_PURGE_INTERVAL")
+	positive(c.RecurrenceInterval, "RECURRENCE_INTERVAL")
+	for _, lead := range c.ReminderLeadTimes {
+		positive(lead, "REMINDER_LEAD_TIMES")
+	}
+	positive(c.EscalationGrace, "ESCALATION_GRACE")
+	positive(c.ReminderInterval, "REMINDER_INTERVAL")
+
+	if c.SMTP.Host != "" {
+		check(c.SMTP.Port > 0 && c.SMTP.Port < 65536, "SMTP_PORT", "must be a port number, got %d", c.SMTP.Port)
+		check(c.SMTP.From != "", "SMTP_FROM", "is required when SMTP_HOST is set")
+	}
+	positive(c.OutboxInterval, "OUTBOX_INTERVAL")
+	check(c.DigestHour >= 0 && c.DigestHour < 24, "DIGEST_HOUR", "must be an hour from 0 to 23, got %d", c.DigestHour)
+
+	check(oneOf(c.RateLimitBackend, "memory", "postgres", "off"),
+		"RATE_LIMIT_BACKEND", "must be memory, postgres or off, got %q", c.RateLimitBackend)
+	positive(c.IdempotencyWindow, "IDEMPOTENCY_WINDOW")
+	positive(c.HealthTimeout, "HEALTH_TIMEOUT")
+
+	check(oneOf(c.LogLevel, "debug", "info", "warn", "error"),
+		"LOG_LEVEL", "must be debug, info, warn or error, got %q", c.LogLevel)
+	check(oneOf(c.LogFormat, "json", "text"), "LOG_FORMAT", "must be json or text, got %q", c.LogFormat)
+
+	return errors.Join(errs...)
+}
+
+func oneOf(s string, values ...string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the configuration from the command line arguments args, which
+// exclude the program name, the environment and the YAML file named by the
+// -config flag or CONFIG_FILE, and validates it. It returns flag.ErrHelp if
+// args ask for usage, which has then been printed.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+	settings := settingsOf(reflect.ValueOf(&cfg).Elem())
+
+	flags := flag.NewFlagSet("project-api", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration `file`")
+	fromFlags := make(map[string]string)
+	for _, s := range settings {
+		for _, key := range s.keys() {
+			key := key
+			flags.Func(flagName(key), "overrides "+key, func(value string) error {
+				fromFlags[key] = value
+				return nil
+			})
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	fromFile := make(map[string]string)
+	if *path != "" {
+		var err error
+		if fromFile, err = readFile(*path, settings); err != nil {
+			return cfg, err
+		}
+	}
+
+	var errs []error
+	for _, s := range settings {
+		value, source, err := s.lookup(fromFlags, fromFile, *path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if source == "" {
+			continue
+		}
+		if err := s.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s (from %s): %v", s.key, source, err))
+		}
+	}
+	if len(errs) > 0 {
+		return cfg, errors.Join(errs...)
+	}
+	return cfg, cfg.Validate()
+}
+
+// setting is a field of Config with an env tag.
+type setting struct {
+	key   string
+	file  bool
+	value reflect.Value
+}
+
+func settingsOf(v reflect.Value) []setting {
+	var settings []setting
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if key, ok := field.Tag.Lookup("env"); ok {
+			settings = append(settings, setting{key: key, file: field.Tag.Get("file") == "true", value: v.Field(i)})
+		} else if field.Type.Kind() == reflect.Struct {
+			settings = append(settings, settingsOf(v.Field(i))...)
+		}
+	}
+	return settings
+}
+
+// keys returns the names the setting can be set by, e.g. POSTGRES_PASSWORD
+// and POSTGRES_PASSWORD_FILE.
+func (s setting) keys() []string {
+	if s.file {
+		return []string{s.key, s.key + "_FILE"}
+	}
+	return []string{s.key}
+}
+
+// lookup returns the value of the setting from the first source that sets
+// it, and a description of that source, which is empty if none does. Empty
+// environment variables are taken to be unset.
+func (s setting) lookup(fromFlags, fromFile map[string]string, path string) (value, source string, err error) {
+	sources := []struct {
+		name   string
+		lookup func(key string) (string, bool)
+	}{
+		{"flag", func(key string) (string, bool) { v, ok := fromFlags[key]; return v, ok }},
+		{"environment", func(key string) (string, bool) { v := os.Getenv(key); return v, v != "" }},
+		{path, func(key string) (string, bool) { v, ok := fromFile[key]; return v, ok }},
+	}
+	for _, src := range sources {
+		if value, ok := src.lookup(s.key); ok {
+			return value, src.name, nil
+		}
+		if !s.file {
+			continue
+		}
+		if name, ok := src.lookup(s.key + "_FILE"); ok {
+			b, err := os.ReadFile(name)
+			if err != nil {
+				return "", "", fmt.Errorf("%s_FILE (from %s): %v", s.key, src.name, err)
+			}
+			return strings.TrimRight(string(b), "\r\n"), src.name + " via " + name, nil
+		}
+	}
+	return "", "", nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (s setting) set(value string) error {
+	if u, ok := s.value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	switch {
+	case s.value.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(int64(d))
+	case s.value.Type() == reflect.TypeOf([]time.Duration(nil)):
+		var durations []time.Duration
+		for _, part := range strings.Split(value, ",") {
+			d, err := time.ParseDuration(strings.TrimSpace(part))
+			if err != nil {
+				return err
+			}
+			durations = append(durations, d)
+		}
+		s.value.Set(reflect.ValueOf(durations))
+	case s.value.Kind() == reflect.String:
+		s.value.SetString(value)
+	case s.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		s.value.SetInt(int64(n))
+	case s.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		s.value.SetBool(b)
+	default:
+		panic("config: unsupported setting type " + s.value.Type().String())
+	}
+	return nil
+}
+
+// readFile reads a YAML file of settings keyed by their lower case names,
+// e.g. "postgres_host: db". Lists, such as of reminder lead times, may be
+// written as YAML sequences.
+func readFile(path string, settings []setting) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading configuration file: %w", err)
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	known := make(map[string]bool)
+	for _, s := range settings {
+		for _, key := range s.keys() {
+			known[key] = true
+		}
+	}
+	values := make(map[string]string)
+	var errs []error
+	for name, v := range raw {
+		key := strings.ToUpper(name)
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, name))
+			continue
+		}
+		switch v := v.(type) {
+		case nil:
+		case []any:
+			parts := make([]string, len(v))
+			for i, part := range v {
+				parts[i] = fmt.Sprint(part)
+			}
+			values[key] = strings.Join(parts, ",")
+		case map[string]any:
+			errs = append(errs, fmt.Errorf("%s: %s must not be a mapping", path, name))
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return values, errors.Join(errs...)
+}
+
+// flagName returns the flag of a setting, e.g. postgres-host for
+// POSTGRES_HOST.
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
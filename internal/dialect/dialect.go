@@ -0,0 +1,36 @@
+// Package dialect lets the repositories, which are written in PostgreSQL's
+// SQL, run against an embedded SQLite database as well. Statements sent to a
+// SQLite connection are rewritten where the two dialects differ, and the
+// PostgreSQL functions the statements use are provided as SQLite functions.
+// The few queries that cannot be rewritten, such as full-text search, check
+// Of to choose their SQL.
+package dialect
+
+import (
+	"database/sql"
+
+	"modernc.org/sqlite"
+)
+
+// Dialect is the SQL dialect of a database.
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	SQLite
+)
+
+func (d Dialect) String() string {
+	if d == SQLite {
+		return "sqlite"
+	}
+	return "postgresql"
+}
+
+// Of returns the dialect of db.
+func Of(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*sqlite.Driver); ok {
+		return SQLite
+	}
+	return Postgres
+}
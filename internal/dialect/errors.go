@@ -0,0 +1,47 @@
+package dialect
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Constraint is a kind of integrity constraint a statement can violate.
+type Constraint int
+
+const (
+	NoConstraint Constraint = iota
+	// Unique is a unique index or primary key, such as the one on users'
+	// email.
+	Unique
+	// ForeignKey is a reference to a row of another table, such as a task's
+	// respId.
+	ForeignKey
+)
+
+// Violated returns the kind of constraint err says a statement violated, in
+// either dialect, or NoConstraint.
+func Violated(err error) Constraint {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505":
+			return Unique
+		case "23503":
+			return ForeignKey
+		}
+		return NoConstraint
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return Unique
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return ForeignKey
+		}
+	}
+	return NoConstraint
+}
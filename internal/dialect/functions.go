@@ -0,0 +1,149 @@
+package dialect
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"modernc.org/sqlite"
+)
+
+// timeFormat is how times are stored in SQLite, matching the _time_format
+// the connections use. In UTC, such times sort as text in time order.
+const timeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+func init() {
+	sqlite.MustRegisterScalarFunction("now", 0, now)
+	sqlite.MustRegisterDeterministicScalarFunction("timestamp_add", 2, timestampAdd)
+	sqlite.MustRegisterDeterministicScalarFunction("search_rank", 3, searchRank)
+	sqlite.MustRegisterDeterministicScalarFunction("search_snippet", 2, searchSnippet)
+}
+
+// now is PostgreSQL's now(), except that it changes within a transaction.
+func now(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+	return time.Now().UTC().Format(timeFormat), nil
+}
+
+// timestampAdd returns the time args[0] shifted by args[1] seconds.
+func timestampAdd(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+	t, err := parseTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var seconds float64
+	switch v := args[1].(type) {
+	case int64:
+		seconds = float64(v)
+	case float64:
+		seconds = v
+	default:
+		return nil, fmt.Errorf("timestamp_add: %v is not a number of seconds", v)
+	}
+	return t.Add(time.Duration(seconds * float64(time.Second))).UTC().Format(timeFormat), nil
+}
+
+func parseTime(v driver.Value) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		return time.Parse(timeFormat, strings.TrimSuffix(v, "Z"))
+	}
+	return time.Time{}, fmt.Errorf("%v is not a time", v)
+}
+
+// searchTerm matches the words of a query written by
+// repositories.PrefixQuery, e.g. "rel" and "check" for 'rel':* & 'check':*.
+var searchTerm = regexp.MustCompile(`'([^']*)':\*`)
+
+func searchTerms(query driver.Value) []string {
+	s, _ := query.(string)
+	var terms []string
+	for _, m := range searchTerm.FindAllStringSubmatch(s, -1) {
+		terms = append(terms, strings.ToLower(m[1]))
+	}
+	return terms
+}
+
+func words(v driver.Value) []string {
+	s, _ := v.(string)
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func hasPrefix(words []string, term string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchRank stands in for ts_rank on a title weighted A and a body weighted
+// B: it returns 0 unless every term starts a word of either, and more the
+// more terms are found in the title. Words are not stemmed.
+func searchRank(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	terms := searchTerms(args[2])
+	if len(terms) == 0 {
+		return 0.0, nil
+	}
+	title, body := words(args[0]), words(args[1])
+	rank := 0.0
+	for _, term := range terms {
+		switch {
+		case hasPrefix(title, term):
+			rank += 1
+		case hasPrefix(body, term):
+			rank += 0.4
+		default:
+			return 0.0, nil
+		}
+	}
+	return rank / float64(len(terms)), nil
+}
+
+// searchSnippet stands in for ts_headline: it returns the text with the
+// words that match a term marked.
+func searchSnippet(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	text, _ := args[0].(string)
+	terms := searchTerms(args[1])
+	var b strings.Builder
+	word := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	for len(text) > 0 {
+		i := strings.IndexFunc(text, word)
+		if i < 0 {
+			b.WriteString(text)
+			break
+		}
+		b.WriteString(text[:i])
+		text = text[i:]
+		j := strings.IndexFunc(text, func(r rune) bool { return !word(r) })
+		if j < 0 {
+			j = len(text)
+		}
+		if w := text[:j]; matchesAny(strings.ToLower(w), terms) {
+			b.WriteString("<mark>" + w + "</mark>")
+		} else {
+			b.WriteString(w)
+		}
+		text = text[j:]
+	}
+	return b.String(), nil
+}
+
+func matchesAny(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package dialect
+
+import (
+	"regexp"
+	"sync"
+)
+
+// rule rewrites a PostgreSQL construct SQLite lacks. Placeholders such as $1
+// need no rule: SQLite binds them by number too.
+type rule struct {
+	pattern *regexp.Regexp
+	replace string
+}
+
+var rules = []rule{
+	// Full-text search vectors and their indexes exist only in PostgreSQL;
+	// search uses functions.go instead.
+	{regexp.MustCompile(`(?is)ALTER TABLE \w+ ADD COLUMN \w+ tsvector GENERATED ALWAYS AS \(.*?\) STORED;`), ""},
+	{regexp.MustCompile(`(?i)CREATE INDEX \w+ ON \w+ USING GIN \([^)]*\);`), ""},
+	// SQLite cannot add a constraint to an existing column.
+	{regexp.MustCompile(`(?i)ALTER TABLE \w+ ALTER COLUMN \w+ SET NOT NULL;`), ""},
+	// Nor change its type, which it does not enforce anyway.
+	{regexp.MustCompile(`(?i)ALTER TABLE \w+ ALTER COLUMN \w+ TYPE [^;]*;`), ""},
+	// Nor drop a constraint, so users' email, which 0010 makes unique per
+	// organization, is not made unique across them in the first place.
+	{regexp.MustCompile(`(?i)\bemail TEXT NOT NULL UNIQUE\b`), "email TEXT NOT NULL"},
+	{regexp.MustCompile(`(?i)ALTER TABLE \w+ DROP CONSTRAINT [^;]*;`), ""},
+	// Nor add one; a unique index does the same.
+	{regexp.MustCompile(`(?i)ALTER TABLE (\w+) ADD CONSTRAINT (\w+) UNIQUE (\([^)]*\));`), "CREATE UNIQUE INDEX $2 ON $1 $3;"},
+	// Nor add more than one column per statement.
+	{regexp.MustCompile(`(?i)(ALTER TABLE (\w+)\s+ADD COLUMN [^,;]*),\s*ADD COLUMN`), "$1; ALTER TABLE $2 ADD COLUMN"},
+
+	{regexp.MustCompile(`(?i)\bSERIAL PRIMARY KEY\b`), "INTEGER PRIMARY KEY AUTOINCREMENT"},
+	{regexp.MustCompile(`(?i)\bTIMESTAMPTZ\b`), "TIMESTAMP"},
+	{regexp.MustCompile(`(?i)\bJSONB\b`), "TEXT"},
+	{regexp.MustCompile(`(?i)\bBYTEA\b`), "BLOB"},
+	{regexp.MustCompile(`(?i)\bDEFAULT now\(\)`), "DEFAULT (now())"},
+
+	// SQLite's LIKE ignores case already.
+	{regexp.MustCompile(`(?i)\bILIKE\b`), "LIKE"},
+	// A write transaction locks the whole database, so rows and tables need
+	// no locks of their own.
+	{regexp.MustCompile(`(?i)\s+FOR UPDATE(\s+OF\s+\w+)?(\s+SKIP LOCKED)?`), ""},
+	{regexp.MustCompile(`(?i)^\s*LOCK TABLE [^;]*`), "SELECT 1"},
+	// INSERT ... SELECT ... ON CONFLICT is ambiguous in SQLite.
+	{regexp.MustCompile(`(?i)INSERT INTO ([^;]*?)\s+ON CONFLICT DO NOTHING`), "INSERT OR IGNORE INTO $1"},
+	// Times are shifted with timestamp_add, e.g. now() + $4 * interval
+	// '1 second' becomes timestamp_add(now(), +$4).
+	{regexp.MustCompile(`(?i)([\w.]+(?:\(\))?) ([+-]) (\$\d+) \* interval '1 second'`), "timestamp_add($1, $2$3)"},
+}
+
+var rewritten sync.Map
+
+// Rewrite translates query from PostgreSQL's dialect to SQLite's.
+func Rewrite(query string) string {
+	if s, ok := rewritten.Load(query); ok {
+		return s.(string)
+	}
+	s := query
+	for _, r := range rules {
+		for {
+			next := r.pattern.ReplaceAllString(s, r.replace)
+			if next == s {
+				break
+			}
+			s = next
+		}
+	}
+	rewritten.Store(query, s)
+	return s
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/allwsaa/project-api/internal/auth"
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/repositories"
+)
+
+// MaxBulkTasks caps how many tasks a single bulk request may list by ID or
+// select by filter.
+const MaxBulkTasks = 1000
+
+type BulkTaskRequest struct {
+	Operation string             `json:"operation" enums:"set_status,set_priority,reassign,move,delete"`
+	Status    string             `json:"status,omitempty" example:"done"`
+	Priority  string             `json:"priority,omitempty" example:"high"`
+	RespId    int                `json:"respId,omitempty"`
+	ProjectID int                `json:"projectId,omitempty"`
+	IDs       []int              `json:"ids,omitempty"`
+	Filter    *models.TaskFilter `json:"filter,omitempty"`
+	DryRun    bool               `json:"dryRun"`
+}
+
+type BulkTaskResponse struct {
+	Operation string                        `json:"operation"`
+	DryRun    bool                          `json:"dryRun"`
+	Matched   int                           `json:"matched"`
+	Results   []repositories.BulkTaskResult `json:"results"`
+}
+
+// BulkTasks godoc
+// @Description Apply one operation to many tasks in a single transaction. Tasks are selected by a list of up to 1000 IDs or by a search filter matching up to 1000 tasks, limited to the caller's projects. Tasks of projects the caller only views are reported as forbidden and left unchanged, and tasks that would end up assigned to someone who is not a contributing member of their project are reported as not_member and left unchanged. With dryRun the changes are only previewed.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
+// @Param request body BulkTaskRequest true "Operation and the tasks to apply it to"
+// @Success 200 {object} BulkTaskResponse
+// @Failure 400 {object} problem.Details "Invalid request, or more than 1000 tasks selected"
+// @Failure 403 {object} problem.Details "Viewers cannot move tasks to the project"
+// @Failure 422 {object} problem.Details "Assignee or project does not exist"
+// @Failure 500 {object} problem.Details "Failed to apply bulk operation"
+// @Router /tasks/bulk [post]
+func BulkTasks(w http.ResponseWriter, r *http.Request) {
+	var req BulkTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if len(req.IDs) > 0 && req.Filter != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Provide either ids or filter, not both")
+		return
+	}
+	if len(req.IDs) == 0 && (req.Filter == nil || req.Filter.IsEmpty()) {
+		problem.Write(w, r, http.StatusBadRequest, "Provide ids or a non-empty filter")
+		return
+	}
+	if len(req.IDs) > MaxBulkTasks {
+		problem.Write(w, r, http.StatusBadRequest, "Too many ids")
+		return
+	}
+
+	var change repositories.TaskChange
+	switch req.Operation {
+	case "set_status":
+		if err := models.ValidateFields(models.Task{Status: req.Status}, "Status"); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		change.Status = req.Status
+	case "set_priority":
+		if err := models.ValidateFields(models.Task{Priority: req.Priority}, "Priority"); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		change.Priority = req.Priority
+	case "reassign":
+		if req.RespId == 0 {
+			problem.Write(w, r, http.StatusBadRequest, "Field respId is required")
+			return
+		}
+		users := repositories.UserRepo{DB: DB, OrgID: orgID(r)}
+		if _, err := users.GetUserByID(r.Context(), req.RespId); err != nil {
+			missingRef(w, r, err, "User not found")
+			return
+		}
+		change.RespId = req.RespId
+	case "move":
+		if req.ProjectID == 0 {
+			problem.Write(w, r, http.StatusBadRequest, "Field projectId is required")
+			return
+		}
+		projects := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+		if _, err := projects.GetProjectByID(r.Context(), req.ProjectID); err != nil {
+			missingRef(w, r, err, "Project not found")
+			return
+		}
+		if !requireRole(w, r, req.ProjectID, http.StatusUnprocessableEntity, taskEditors) {
+			return
+		}
+		change.ProjectID = req.ProjectID
+	case "delete":
+		change.Delete = true
+		change.DeletedBy = auth.UserRef(r.Context())
+	default:
+		problem.Write(w, r, http.StatusBadRequest, "Operation must be one of: set_status, set_priority, reassign, move, delete")
+		return
+	}
+
+	var filter models.TaskFilter
+	if req.Filter != nil {
+		filter = *req.Filter
+	}
+	filter.MemberID = callerScope(r)
+	change.EditorID = callerScope(r)
+	change.Assigner = auth.UserRef(r.Context())
+	repo := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	results, err := repo.BulkUpdateTasks(r.Context(), req.IDs, filter, MaxBulkTasks, change, req.DryRun)
+	if clientError(w, r, err) {
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to apply bulk operation", err)
+		return
+	}
+
+	response := BulkTaskResponse{Operation: req.Operation, DryRun: req.DryRun, Results: results}
+	for _, result := range results {
+		if result.Result != repositories.BulkNotFound {
+			response.Matched++
+		}
+	}
+	if response.Results == nil {
+		response.Results = []repositories.BulkTaskResult{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
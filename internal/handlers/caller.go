@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/allwsaa/project-api/internal/apperr"
+	"github.com/allwsaa/project-api/internal/auth"
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/repositories"
+)
+
+// serverError logs err together with the request it failed and answers 500
+// with msg, which must not reveal err itself.
+func serverError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	problem.Error(w, r, apperr.Wrap(apperr.Internal, msg, err))
+}
+
+// requireCaller returns the ID of the user making the request. Anonymous
+// requests are answered with 401 and ok is false.
+func requireCaller(w http.ResponseWriter, r *http.Request) (userID int, ok bool) {
+	userID, ok = auth.UserID(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, auth.UserHeader+" header is required")
+	}
+	return userID, ok
+}
+
+// IdentifyCaller looks up the organization of the user making the request
+// and stores it in the request context, which tells the rest of the chain
+// that the user exists. Anonymous requests and unknown users go on without
+// one, for RequireOrg to refuse.
+func IdentifyCaller(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		repo := repositories.OrganizationRepo{DB: DB}
+		orgID, orgRole, err := repo.GetCaller(r.Context(), userID)
+		if errors.Is(err, repositories.ErrNotFound) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			serverError(w, r, "Internal server error", err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithOrg(r.Context(), orgID, orgRole == models.OrgAdmin)))
+	})
+}
+
+// RequireOrg lets through only requests whose user IdentifyCaller found, so
+// that the handlers behind it only reach that user's organization's data.
+// Anonymous requests and unknown users are answered with 401.
+func RequireOrg(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireCaller(w, r); !ok {
+			return
+		}
+		if orgID(r) == 0 {
+			problem.Write(w, r, http.StatusUnauthorized, "Unknown user")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// orgID returns the caller's organization, which every repository a handler
+// uses is limited to.
+func orgID(r *http.Request) int {
+	return auth.OrgID(r.Context())
+}
+
+// requireOrgAdmin answers 403 unless the caller is an admin of their
+// organization.
+func requireOrgAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !auth.IsOrgAdmin(r.Context()) {
+		problem.Write(w, r, http.StatusForbidden, "Only organization admins can do this")
+		return false
+	}
+	return true
+}
+
+// clientError answers err if the repositories classified it as the client's
+// fault, such as a write referring to a project outside the caller's
+// organization or based on a stale version. Other errors are left to the
+// caller, and clientError returns false.
+func clientError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if apperr.KindOf(err) == apperr.Internal {
+		return false
+	}
+	problem.Error(w, r, err)
+	return true
+}
+
+// missingRef answers a failed lookup of a resource the request refers to,
+// such as a task's assignee: 422 with msg if it does not exist, 500
+// otherwise.
+func missingRef(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	if errors.Is(err, repositories.ErrNotFound) {
+		problem.Write(w, r, http.StatusUnprocessableEntity, msg)
+		return
+	}
+	serverError(w, r, "Internal server error", err)
+}
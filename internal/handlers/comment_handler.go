@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/auth"
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/repositories"
+)
+
+// GetTaskComments godoc
+// @Description Get the comments on a task, oldest first
+// @Tags comments
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Task ID"
+// @Success 200 {array} models.Comment
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 404 {object} problem.Details "Task not found"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /tasks/{id}/comments [get]
+func GetTaskComments(w http.ResponseWriter, r *http.Request) {
+	task, ok := taskFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	repo := repositories.CommentRepo{DB: DB, OrgID: orgID(r)}
+	comments, err := repo.GetComments(r.Context(), task.ID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(comments)
+}
+
+// CreateTaskComment godoc
+// @Description Comment on a task. Members of the task's project mentioned as @name, by their name or the part of their email before the @, are emailed about it.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Task ID"
+// @Param comment body models.Comment true "Comment"
+// @Success 201 {object} map[string]int
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 403 {object} problem.Details "Viewers cannot comment"
+// @Failure 404 {object} problem.Details "Task not found"
+// @Failure 422 {object} problem.Details "Body is required"
+// @Failure 500 {object} problem.Details "Failed to create comment"
+// @Router /tasks/{id}/comments [post]
+func CreateTaskComment(w http.ResponseWriter, r *http.Request) {
+	task, ok := taskFromURL(w, r)
+	if !ok {
+		return
+	}
+	var comment models.Comment
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := models.Validate(comment); err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if !requireRole(w, r, task.ProjectID, http.StatusNotFound, taskEditors) {
+		return
+	}
+
+	comment.TaskID = task.ID
+	comment.AuthorID = auth.UserRef(r.Context())
+	comment.CreatedAt = time.Now()
+	repo := repositories.CommentRepo{DB: DB, OrgID: orgID(r)}
+	id, err := repo.CreateComment(r.Context(), comment)
+	if clientError(w, r, err) {
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to create comment", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int{"id": id})
+}
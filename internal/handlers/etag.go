@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/allwsaa/project-api/internal/problem"
+)
+
+// RequireIfMatch makes If-Match mandatory on requests that modify a user,
+// project or task. Without it the header is still honoured when present.
+var RequireIfMatch bool
+
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", etag(version))
+}
+
+// notModified answers a conditional GET. It sets the ETag for the current
+// version and, if the client already has it, writes 304 and returns true.
+func notModified(w http.ResponseWriter, r *http.Request, version int) bool {
+	setETag(w, version)
+	if matchesETag(r.Header.Get("If-None-Match"), version, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// checkIfMatch validates the If-Match header against the current version of
+// the resource. It returns the version the write must be conditioned on, or 0
+// if the client did not ask for one. When the precondition fails the error
+// response has already been written and ok is false.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int) (expected int, ok bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if RequireIfMatch {
+			problem.Write(w, r, http.StatusPreconditionRequired, "If-Match header is required")
+			return 0, false
+		}
+		return 0, true
+	}
+	if !matchesETag(header, version, false) {
+		problem.Write(w, r, http.StatusPreconditionFailed, "Resource has been modified, fetch it again and retry")
+		return 0, false
+	}
+	return version, true
+}
+
+// matchesETag reports whether a comma-separated If-Match or If-None-Match
+// header value contains the ETag for version. Weak validators only match when
+// weak comparison is allowed, as for If-None-Match.
+func matchesETag(header string, version int, weak bool) bool {
+	want := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == want {
+			return true
+		}
+	}
+	return false
+}
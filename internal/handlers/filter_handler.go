@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/repositories"
+	"github.com/go-chi/chi"
+)
+
+type FilterCount struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// GetFilters godoc
+// @Description Get the caller's saved task filters and the filters shared with projects
+// @Tags filters
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Success 200 {array} models.SavedFilter
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /filters [get]
+func GetFilters(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+
+	repo := repositories.FilterRepo{DB: DB, OrgID: orgID(r)}
+	filters, err := repo.GetVisibleFilters(r.Context(), userID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(filters)
+}
+
+// GetFilterCounts godoc
+// @Description Get the number of matching tasks for each saved filter visible to the caller
+// @Tags filters
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Success 200 {array} FilterCount
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /filters/counts [get]
+func GetFilterCounts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+
+	repo := repositories.FilterRepo{DB: DB, OrgID: orgID(r)}
+	filters, err := repo.GetVisibleFilters(r.Context(), userID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+
+	tasks := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	counts := make([]FilterCount, len(filters))
+	for i, filter := range filters {
+		filter.Criteria.MemberID = userID
+		count, err := tasks.CountTasks(r.Context(), filter.Criteria)
+		if err != nil {
+			serverError(w, r, "Internal server error", err)
+			return
+		}
+		counts[i] = FilterCount{ID: filter.ID, Name: filter.Name, Count: count}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(counts)
+}
+
+// CreateFilter godoc
+// @Description Save a named task filter. Setting projectId shares it with the project.
+// @Tags filters
+// @Accept json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param filter body models.SavedFilter true "Filter name, criteria and optional project"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 201 {object} map[string]int
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 409 {object} problem.Details "A filter with this name already exists"
+// @Failure 422 {object} problem.Details "Project not found"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /filters [post]
+func CreateFilter(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var filter models.SavedFilter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := models.Validate(filter); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Criteria.IsEmpty() {
+		problem.Write(w, r, http.StatusBadRequest, "Criteria must not be empty")
+		return
+	}
+	if filter.Criteria.Status != "" || filter.Criteria.Priority != "" {
+		task := models.Task{Status: filter.Criteria.Status, Priority: filter.Criteria.Priority}
+		var fields []string
+		if task.Status != "" {
+			fields = append(fields, "Status")
+		}
+		if task.Priority != "" {
+			fields = append(fields, "Priority")
+		}
+		if err := models.ValidateFields(task, fields...); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if filter.ProjectID != nil {
+		projects := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+		if _, err := projects.GetProjectByID(r.Context(), *filter.ProjectID); err != nil {
+			missingRef(w, r, err, "Project not found")
+			return
+		}
+		visible, err := isVisibleProject(r, *filter.ProjectID)
+		if err != nil {
+			serverError(w, r, "Internal server error", err)
+			return
+		}
+		if !visible {
+			problem.Write(w, r, http.StatusUnprocessableEntity, "Project not found")
+			return
+		}
+	}
+
+	repo := repositories.FilterRepo{DB: DB, OrgID: orgID(r)}
+	exists, err := repo.FilterNameExists(r.Context(), userID, filter.Name)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	if exists {
+		problem.Write(w, r, http.StatusConflict, "A filter with this name already exists")
+		return
+	}
+
+	filter.OwnerID = userID
+	filter.CreatedAt = time.Now()
+	id, err := repo.CreateFilter(r.Context(), filter)
+	if clientError(w, r, err) {
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+
+	response := map[string]int{"id": id}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetFilterByID godoc
+// @Description Get a saved task filter by ID
+// @Tags filters
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Filter ID"
+// @Success 200 {object} models.SavedFilter
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 404 {object} problem.Details "Filter not found"
+// @Router /filters/{id} [get]
+func GetFilterByID(w http.ResponseWriter, r *http.Request) {
+	filter, ok := visibleFilter(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(filter)
+}
+
+// GetFilterTasks godoc
+// @Description Get the tasks matching a saved filter
+// @Tags filters
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Filter ID"
+// @Success 200 {array} models.Task
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 404 {object} problem.Details "Filter not found"
+// @Failure 500 {object} problem.Details "Failed to search tasks"
+// @Router /filters/{id}/tasks [get]
+func GetFilterTasks(w http.ResponseWriter, r *http.Request) {
+	filter, ok := visibleFilter(w, r)
+	if !ok {
+		return
+	}
+
+	filter.Criteria.MemberID = callerScope(r)
+	repo := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	tasks, err := repo.FindTasks(r.Context(), filter.Criteria, models.Page{})
+	if err != nil {
+		serverError(w, r, "Failed to search tasks", err)
+		return
+	}
+	if tasks == nil {
+		tasks = []models.Task{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// DeleteFilter godoc
+// @Description Delete a saved task filter. Only its owner can delete it.
+// @Tags filters
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Filter ID"
+// @Success 204
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 403 {object} problem.Details "Only the owner can delete a filter"
+// @Failure 404 {object} problem.Details "Filter not found"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /filters/{id} [delete]
+func DeleteFilter(w http.ResponseWriter, r *http.Request) {
+	filter, ok := visibleFilter(w, r)
+	if !ok {
+		return
+	}
+	if userID, _ := requireCaller(w, r); filter.OwnerID != userID {
+		problem.Write(w, r, http.StatusForbidden, "Only the owner can delete a filter")
+		return
+	}
+
+	repo := repositories.FilterRepo{DB: DB, OrgID: orgID(r)}
+	if err := repo.DeleteFilter(r.Context(), filter.ID); err != nil {
+		if clientError(w, r, err) {
+			return
+		}
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// visibleFilter loads the filter named by the {id} URL parameter if the
+// caller may see it: their own filters and those shared with a project they
+// are a member of.
+func visibleFilter(w http.ResponseWriter, r *http.Request) (*models.SavedFilter, bool) {
+	userID, ok := requireCaller(w, r)
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return nil, false
+	}
+
+	repo := repositories.FilterRepo{DB: DB, OrgID: orgID(r)}
+	filter, err := repo.GetFilterByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return nil, false
+	}
+	if filter.OwnerID != userID {
+		visible := false
+		if filter.ProjectID != nil {
+			visible, err = isVisibleProject(r, *filter.ProjectID)
+		}
+		if err != nil {
+			serverError(w, r, "Internal server error", err)
+			return nil, false
+		}
+		if !visible {
+			problem.Write(w, r, http.StatusNotFound, "Filter not found")
+			return nil, false
+		}
+	}
+	return filter, true
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/allwsaa/project-api/internal/auth"
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/repositories"
+	"github.com/go-chi/chi"
+)
+
+// GetProjectMembers godoc
+// @Description Get the members of a project and their roles
+// @Tags members
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Project ID"
+// @Success 200 {array} models.ProjectMember
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 404 {object} problem.Details "Project not found"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /projects/{id}/members [get]
+func GetProjectMembers(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := visibleProjectID(w, r)
+	if !ok {
+		return
+	}
+
+	repo := repositories.MemberRepo{DB: DB, OrgID: orgID(r)}
+	members, err := repo.GetMembers(r.Context(), projectID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(members)
+}
+
+// SetProjectMember godoc
+// @Description Add a user to a project or change their role. Owners and maintainers manage members; only owners can make someone an owner or change an owner's role.
+// @Tags members
+// @Accept json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Project ID"
+// @Param userId path int true "User ID"
+// @Param member body models.ProjectMember true "Role"
+// @Success 200 {object} models.ProjectMember
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 403 {object} problem.Details "Not allowed to manage members"
+// @Failure 404 {object} problem.Details "Project not found"
+// @Failure 409 {object} problem.Details "Project must keep at least one owner"
+// @Failure 422 {object} problem.Details "User not found"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /projects/{id}/members/{userId} [put]
+func SetProjectMember(w http.ResponseWriter, r *http.Request) {
+	projectID, userID, callerRole, ok := memberFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var member models.ProjectMember
+	if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := models.Validate(member); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	users := repositories.UserRepo{DB: DB, OrgID: orgID(r)}
+	if _, err := users.GetUserByID(r.Context(), userID); err != nil {
+		missingRef(w, r, err, "User not found")
+		return
+	}
+	repo := repositories.MemberRepo{DB: DB, OrgID: orgID(r)}
+	currentRole, err := repo.GetRole(r.Context(), projectID, userID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	if callerRole != models.RoleOwner && (member.Role == models.RoleOwner || currentRole == models.RoleOwner) {
+		problem.Write(w, r, http.StatusForbidden, "Only owners can manage owners")
+		return
+	}
+
+	if err := repo.SetMember(r.Context(), projectID, userID, member.Role); err != nil {
+		if clientError(w, r, err) {
+			return
+		}
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+
+	member.ProjectID = projectID
+	member.UserID = userID
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(member)
+}
+
+// RemoveProjectMember godoc
+// @Description Remove a user from a project. Owners and maintainers remove members, only owners remove owners, and anyone can leave a project.
+// @Tags members
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Project ID"
+// @Param userId path int true "User ID"
+// @Success 204
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 403 {object} problem.Details "Not allowed to manage members"
+// @Failure 404 {object} problem.Details "Member not found"
+// @Failure 409 {object} problem.Details "Project must keep at least one owner"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /projects/{id}/members/{userId} [delete]
+func RemoveProjectMember(w http.ResponseWriter, r *http.Request) {
+	projectID, userID, callerRole, ok := memberFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	repo := repositories.MemberRepo{DB: DB, OrgID: orgID(r)}
+	role, err := repo.GetRole(r.Context(), projectID, userID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	callerID, _ := auth.UserID(r.Context())
+	if role == models.RoleOwner && callerRole != models.RoleOwner && userID != callerID {
+		problem.Write(w, r, http.StatusForbidden, "Only owners can manage owners")
+		return
+	}
+
+	if err := repo.RemoveMember(r.Context(), projectID, userID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			problem.Write(w, r, http.StatusNotFound, "Member not found")
+			return
+		}
+		if clientError(w, r, err) {
+			return
+		}
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// memberFromURL reads the {id} and {userId} URL parameters of a membership
+// change and checks that the caller may make it: owners and maintainers may
+// manage members, and every member may remove themselves. Organization admins
+// act as owners of every project.
+func memberFromURL(w http.ResponseWriter, r *http.Request) (projectID, userID int, callerRole string, ok bool) {
+	callerID, ok := requireCaller(w, r)
+	if !ok {
+		return 0, 0, "", false
+	}
+	projectID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return 0, 0, "", false
+	}
+	userID, err = strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid user ID")
+		return 0, 0, "", false
+	}
+
+	projects := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	if _, err := projects.GetProjectByID(r.Context(), projectID); err != nil {
+		problem.Error(w, r, err)
+		return 0, 0, "", false
+	}
+	callerRole, err = projectRole(r, projectID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return 0, 0, "", false
+	}
+	switch {
+	case callerRole == "":
+		problem.Write(w, r, http.StatusNotFound, "Project not found")
+		return 0, 0, "", false
+	case slices.Contains(projectEditors, callerRole):
+	case r.Method == http.MethodDelete && userID == callerID:
+	default:
+		problem.Write(w, r, http.StatusForbidden, "Not allowed to manage members")
+		return 0, 0, "", false
+	}
+	return projectID, userID, callerRole, true
+}
+
+// callerScope returns the caller's ID to limit lists to the projects they are
+// a member of, or 0 for organization admins, who see all of the
+// organization's projects.
+func callerScope(r *http.Request) int {
+	if auth.IsOrgAdmin(r.Context()) {
+		return 0
+	}
+	userID, _ := auth.UserID(r.Context())
+	return userID
+}
+
+// visibleProjectID reads the {id} URL parameter and answers 404 unless the
+// project exists and the caller is one of its members.
+func visibleProjectID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return 0, false
+	}
+	projects := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	if _, err := projects.GetProjectByID(r.Context(), id); err != nil {
+		problem.Error(w, r, err)
+		return 0, false
+	}
+	visible, err := isVisibleProject(r, id)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return 0, false
+	}
+	if !visible {
+		problem.Write(w, r, http.StatusNotFound, "Project not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// isVisibleProject reports whether the caller is a member of the project.
+// Organization admins see every project of the organization.
+func isVisibleProject(r *http.Request, projectID int) (bool, error) {
+	role, err := projectRole(r, projectID)
+	return role != "", err
+}
+
+// The roles allowed to make each kind of change in a project.
+var (
+	// taskEditors create, change, delete and restore the project's tasks.
+	taskEditors = []string{models.RoleOwner, models.RoleMaintainer, models.RoleContributor}
+	// projectEditors change the project and manage its members.
+	projectEditors = []string{models.RoleOwner, models.RoleMaintainer}
+	// projectOwners delete and restore the project.
+	projectOwners = []string{models.RoleOwner}
+)
+
+// projectRole returns the caller's role in the project, or "" if they are not
+// a member. Organization admins act as owners of every project.
+func projectRole(r *http.Request, projectID int) (string, error) {
+	if auth.IsOrgAdmin(r.Context()) {
+		return models.RoleOwner, nil
+	}
+	callerID, _ := auth.UserID(r.Context())
+	repo := repositories.MemberRepo{DB: DB, OrgID: orgID(r)}
+	return repo.GetRole(r.Context(), projectID, callerID)
+}
+
+// requireRole answers unless the caller's role in the project is one of
+// roles: with 403 if they are a member in another role, and with
+// notFoundStatus if they are not a member, so that the project stays hidden
+// from them. That is 404 for a project named in the URL and 422 for one
+// named in the request body.
+func requireRole(w http.ResponseWriter, r *http.Request, projectID, notFoundStatus int, roles []string) bool {
+	role, err := projectRole(r, projectID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return false
+	}
+	if role == "" {
+		problem.Write(w, r, notFoundStatus, "Project not found")
+		return false
+	}
+	if !slices.Contains(roles, role) {
+		problem.Write(w, r, http.StatusForbidden, "Your role in the project does not allow this")
+		return false
+	}
+	return true
+}
+
+// checkAssignee answers 422 unless the user can be assigned tasks in the
+// project, that is, they are a member with a role other than viewer.
+func checkAssignee(w http.ResponseWriter, r *http.Request, projectID, userID int) bool {
+	repo := repositories.MemberRepo{DB: DB, OrgID: orgID(r)}
+	role, err := repo.GetRole(r.Context(), projectID, userID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return false
+	}
+	if role == "" || role == models.RoleViewer {
+		problem.Write(w, r, http.StatusUnprocessableEntity, "Assignee must be a contributor, maintainer or owner of the project")
+		return false
+	}
+	return true
+}
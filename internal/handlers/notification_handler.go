@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/repositories"
+	"github.com/go-chi/chi"
+)
+
+// GetNotifications godoc
+// @Description Get the caller's due-date reminders, overdue notices and escalations, newest first
+// @Tags notifications
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param unread query bool false "Only return unread notifications"
+// @Success 200 {array} models.Notification
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /notifications [get]
+func GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	unreadOnly := false
+	if value := r.URL.Query().Get("unread"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "Parameter unread must be true or false")
+			return
+		}
+		unreadOnly = b
+	}
+
+	repo := repositories.NotificationRepo{DB: DB}
+	notifications, err := repo.GetNotifications(r.Context(), userID, unreadOnly)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(notifications)
+}
+
+// MarkNotificationRead godoc
+// @Description Mark one of the caller's notifications as read
+// @Tags notifications
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Notification ID"
+// @Success 204
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 404 {object} problem.Details "Notification not found"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /notifications/{id}/read [post]
+func MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	repo := repositories.NotificationRepo{DB: DB}
+	if err := repo.MarkNotificationRead(r.Context(), id, userID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			problem.Write(w, r, http.StatusNotFound, "Notification not found")
+			return
+		}
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetNotificationPreferences godoc
+// @Description Get how a user wants to be emailed. Users can only see their own preferences.
+// @Tags notifications
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "User ID"
+// @Success 200 {object} models.NotificationPreferences
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 403 {object} problem.Details "Not your preferences"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /users/{id}/notification-preferences [get]
+func GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := ownUserID(w, r)
+	if !ok {
+		return
+	}
+
+	repo := repositories.OutboxRepo{DB: DB}
+	email, err := repo.GetEmailPreference(r.Context(), userID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.NotificationPreferences{Email: email})
+}
+
+// UpdateNotificationPreferences godoc
+// @Description Choose how a user is emailed about tasks assigned to them: immediately, in a daily digest, or not at all
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "User ID"
+// @Param preferences body models.NotificationPreferences true "Email preference"
+// @Success 200 {object} models.NotificationPreferences
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 403 {object} problem.Details "Not your preferences"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /users/{id}/notification-preferences [put]
+func UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := ownUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var preferences models.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&preferences); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := models.Validate(preferences); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	repo := repositories.OutboxRepo{DB: DB}
+	if err := repo.SetEmailPreference(r.Context(), userID, preferences.Email); err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(preferences)
+}
+
+// ownUserID returns the {id} URL parameter if it is the caller's own ID.
+func ownUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	callerID, ok := requireCaller(w, r)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return 0, false
+	}
+	if id != callerID {
+		problem.Write(w, r, http.StatusForbidden, "Not your preferences")
+		return 0, false
+	}
+	return id, true
+}
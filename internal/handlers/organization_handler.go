@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/repositories"
+	"github.com/go-chi/chi"
+)
+
+type CreateOrganizationRequest struct {
+	Name  string      `json:"name" validate:"required" example:"Acme"`
+	Admin models.User `json:"admin"`
+}
+
+// CreateOrganization godoc
+// @Description Create an organization together with its first admin. This is the only endpoint that does not need an X-User-ID header; the admin's ID returned here is used for every later request.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param organization body CreateOrganizationRequest true "Organization name and first admin"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 201 {object} map[string]int
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 500 {object} problem.Details "Failed to create organization"
+// @Router /organizations [post]
+func CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var req CreateOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := models.Validate(req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now()
+	org := models.Organization{Name: req.Name, CreatedAt: now}
+	req.Admin.RegistrationDate = now
+	repo := repositories.OrganizationRepo{DB: DB}
+	id, adminID, err := repo.CreateOrganization(r.Context(), org, req.Admin)
+	if clientError(w, r, err) {
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to create organization", err)
+		return
+	}
+
+	response := map[string]int{"id": id, "adminId": adminID}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetOrganization godoc
+// @Description Get the caller's organization
+// @Tags organizations
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Success 200 {object} models.Organization
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /organization [get]
+func GetOrganization(w http.ResponseWriter, r *http.Request) {
+	repo := repositories.OrganizationRepo{DB: DB}
+	org, err := repo.GetOrganization(r.Context(), orgID(r))
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(org)
+}
+
+// UpdateOrganization godoc
+// @Description Rename the caller's organization. Only organization admins can do this.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param organization body models.Organization true "New name"
+// @Success 200 {object} models.Organization
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 403 {object} problem.Details "Only organization admins can do this"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /organization [put]
+func UpdateOrganization(w http.ResponseWriter, r *http.Request) {
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+	var org models.Organization
+	if err := json.NewDecoder(r.Body).Decode(&org); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := models.Validate(org); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	repo := repositories.OrganizationRepo{DB: DB}
+	if err := repo.RenameOrganization(r.Context(), orgID(r), org.Name); err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	updated, err := repo.GetOrganization(r.Context(), orgID(r))
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// SetOrgRole godoc
+// @Description Make a user of the caller's organization an admin or a member. Only organization admins can do this, and the last admin cannot step down.
+// @Tags organizations
+// @Accept json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "User ID"
+// @Param role body models.OrgRoleChange true "New role"
+// @Success 204
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 401 {object} problem.Details "Caller is required"
+// @Failure 403 {object} problem.Details "Only organization admins can do this"
+// @Failure 404 {object} problem.Details "User not found"
+// @Failure 409 {object} problem.Details "Organization must keep at least one admin"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /users/{id}/org-role [put]
+func SetOrgRole(w http.ResponseWriter, r *http.Request) {
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var change models.OrgRoleChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := models.Validate(change); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	repo := repositories.OrganizationRepo{DB: DB}
+	if err := repo.SetOrgRole(r.Context(), orgID(r), id, change.OrgRole); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			problem.Write(w, r, http.StatusNotFound, "User not found")
+			return
+		}
+		if clientError(w, r, err) {
+			return
+		}
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/allwsaa/project-api/internal/models"
+)
+
+// maxPageLimit caps the limit query parameter of the lists that can be paged.
+const maxPageLimit = 1000
+
+// pageFromQuery reads the page of a list from the limit and after query
+// parameters. Without limit the whole list is returned, as before paging was
+// added.
+func pageFromQuery(r *http.Request) (models.Page, error) {
+	var page models.Page
+	query := r.URL.Query()
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return page, errors.New("Parameter limit must be between 1 and " + strconv.Itoa(maxPageLimit))
+		}
+		page.Limit = n
+	}
+	if value := query.Get("after"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return page, errors.New("Parameter after must be an ID")
+		}
+		page.After = n
+	}
+	return page, nil
+}
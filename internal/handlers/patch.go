@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+
+	"github.com/allwsaa/project-api/internal/problem"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// applyPatch applies the request body to current and decodes the result into
+// patched. The body is an RFC 7396 merge patch (application/merge-patch+json,
+// also assumed for application/json) or an RFC 6902 JSON Patch
+// (application/json-patch+json). On failure the error response has already
+// been written and false is returned.
+func applyPatch(w http.ResponseWriter, r *http.Request, current any, patched any) bool {
+	mediaType := mergePatchType
+	if header := r.Header.Get("Content-Type"); header != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(header); err != nil {
+			problem.Write(w, r, http.StatusUnsupportedMediaType, "Invalid Content-Type")
+			return false
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return false
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return false
+	}
+
+	switch mediaType {
+	case mergePatchType, "application/json":
+		doc, err = jsonpatch.MergePatch(doc, body)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "Invalid merge patch: "+err.Error())
+			return false
+		}
+	case jsonPatchType:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "Invalid JSON Patch: "+err.Error())
+			return false
+		}
+		doc, err = patch.Apply(doc)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			problem.Write(w, r, http.StatusConflict, err.Error())
+			return false
+		}
+		if err != nil {
+			problem.Write(w, r, http.StatusUnprocessableEntity, "Failed to apply JSON Patch: "+err.Error())
+			return false
+		}
+	default:
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		problem.Write(w, r, http.StatusUnsupportedMediaType, "Unsupported patch format")
+		return false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(patched); err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, "Invalid patched document: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// changedFields compares two values of the same model and returns the fields
+// that differ, keyed by their JSON names. Changing a readonly field is an
+// error.
+func changedFields(before, after any) (map[string]any, error) {
+	b := reflect.ValueOf(before)
+	a := reflect.ValueOf(after)
+	changes := make(map[string]any)
+	for i := 0; i < b.NumField(); i++ {
+		field := b.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		// Compare the encoded values so that times which only differ in
+		// location or monotonic clock reading are considered equal.
+		old, err := json.Marshal(b.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		updated, err := json.Marshal(a.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(old, updated) {
+			continue
+		}
+		if field.Tag.Get("readonly") == "true" {
+			return nil, fmt.Errorf("%s is read-only", name)
+		}
+		changes[name] = a.Field(i).Interface()
+	}
+	return changes, nil
+}
@@ -1,35 +1,39 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strconv"
 
-	"github.com/allwsaa/project-api/database"
+	"github.com/allwsaa/project-api/internal/auth"
 	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
 	"github.com/allwsaa/project-api/internal/repositories"
 	"github.com/go-chi/chi"
 )
 
-var Datab *sql.DB
-
-func init() {
-	Datab = database.GetDB()
-}
-
 // GetProjects godoc
-// @Description Get a list of all projects
+// @Description Get a list of the projects the caller is a member of
 // @Tags projects
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
+// @Param limit query int false "Maximum number of results, in order of ID; all of them when not given"
+// @Param after query int false "Only return results with a greater ID, such as the last ID of the previous page"
 // @Success 200 {array} models.Project
-// @Failure 500 {string} string "Internal server error"
+// @Failure 400 {object} problem.Details "Invalid limit or after"
+// @Failure 500 {object} problem.Details "Internal server error"
 // @Router /projects [get]
 func GetProjects(w http.ResponseWriter, r *http.Request) {
-	repo := repositories.ProjectRepo{DB: DB}
-	projects, err := repo.GetAllProjects()
+	page, err := pageFromQuery(r)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	repo := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	projects, err := repo.GetAllProjects(r.Context(), callerScope(r), page)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, "Internal server error", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -42,22 +46,27 @@ func GetProjects(w http.ResponseWriter, r *http.Request) {
 // @Tags projects
 // @Accept json
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param project body models.Project true "Project data"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
 // @Success 201 {object} models.Project
-// @Failure 400 {string} string "Invalid input"
-// @Failure 500 {string} string "Internal server error"
+// @Failure 400 {object} problem.Details "Invalid input"
+// @Failure 500 {object} problem.Details "Internal server error"
 // @Router /projects [post]
 func CreateProject(w http.ResponseWriter, r *http.Request) {
 	var project models.Project
 	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	repo := repositories.ProjectRepo{DB: DB}
-	id, err := repo.CreateProject(project)
+	repo := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	id, err := repo.CreateProject(r.Context(), project)
+	if clientError(w, r, err) {
+		return
+	}
 	if err != nil {
-		http.Error(w, "failed to create project", http.StatusInternalServerError)
+		serverError(w, r, "Failed to create project", err)
 		return
 	}
 
@@ -71,23 +80,38 @@ func CreateProject(w http.ResponseWriter, r *http.Request) {
 // @Description Get project by ID
 // @Tags projects
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
 // @Param id path int true "Project ID"
+// @Param If-None-Match header string false "ETag of a cached copy"
 // @Success 200 {object} models.Project
-// @Failure 400 {string} string "Invalid ID"
-// @Failure 404 {string} string "Project not found"
+// @Success 304
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 404 {object} problem.Details "Project not found"
 // @Router /projects/{id} [get]
 func GetProjectByID(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
-	repo := repositories.ProjectRepo{DB: DB}
-	project, err := repo.GetProjectByID(id)
+	repo := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	project, err := repo.GetProjectByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, "project not found", http.StatusNotFound)
+		problem.Error(w, r, err)
+		return
+	}
+	visible, err := isVisibleProject(r, id)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	if !visible {
+		problem.Write(w, r, http.StatusNotFound, "Project not found")
+		return
+	}
+	if notModified(w, r, project.Version) {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -101,33 +125,136 @@ func GetProjectByID(w http.ResponseWriter, r *http.Request) {
 // @Tags projects
 // @Accept json
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param id path int true "Project ID"
 // @Param project body models.Project true "Project data"
+// @Param If-Match header string false "ETag the update is based on"
 // @Success 200 {object} models.Project
-// @Failure 400 {string} string "Invalid input"
-// @Failure 404 {string} string "Project not found"
-// @Failure 500 {string} string "Internal server error"
+// @Failure 400 {object} problem.Details "Invalid input"
+// @Failure 403 {object} problem.Details "Only owners and maintainers can change the project, and only owners its manager"
+// @Failure 404 {object} problem.Details "Project not found"
+// @Failure 412 {object} problem.Details "Project was modified"
+// @Failure 428 {object} problem.Details "If-Match header is required"
+// @Failure 500 {object} problem.Details "Internal server error"
 // @Router /projects/{id} [put]
 func UpdateProject(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
 	var project models.Project
 	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
 		return
 	}
 	project.ID = id
 
-	repo := repositories.ProjectRepo{DB: DB}
-	if err := repo.UpdateProject(project); err != nil {
-		http.Error(w, "failed to update project", http.StatusInternalServerError)
+	repo := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	current, err := repo.GetProjectByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	if !requireRole(w, r, id, http.StatusNotFound, projectEditors) {
+		return
+	}
+	if project.ManagerId != current.ManagerId && !requireRole(w, r, id, http.StatusNotFound, projectOwners) {
 		return
 	}
+	expected, ok := checkIfMatch(w, r, current.Version)
+	if !ok {
+		return
+	}
+
+	project.Started = current.Started
+	project.Version, err = repo.UpdateProject(r.Context(), project, expected)
+	if clientError(w, r, err) {
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to update project", err)
+		return
+	}
+	setETag(w, project.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(project)
+}
+
+// PatchProject godoc
+// @Summary Patch project
+// @Description Partially update a project with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902). Only the changed fields are written.
+// @Tags projects
+// @Accept application/merge-patch+json,application/json-patch+json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Project ID"
+// @Param patch body object true "Merge patch or JSON Patch document"
+// @Param If-Match header string false "ETag the update is based on"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} problem.Details "Invalid patch"
+// @Failure 403 {object} problem.Details "Only owners and maintainers can change the project, and only owners its manager"
+// @Failure 404 {object} problem.Details "Project not found"
+// @Failure 409 {object} problem.Details "JSON Patch test failed"
+// @Failure 412 {object} problem.Details "Project was modified"
+// @Failure 415 {object} problem.Details "Unsupported patch format"
+// @Failure 422 {object} problem.Details "Patched project is invalid"
+// @Failure 428 {object} problem.Details "If-Match header is required"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /projects/{id} [patch]
+func PatchProject(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	repo := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	current, err := repo.GetProjectByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	if !requireRole(w, r, id, http.StatusNotFound, projectEditors) {
+		return
+	}
+	expected, ok := checkIfMatch(w, r, current.Version)
+	if !ok {
+		return
+	}
+
+	var project models.Project
+	if !applyPatch(w, r, current, &project) {
+		return
+	}
+	changes, err := changedFields(*current, project)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err := models.Validate(project); err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if _, ok := changes["managerId"]; ok && !requireRole(w, r, id, http.StatusNotFound, projectOwners) {
+		return
+	}
+
+	if len(changes) > 0 {
+		project.Version, err = repo.PatchProject(r.Context(), id, changes, expected)
+		if clientError(w, r, err) {
+			return
+		}
+		if err != nil {
+			serverError(w, r, "Failed to update project", err)
+			return
+		}
+	}
+	setETag(w, project.Version)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(project)
@@ -138,22 +265,44 @@ func UpdateProject(w http.ResponseWriter, r *http.Request) {
 // @Description Delete project
 // @Tags projects
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param id path int true "Project ID"
+// @Param If-Match header string false "ETag the deletion is based on"
 // @Success 200 {object} map[string]string
-// @Failure 400 {string} string "Invalid ID"
-// @Failure 404 {string} string "Project not found"
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 403 {object} problem.Details "Only owners can delete the project"
+// @Failure 404 {object} problem.Details "Project not found"
+// @Failure 412 {object} problem.Details "Project was modified"
+// @Failure 428 {object} problem.Details "If-Match header is required"
 // @Router /projects/{id} [delete]
 func DeleteProject(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	repo := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	current, err := repo.GetProjectByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	if !requireRole(w, r, id, http.StatusNotFound, projectOwners) {
+		return
+	}
+	expected, ok := checkIfMatch(w, r, current.Version)
+	if !ok {
 		return
 	}
 
-	repo := repositories.ProjectRepo{DB: DB}
-	if err := repo.DeleteProject(id); err != nil {
-		http.Error(w, "failed to delete project", http.StatusInternalServerError)
+	err = repo.DeleteProject(r.Context(), id, auth.UserRef(r.Context()), expected)
+	if clientError(w, r, err) {
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to delete project", err)
 		return
 	}
 	response := map[string]string{"message": "Deleted successfully"}
@@ -162,28 +311,73 @@ func DeleteProject(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// RestoreProject godoc
+// @Summary Restore project
+// @Description Restore a deleted project and the tasks deleted with it
+// @Tags projects
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 403 {object} problem.Details "Only owners can restore the project"
+// @Failure 404 {object} problem.Details "Project not found in trash"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /projects/{id}/restore [post]
+func RestoreProject(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	if !requireRole(w, r, id, http.StatusNotFound, projectOwners) {
+		return
+	}
+
+	repo := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	err = repo.RestoreProject(r.Context(), id)
+	if clientError(w, r, err) {
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to restore project", err)
+		return
+	}
+
+	project, err := repo.GetProjectByID(r.Context(), id)
+	if err != nil {
+		serverError(w, r, "Failed to restore project", err)
+		return
+	}
+	setETag(w, project.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(project)
+}
+
 // GetTasksByProjectID godoc
 // @Summary Get tasks by project ID
 // @Description Get a list of tasks associated with a project by its ID
 // @Tags tasks
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
 // @Param id path int true "Project ID"
 // @Success 200 {array} models.Task
-// @Failure 400 {string} string "Invalid ID"
-// @Failure 404 {string} string "Tasks not found"
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 404 {object} problem.Details "Tasks not found"
 // @Router /projects/{id}/tasks [get]
 func GetTasksByProjectID(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+	id, ok := visibleProjectID(w, r)
+	if !ok {
 		return
 	}
 
-	repo := repositories.ProjectRepo{DB: DB}
-	tasks, err := repo.GetTasksByProjectID(id)
+	repo := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	tasks, err := repo.GetTasksByProjectID(r.Context(), id)
 	if err != nil {
-		http.Error(w, "failed to get tasks", http.StatusInternalServerError)
+		serverError(w, r, "Failed to get tasks", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -196,21 +390,22 @@ func GetTasksByProjectID(w http.ResponseWriter, r *http.Request) {
 // @Description Search projects based on title
 // @Tags projects
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
 // @Param title query string true "Title of the project"
 // @Success 200 {array} models.Project
-// @Failure 400 {string} string "Invalid input"
+// @Failure 400 {object} problem.Details "Invalid input"
 // @Router /projects/search/title [get]
 func SearchProjectsByTitle(w http.ResponseWriter, r *http.Request) {
 	title := r.URL.Query().Get("title")
 	if title == "" {
-		http.Error(w, "title is required", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Title is required")
 		return
 	}
 
-	repo := repositories.ProjectRepo{DB: DB}
-	projects, err := repo.SearchProjectsByTitle(title)
+	repo := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	projects, err := repo.SearchProjectsByTitle(r.Context(), title, callerScope(r))
 	if err != nil {
-		http.Error(w, "failed to search projects", http.StatusInternalServerError)
+		serverError(w, r, "Failed to search projects", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -223,28 +418,29 @@ func SearchProjectsByTitle(w http.ResponseWriter, r *http.Request) {
 // @Description Search projects based on manager's ID
 // @Tags projects
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
 // @Param managerId query int true "Manager's ID"
 // @Success 200 {array} models.Project
-// @Failure 400 {string} string "Invalid input"
-// @Failure 500 {string} string "Internal server error"
+// @Failure 400 {object} problem.Details "Invalid input"
+// @Failure 500 {object} problem.Details "Internal server error"
 // @Router /projects/search/manager [get]
 func SearchProjectsByManager(w http.ResponseWriter, r *http.Request) {
 	managerIDStr := r.URL.Query().Get("managerId")
 	if managerIDStr == "" {
-		http.Error(w, "manager id is required", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Parameter managerId is required")
 		return
 	}
 
 	managerID, err := strconv.Atoi(managerIDStr)
 	if err != nil {
-		http.Error(w, "Invalid manager id", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid managerId")
 		return
 	}
 
-	repo := repositories.ProjectRepo{DB: DB}
-	projects, err := repo.SearchProjectsByManager(managerID)
+	repo := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	projects, err := repo.SearchProjectsByManager(r.Context(), managerID, callerScope(r))
 	if err != nil {
-		http.Error(w, "failed to search projects", http.StatusInternalServerError)
+		serverError(w, r, "Failed to search projects", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/auth"
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/recurrence"
+	"github.com/allwsaa/project-api/internal/repositories"
+	"github.com/go-chi/chi"
+)
+
+const (
+	defaultOccurrenceLimit = 10
+	maxOccurrenceLimit     = 100
+)
+
+// GetRecurringTasks godoc
+// @Description Get a list of the recurring tasks in the caller's projects
+// @Tags recurring-tasks
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
+// @Success 200 {array} models.RecurringTask
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /recurring-tasks [get]
+func GetRecurringTasks(w http.ResponseWriter, r *http.Request) {
+	repo := repositories.RecurringTaskRepo{DB: DB, OrgID: orgID(r)}
+	recurringTasks, err := repo.GetRecurringTasks(r.Context(), callerScope(r))
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(recurringTasks)
+}
+
+// CreateRecurringTask godoc
+// @Description Create a recurring task. rrule supports FREQ=DAILY, WEEKLY or MONTHLY with INTERVAL, BYDAY (e.g. MO,FR or 1MO,-1FR for monthly), UNTIL and COUNT. startsAt defaults to now and timeZone to UTC.
+// @Tags recurring-tasks
+// @Accept json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param recurringTask body models.RecurringTask true "Task template and recurrence rule"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
+// @Success 201 {object} map[string]int
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 403 {object} problem.Details "Viewers cannot create recurring tasks"
+// @Failure 422 {object} problem.Details "Project or user not found, or the user is not a member of the project"
+// @Failure 500 {object} problem.Details "Failed to create recurring task"
+// @Router /recurring-tasks [post]
+func CreateRecurringTask(w http.ResponseWriter, r *http.Request) {
+	var rt models.RecurringTask
+	if err := json.NewDecoder(r.Body).Decode(&rt); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := models.Validate(rt); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rt.CreatedAt = time.Now()
+	if rt.StartsAt.IsZero() {
+		rt.StartsAt = rt.CreatedAt
+	}
+	rt.StartsAt = rt.StartsAt.Truncate(time.Second)
+	if rt.TimeZone == "" {
+		rt.TimeZone = "UTC"
+	}
+	series, err := recurrence.NewSeries(rt.RRule, rt.TimeZone, rt.StartsAt)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	first, ok := series.First()
+	if !ok {
+		problem.Write(w, r, http.StatusBadRequest, "The rrule has no occurrences")
+		return
+	}
+	rt.RRule = series.Rule.String()
+	rt.NextOccurrence = &first
+
+	projects := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	if _, err := projects.GetProjectByID(r.Context(), rt.ProjectID); err != nil {
+		missingRef(w, r, err, "Project not found")
+		return
+	}
+	users := repositories.UserRepo{DB: DB, OrgID: orgID(r)}
+	if _, err := users.GetUserByID(r.Context(), rt.RespId); err != nil {
+		missingRef(w, r, err, "User not found")
+		return
+	}
+	if !checkAssignee(w, r, rt.ProjectID, rt.RespId) {
+		return
+	}
+	if !requireRole(w, r, rt.ProjectID, http.StatusUnprocessableEntity, taskEditors) {
+		return
+	}
+
+	repo := repositories.RecurringTaskRepo{DB: DB, OrgID: orgID(r)}
+	id, err := repo.CreateRecurringTask(r.Context(), rt)
+	if clientError(w, r, err) {
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to create recurring task", err)
+		return
+	}
+
+	response := map[string]int{"id": id}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetRecurringTaskByID godoc
+// @Description Get recurring task by ID
+// @Tags recurring-tasks
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Recurring task ID"
+// @Success 200 {object} models.RecurringTask
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 404 {object} problem.Details "Recurring task not found"
+// @Router /recurring-tasks/{id} [get]
+func GetRecurringTaskByID(w http.ResponseWriter, r *http.Request) {
+	rt, ok := recurringTaskFromURL(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rt)
+}
+
+// DeleteRecurringTask godoc
+// @Description Stop a recurring task. Tasks already created from it are kept.
+// @Tags recurring-tasks
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Recurring task ID"
+// @Success 204
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 403 {object} problem.Details "Viewers cannot stop recurring tasks"
+// @Failure 404 {object} problem.Details "Recurring task not found"
+// @Failure 500 {object} problem.Details "Failed to delete recurring task"
+// @Router /recurring-tasks/{id} [delete]
+func DeleteRecurringTask(w http.ResponseWriter, r *http.Request) {
+	rt, ok := recurringTaskFromURL(w, r)
+	if !ok {
+		return
+	}
+	if !requireRole(w, r, rt.ProjectID, http.StatusNotFound, taskEditors) {
+		return
+	}
+
+	repo := repositories.RecurringTaskRepo{DB: DB, OrgID: orgID(r)}
+	if err := repo.DeleteRecurringTask(r.Context(), rt.ID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			problem.Write(w, r, http.StatusNotFound, "Recurring task not found")
+			return
+		}
+		serverError(w, r, "Failed to delete recurring task", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetOccurrences godoc
+// @Description List the upcoming occurrences of a recurring task with their status: scheduled, skipped or materialized (a task was created for it).
+// @Tags recurring-tasks
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Recurring task ID"
+// @Param from query string false "List occurrences from this RFC 3339 time instead of now"
+// @Param limit query int false "Maximum number of occurrences" default(10)
+// @Success 200 {array} models.Occurrence
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 404 {object} problem.Details "Recurring task not found"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /recurring-tasks/{id}/occurrences [get]
+func GetOccurrences(w http.ResponseWriter, r *http.Request) {
+	rt, ok := recurringTaskFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	from := time.Now()
+	if value := params.Get("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "Parameter from must be an RFC 3339 time")
+			return
+		}
+		from = t
+	}
+	limit := defaultOccurrenceLimit
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxOccurrenceLimit {
+			problem.Write(w, r, http.StatusBadRequest, "Parameter limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	series, err := recurrence.NewSeries(rt.RRule, rt.TimeZone, rt.StartsAt)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	repo := repositories.RecurringTaskRepo{DB: DB, OrgID: orgID(r)}
+	skipped, tasks, err := repo.GetOccurrenceStates(r.Context(), rt.ID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+
+	occurrences := []models.Occurrence{}
+	for _, t := range series.Between(from, from.AddDate(100, 0, 0), limit) {
+		occurrence := models.Occurrence{Occurrence: t, Status: "scheduled"}
+		if skipped[t.Unix()] {
+			occurrence.Status = "skipped"
+		} else if taskID, ok := tasks[t.Unix()]; ok {
+			occurrence.Status = "materialized"
+			occurrence.TaskID = &taskID
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(occurrences)
+}
+
+// SkipOccurrence godoc
+// @Description Skip a single occurrence of a recurring task. If its task was already created it is moved to the trash.
+// @Tags recurring-tasks
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Recurring task ID"
+// @Param occurrence path string true "Occurrence as an RFC 3339 time"
+// @Success 204
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 403 {object} problem.Details "Viewers cannot skip occurrences"
+// @Failure 404 {object} problem.Details "Occurrence not found"
+// @Failure 500 {object} problem.Details "Failed to skip occurrence"
+// @Router /recurring-tasks/{id}/occurrences/{occurrence} [delete]
+func SkipOccurrence(w http.ResponseWriter, r *http.Request) {
+	rt, occurrence, ok := occurrenceFromURL(w, r)
+	if !ok {
+		return
+	}
+	if !requireRole(w, r, rt.ProjectID, http.StatusNotFound, taskEditors) {
+		return
+	}
+
+	repo := repositories.RecurringTaskRepo{DB: DB, OrgID: orgID(r)}
+	if err := repo.SkipOccurrence(r.Context(), rt.ID, occurrence, auth.UserRef(r.Context())); err != nil {
+		if clientError(w, r, err) {
+			return
+		}
+		serverError(w, r, "Failed to skip occurrence", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateOccurrence godoc
+// @Description Edit a single occurrence of a recurring task. Its task is created now if the scheduler has not created it yet. Fields left empty are taken from the recurring task; completionDate defaults to the occurrence.
+// @Tags recurring-tasks
+// @Accept json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Recurring task ID"
+// @Param occurrence path string true "Occurrence as an RFC 3339 time"
+// @Param task body models.Task true "Task data for this occurrence"
+// @Success 200 {object} models.Task
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 403 {object} problem.Details "Viewers cannot edit occurrences"
+// @Failure 404 {object} problem.Details "Occurrence not found"
+// @Failure 409 {object} problem.Details "Occurrence was skipped"
+// @Failure 422 {object} problem.Details "Assignee is not a member of the project"
+// @Failure 500 {object} problem.Details "Failed to update occurrence"
+// @Router /recurring-tasks/{id}/occurrences/{occurrence} [put]
+func UpdateOccurrence(w http.ResponseWriter, r *http.Request) {
+	rt, occurrence, ok := occurrenceFromURL(w, r)
+	if !ok {
+		return
+	}
+	if !requireRole(w, r, rt.ProjectID, http.StatusNotFound, taskEditors) {
+		return
+	}
+
+	var task models.Task
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if task.Title == "" {
+		task.Title = rt.Title
+	}
+	if task.Description == "" {
+		task.Description = rt.Description
+	}
+	if task.Priority == "" {
+		task.Priority = rt.Priority
+	}
+	if task.Status == "" {
+		task.Status = "new"
+	}
+	if task.RespId == 0 {
+		task.RespId = rt.RespId
+	}
+	if task.CompletionDate.IsZero() {
+		task.CompletionDate = occurrence.UTC()
+	}
+	task.ProjectID = rt.ProjectID
+	task.CreationDate = time.Now()
+	task.RecurringTaskID = &rt.ID
+	task.Occurrence = &occurrence
+	if err := models.Validate(task); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if task.RespId != rt.RespId && !checkAssignee(w, r, rt.ProjectID, task.RespId) {
+		return
+	}
+
+	repo := repositories.RecurringTaskRepo{DB: DB, OrgID: orgID(r)}
+	skipped, err := repo.IsSkipped(r.Context(), rt.ID, occurrence)
+	if err != nil {
+		serverError(w, r, "Failed to update occurrence", err)
+		return
+	}
+	if skipped {
+		problem.Write(w, r, http.StatusConflict, "Occurrence was skipped")
+		return
+	}
+	id, err := repo.SaveOccurrence(r.Context(), task)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			problem.Write(w, r, http.StatusConflict, "Occurrence was skipped")
+			return
+		}
+		if clientError(w, r, err) {
+			return
+		}
+		serverError(w, r, "Failed to update occurrence", err)
+		return
+	}
+
+	tasks := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	saved, err := tasks.GetTaskByID(r.Context(), id)
+	if err != nil {
+		serverError(w, r, "Failed to update occurrence", err)
+		return
+	}
+	setETag(w, saved.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(saved)
+}
+
+func recurringTaskFromURL(w http.ResponseWriter, r *http.Request) (*models.RecurringTask, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return nil, false
+	}
+
+	repo := repositories.RecurringTaskRepo{DB: DB, OrgID: orgID(r)}
+	rt, err := repo.GetRecurringTaskByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return nil, false
+	}
+	visible, err := isVisibleProject(r, rt.ProjectID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return nil, false
+	}
+	if !visible {
+		problem.Write(w, r, http.StatusNotFound, "Recurring task not found")
+		return nil, false
+	}
+	return rt, true
+}
+
+// occurrenceFromURL loads the recurring task named by the {id} URL parameter
+// and checks that {occurrence} is one of its occurrences.
+func occurrenceFromURL(w http.ResponseWriter, r *http.Request) (*models.RecurringTask, time.Time, bool) {
+	occurrence, err := time.Parse(time.RFC3339, chi.URLParam(r, "occurrence"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Occurrence must be an RFC 3339 time")
+		return nil, time.Time{}, false
+	}
+	rt, ok := recurringTaskFromURL(w, r)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+
+	series, err := recurrence.NewSeries(rt.RRule, rt.TimeZone, rt.StartsAt)
+	if err != nil || !series.Includes(occurrence) {
+		problem.Write(w, r, http.StatusNotFound, "Occurrence not found")
+		return nil, time.Time{}, false
+	}
+	return rt, occurrence, true
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/repositories"
+)
+
+// SearchLanguage is the text search configuration used when a search does
+// not ask for one.
+var SearchLanguage = repositories.IndexedSearchLanguage
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type SearchResults struct {
+	Query    string                   `json:"query"`
+	Language string                   `json:"language"`
+	Tasks    []repositories.SearchHit `json:"tasks,omitempty"`
+	Projects []repositories.SearchHit `json:"projects,omitempty"`
+}
+
+// Search godoc
+// @Description Full-text search over task and project titles and descriptions. Every word is matched as a prefix; results are ranked and grouped by type, with highlighted snippets.
+// @Tags search
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
+// @Param q query string true "Search text"
+// @Param lang query string false "Text search language, e.g. english, german, simple"
+// @Param types query string false "Comma-separated entity types to search: tasks, projects" default(tasks,projects)
+// @Param limit query int false "Maximum results per type" default(20)
+// @Success 200 {object} SearchResults
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 500 {object} problem.Details "Failed to search"
+// @Router /search [get]
+func Search(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := repositories.PrefixQuery(params.Get("q"))
+	if query == "" {
+		problem.Write(w, r, http.StatusBadRequest, "Parameter q is required")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			problem.Write(w, r, http.StatusBadRequest, "Parameter limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	searchTasks, searchProjects := true, true
+	if value := params.Get("types"); value != "" {
+		searchTasks, searchProjects = false, false
+		for _, t := range strings.Split(value, ",") {
+			switch strings.TrimSpace(t) {
+			case "tasks":
+				searchTasks = true
+			case "projects":
+				searchProjects = true
+			default:
+				problem.Write(w, r, http.StatusBadRequest, "Parameter types must only contain tasks and projects")
+				return
+			}
+		}
+	}
+
+	repo := repositories.SearchRepo{DB: DB, OrgID: orgID(r)}
+	language := SearchLanguage
+	if value := params.Get("lang"); value != "" {
+		exists, err := repo.LanguageExists(r.Context(), value)
+		if err != nil {
+			serverError(w, r, "Failed to search", err)
+			return
+		}
+		if !exists {
+			problem.Write(w, r, http.StatusBadRequest, "Unknown search language")
+			return
+		}
+		language = value
+	}
+
+	results := SearchResults{Query: params.Get("q"), Language: language}
+	var err error
+	if searchTasks {
+		if results.Tasks, err = repo.SearchTasks(r.Context(), query, language, limit, callerScope(r)); err != nil {
+			serverError(w, r, "Failed to search", err)
+			return
+		}
+	}
+	if searchProjects {
+		if results.Projects, err = repo.SearchProjects(r.Context(), query, language, limit, callerScope(r)); err != nil {
+			serverError(w, r, "Failed to search", err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
@@ -3,34 +3,44 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/allwsaa/project-api/database"
+	"github.com/allwsaa/project-api/internal/auth"
 	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
 	"github.com/allwsaa/project-api/internal/repositories"
 	"github.com/go-chi/chi"
 )
 
+// DB is the database the handlers use. It must be set before serving
+// requests.
 var DB *sql.DB
 
-func init() {
-	DB = database.GetDB()
-}
-
 // GetTasks godoc
-// @Description Get a list of all tasks
+// @Description Get a list of all tasks in the caller's projects
 // @Tags tasks
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
+// @Param limit query int false "Maximum number of results, in order of ID; all of them when not given"
+// @Param after query int false "Only return results with a greater ID, such as the last ID of the previous page"
 // @Success 200 {array} models.Task
-// @Failure 500 {string} string "Internal server error"
+// @Failure 400 {object} problem.Details "Invalid limit or after"
+// @Failure 500 {object} problem.Details "Internal server error"
 // @Router /tasks [get]
 func GetTasks(w http.ResponseWriter, r *http.Request) {
-	repo := repositories.TaskRepo{DB: DB}
-	tasks, err := repo.GetTasks()
+	page, err := pageFromQuery(r)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	repo := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	tasks, err := repo.FindTasks(r.Context(), models.TaskFilter{MemberID: callerScope(r)}, page)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		serverError(w, r, "Internal server error", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -43,33 +53,47 @@ func GetTasks(w http.ResponseWriter, r *http.Request) {
 // @Tags tasks
 // @Accept json
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param task body models.Task true "Task data"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
 // @Success 201 {object} map[string]int
-// @Failure 400 {string} string "Invalid request"
-// @Failure 500 {string} string "Failed to create task"
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 403 {object} problem.Details "Viewers cannot create tasks"
+// @Failure 422 {object} problem.Details "Project not found or assignee is not a member of the project"
+// @Failure 500 {object} problem.Details "Failed to create task"
 // @Router /tasks [post]
 func CreateTask(w http.ResponseWriter, r *http.Request) {
 	var task models.Task
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
 	task.CreationDate = time.Now()
 	if task.CompletionDate.Before(task.CreationDate) && !task.CompletionDate.IsZero() {
-		http.Error(w, "Invalid completion date", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid completion date")
 		return
 	}
 	if task.CompletionDate.IsZero() {
 		task.CompletionDate = time.Now().AddDate(0, 1, 0)
 	}
+	if !checkAssignee(w, r, task.ProjectID, task.RespId) {
+		return
+	}
+	if !requireRole(w, r, task.ProjectID, http.StatusUnprocessableEntity, taskEditors) {
+		return
+	}
 
-	repo := repositories.TaskRepo{DB: DB}
-	id, err := repo.CreateTask(task)
+	repo := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	id, err := repo.CreateTask(r.Context(), task, auth.UserRef(r.Context()))
+	if clientError(w, r, err) {
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to create task", http.StatusInternalServerError)
+		serverError(w, r, "Failed to create task", err)
 		return
 	}
+	task.ID = id
 
 	response := map[string]int{"id": id}
 	w.Header().Set("Content-Type", "application/json")
@@ -81,23 +105,20 @@ func CreateTask(w http.ResponseWriter, r *http.Request) {
 // @Description Get task by ID
 // @Tags tasks
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param id path int true "Task ID"
+// @Param If-None-Match header string false "ETag of a cached copy"
 // @Success 200 {object} models.Task
-// @Failure 400 {string} string "Invalid ID"
-// @Failure 404 {string} string "Task not found"
+// @Success 304
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 404 {object} problem.Details "Task not found"
 // @Router /tasks/{id} [get]
 func GetTaskByID(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+	task, ok := taskFromURL(w, r)
+	if !ok {
 		return
 	}
-
-	repo := repositories.TaskRepo{DB: DB}
-	task, err := repo.GetTaskByID(id)
-	if err != nil {
-		http.Error(w, "Task not found", http.StatusNotFound)
+	if notModified(w, r, task.Version) {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -110,47 +131,158 @@ func GetTaskByID(w http.ResponseWriter, r *http.Request) {
 // @Tags tasks
 // @Accept json
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param id path int true "Task ID"
 // @Param task body models.Task true "Updated task data"
+// @Param If-Match header string false "ETag the update is based on"
 // @Success 200 {object} models.Task
-// @Failure 400 {string} string "Invalid request"
-// @Failure 404 {string} string "Task not found"
-// @Failure 500 {string} string "Failed to update task"
+// @Failure 400 {object} problem.Details "Invalid request"
+// @Failure 403 {object} problem.Details "Viewers cannot change tasks"
+// @Failure 404 {object} problem.Details "Task not found"
+// @Failure 412 {object} problem.Details "Task was modified"
+// @Failure 422 {object} problem.Details "Project not found or assignee is not a member of the project"
+// @Failure 428 {object} problem.Details "If-Match header is required"
+// @Failure 500 {object} problem.Details "Failed to update task"
 // @Router /tasks/{id} [put]
 func UpdateTask(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
 	var task models.Task
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
 	if task.CompletionDate.Before(time.Now()) && !task.CompletionDate.IsZero() {
-		http.Error(w, "Invalid completion date", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid completion date")
 		return
 	}
 	if task.CompletionDate.IsZero() {
 		task.CompletionDate = time.Now().AddDate(0, 1, 0)
 	}
 
-	repo := repositories.TaskRepo{DB: DB}
-	_, err = repo.GetTaskByID(id)
+	repo := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	current, err := repo.GetTaskByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	if !requireRole(w, r, current.ProjectID, http.StatusNotFound, taskEditors) {
+		return
+	}
+	expected, ok := checkIfMatch(w, r, current.Version)
+	if !ok {
+		return
+	}
+	if task.RespId != current.RespId || task.ProjectID != current.ProjectID {
+		if !checkAssignee(w, r, task.ProjectID, task.RespId) {
+			return
+		}
+	}
+	if task.ProjectID != current.ProjectID && !requireRole(w, r, task.ProjectID, http.StatusUnprocessableEntity, taskEditors) {
+		return
+	}
+
+	task.ID = id
+	task.CreationDate = current.CreationDate
+	task.Version, err = repo.UpdateTask(r.Context(), task, expected, auth.UserRef(r.Context()))
+	if clientError(w, r, err) {
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to update task", err)
+		return
+	}
+	setETag(w, task.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(task)
+}
+
+// PatchTask godoc
+// @Description Partially update a task with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902). Only the changed fields are written.
+// @Tags tasks
+// @Accept application/merge-patch+json,application/json-patch+json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Task ID"
+// @Param patch body object true "Merge patch or JSON Patch document"
+// @Param If-Match header string false "ETag the update is based on"
+// @Success 200 {object} models.Task
+// @Failure 400 {object} problem.Details "Invalid patch"
+// @Failure 403 {object} problem.Details "Viewers cannot change tasks"
+// @Failure 404 {object} problem.Details "Task not found"
+// @Failure 409 {object} problem.Details "JSON Patch test failed"
+// @Failure 412 {object} problem.Details "Task was modified"
+// @Failure 415 {object} problem.Details "Unsupported patch format"
+// @Failure 422 {object} problem.Details "Patched task is invalid or its assignee is not a member of the project"
+// @Failure 428 {object} problem.Details "If-Match header is required"
+// @Failure 500 {object} problem.Details "Failed to update task"
+// @Router /tasks/{id} [patch]
+func PatchTask(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Task not found", http.StatusNotFound)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
-	err = repo.UpdateTask(task)
+	repo := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	current, err := repo.GetTaskByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Failed to update task", http.StatusInternalServerError)
+		problem.Error(w, r, err)
+		return
+	}
+	if !requireRole(w, r, current.ProjectID, http.StatusNotFound, taskEditors) {
+		return
+	}
+	expected, ok := checkIfMatch(w, r, current.Version)
+	if !ok {
+		return
+	}
+
+	var task models.Task
+	if !applyPatch(w, r, current, &task) {
+		return
+	}
+	changes, err := changedFields(*current, task)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if _, ok := changes["completionDate"]; ok && task.CompletionDate.Before(time.Now()) {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid completion date")
+		return
+	}
+	if err := models.Validate(task); err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	_, respChanged := changes["respId"]
+	_, projectChanged := changes["projectId"]
+	if (respChanged || projectChanged) && !checkAssignee(w, r, task.ProjectID, task.RespId) {
+		return
+	}
+	if projectChanged && !requireRole(w, r, task.ProjectID, http.StatusUnprocessableEntity, taskEditors) {
 		return
 	}
+
+	if len(changes) > 0 {
+		task.Version, err = repo.PatchTask(r.Context(), id, changes, expected, auth.UserRef(r.Context()))
+		if clientError(w, r, err) {
+			return
+		}
+		if err != nil {
+			serverError(w, r, "Failed to update task", err)
+			return
+		}
+	}
+	setETag(w, task.Version)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(task)
@@ -160,83 +292,193 @@ func UpdateTask(w http.ResponseWriter, r *http.Request) {
 // @Description Delete a task by its unique ID
 // @Tags tasks
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param id path int true "Task ID"
+// @Param If-Match header string false "ETag the deletion is based on"
 // @Success 204
-// @Failure 404 {string} string "Task not found"
-// @Failure 500 {string} string "Failed to delete task"
+// @Failure 403 {object} problem.Details "Viewers cannot delete tasks"
+// @Failure 404 {object} problem.Details "Task not found"
+// @Failure 412 {object} problem.Details "Task was modified"
+// @Failure 428 {object} problem.Details "If-Match header is required"
+// @Failure 500 {object} problem.Details "Failed to delete task"
 // @Router /tasks/{id} [delete]
 func DeleteTask(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
-	repo := repositories.TaskRepo{DB: DB}
-	_, err = repo.GetTaskByID(id)
+	repo := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	current, err := repo.GetTaskByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Task not found", http.StatusNotFound)
+		problem.Error(w, r, err)
+		return
+	}
+	if !requireRole(w, r, current.ProjectID, http.StatusNotFound, taskEditors) {
+		return
+	}
+	expected, ok := checkIfMatch(w, r, current.Version)
+	if !ok {
 		return
 	}
 
-	err = repo.DeleteTask(id)
+	err = repo.DeleteTask(r.Context(), id, auth.UserRef(r.Context()), expected)
+	if clientError(w, r, err) {
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to delete task", http.StatusInternalServerError)
+		serverError(w, r, "Failed to delete task", err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// RestoreTask godoc
+// @Description Restore a deleted task from the trash
+// @Tags tasks
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.Task
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 403 {object} problem.Details "Viewers cannot restore tasks"
+// @Failure 404 {object} problem.Details "Task not found in trash"
+// @Failure 409 {object} problem.Details "Task's project is deleted"
+// @Failure 500 {object} problem.Details "Failed to restore task"
+// @Router /tasks/{id}/restore [post]
+func RestoreTask(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	repo := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	deleted, err := repo.GetDeletedTaskByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	if !requireRole(w, r, deleted.ProjectID, http.StatusNotFound, taskEditors) {
+		return
+	}
+	err = repo.RestoreTask(r.Context(), id)
+	if clientError(w, r, err) {
+		return
+	}
+	if err != nil {
+		serverError(w, r, "Failed to restore task", err)
+		return
+	}
+
+	task, err := repo.GetTaskByID(r.Context(), id)
+	if err != nil {
+		serverError(w, r, "Failed to restore task", err)
+		return
+	}
+	setETag(w, task.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(task)
+}
+
 // SearchTasksHandler godoc
-// @Description Search tasks based on criteria
+// @Description Search tasks based on criteria. All given criteria must match.
 // @Tags tasks
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
 // @Param title query string false "Title of the task"
 // @Param status query string false "Status of the task"
 // @Param priority query string false "Priority of the task"
 // @Param respId query string false "Assigned user ID"
 // @Param projectId query string false "Project ID"
+// @Param limit query int false "Maximum number of results, in order of ID; all of them when not given"
+// @Param after query int false "Only return results with a greater ID, such as the last ID of the previous page"
 // @Success 200 {array} models.Task
-// @Failure 500 {string} string "Failed to search tasks"
+// @Failure 400 {object} problem.Details "Invalid search criteria"
+// @Failure 500 {object} problem.Details "Failed to search tasks"
 // @Router /tasks/search [get]
 func SearchTasksHandler(w http.ResponseWriter, r *http.Request) {
-	title := r.URL.Query().Get("title")
-	status := r.URL.Query().Get("status")
-	priority := r.URL.Query().Get("priority")
-	respId := r.URL.Query().Get("respId")
-	projectId := r.URL.Query().Get("projectId")
-
-	var tasks []models.Task
-	var err error
-
-	repo := repositories.TaskRepo{DB: DB}
-
-	if title != "" {
-		tasks, err = repo.FindTasksByTitle(title)
-	} else if status != "" {
-		tasks, err = repo.FindTasksByStatus(status)
-	} else if priority != "" {
-		tasks, err = repo.FindTasksByPriority(priority)
-	} else if respId != "" {
-		assigneeID, _ := strconv.Atoi(respId)
-		tasks, err = repo.FindTasksByAssignedUserId(assigneeID)
-	} else if projectId != "" {
-		projectID, _ := strconv.Atoi(projectId)
-		tasks, err = repo.FindTasksByProject(projectID)
-	} else {
-		http.Error(w, "No search criteria provided", http.StatusBadRequest)
+	filter, err := taskFilterFromQuery(r)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.IsEmpty() {
+		problem.Write(w, r, http.StatusBadRequest, "No search criteria provided")
+		return
+	}
+	filter.MemberID = callerScope(r)
+	page, err := pageFromQuery(r)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	repo := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	tasks, err := repo.FindTasks(r.Context(), filter, page)
 	if err != nil {
-		http.Error(w, "Failed to search tasks: "+err.Error(), http.StatusInternalServerError)
+		serverError(w, r, "Failed to search tasks", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(tasks); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		serverError(w, r, "Failed to encode response", err)
+	}
+}
+
+// taskFromURL loads the task named by the {id} URL parameter, which must be
+// in a project the caller can see.
+func taskFromURL(w http.ResponseWriter, r *http.Request) (*models.Task, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
+		return nil, false
+	}
+
+	repo := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	task, err := repo.GetTaskByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return nil, false
+	}
+	visible, err := isVisibleProject(r, task.ProjectID)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return nil, false
+	}
+	if !visible {
+		problem.Write(w, r, http.StatusNotFound, "Task not found")
+		return nil, false
+	}
+	return task, true
+}
+
+func taskFilterFromQuery(r *http.Request) (models.TaskFilter, error) {
+	query := r.URL.Query()
+	filter := models.TaskFilter{
+		Title:    query.Get("title"),
+		Status:   query.Get("status"),
+		Priority: query.Get("priority"),
+	}
+	if value := query.Get("respId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, errors.New("invalid respId")
+		}
+		filter.RespId = id
+	}
+	if value := query.Get("projectId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, errors.New("invalid projectId")
+		}
+		filter.ProjectID = id
 	}
+	return filter, nil
 }
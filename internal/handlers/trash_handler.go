@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/allwsaa/project-api/internal/auth"
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/repositories"
+)
+
+type Trash struct {
+	Users    []models.User    `json:"users"`
+	Projects []models.Project `json:"projects"`
+	Tasks    []models.Task    `json:"tasks"`
+}
+
+// GetTrash godoc
+// @Description Get deleted users, projects and tasks that can still be restored. Callers get the projects they are a member of and their tasks; only organization admins get users and every project.
+// @Tags trash
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Success 200 {object} Trash
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /trash [get]
+func GetTrash(w http.ResponseWriter, r *http.Request) {
+	var trash Trash
+	var err error
+
+	if auth.IsOrgAdmin(r.Context()) {
+		users := repositories.UserRepo{DB: DB, OrgID: orgID(r)}
+		if trash.Users, err = users.GetDeletedUsers(r.Context()); err != nil {
+			serverError(w, r, "Internal server error", err)
+			return
+		}
+	}
+	projects := repositories.ProjectRepo{DB: DB, OrgID: orgID(r)}
+	if trash.Projects, err = projects.GetDeletedProjects(r.Context(), callerScope(r)); err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	tasks := repositories.TaskRepo{DB: DB, OrgID: orgID(r)}
+	if trash.Tasks, err = tasks.GetDeletedTasks(r.Context(), callerScope(r)); err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(trash)
+}
@@ -1,64 +1,94 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"time"
 
-	"github.com/allwsaa/project-api/database"
+	"github.com/allwsaa/project-api/internal/auth"
 	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/problem"
 	"github.com/allwsaa/project-api/internal/repositories"
 	"github.com/go-chi/chi"
 )
 
-var db *sql.DB
-var repository *repositories.UserRepo
+// userRepo returns a repository for the users of the caller's organization.
+func userRepo(r *http.Request) *repositories.UserRepo {
+	return &repositories.UserRepo{DB: DB, OrgID: orgID(r)}
+}
 
-func init() {
-	db = database.GetDB()
-	repository = &repositories.UserRepo{DB: db}
+// requireSelfOrAdmin answers 403 unless the caller is the user with the given
+// ID or an admin of their organization.
+func requireSelfOrAdmin(w http.ResponseWriter, r *http.Request, userID int) bool {
+	if callerID, _ := auth.UserID(r.Context()); callerID == userID {
+		return true
+	}
+	return requireOrgAdmin(w, r)
 }
 
 // GetAllUsers godoc
-// @Description Get a list of all users
+// @Description Get a list of all users of the caller's organization
 // @Tags users
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param limit query int false "Maximum number of results, in order of ID; all of them when not given"
+// @Param after query int false "Only return results with a greater ID, such as the last ID of the previous page"
 // @Success 200 {array} models.User
-// @Failure 500 {string} string "Internal server error"
+// @Failure 400 {object} problem.Details "Invalid limit or after"
+// @Failure 500 {object} problem.Details "Internal server error"
 // @Router /users [get]
 func GetAllUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := repository.GetAll()
+	page, err := pageFromQuery(r)
 	if err != nil {
-		http.Error(w, "Error occured", http.StatusInternalServerError)
+		problem.Write(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	repository := userRepo(r)
+	users, err := repository.GetAll(r.Context(), page)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
 		return
 	}
 	json.NewEncoder(w).Encode(users)
 }
 
 // CreateUser godoc
-// @Description Create a new user
+// @Description Create a new user in the caller's organization. Only organization admins can create users.
 // @Tags users
 // @Accept json
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param user body models.User true "User data"
+// @Param Idempotency-Key header string false "Key making retries of this request safe"
 // @Success 201 {object} models.User
-// @Failure 400 {string} string "Invalid input"
-// @Failure 500 {string} string "Internal server error"
+// @Failure 400 {object} problem.Details "Invalid input"
+// @Failure 403 {object} problem.Details "Only organization admins can do this"
+// @Failure 409 {object} problem.Details "A user with this email already exists in the organization"
+// @Failure 500 {object} problem.Details "Internal server error"
 // @Router /users [post]
 func CreateUser(w http.ResponseWriter, r *http.Request) {
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+	repository := userRepo(r)
+
 	var newUser models.User
 	if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid input")
 		return
 	}
 	newUser.RegistrationDate = time.Now()
 
-	id, err := repository.CreateUser(newUser)
+	id, err := repository.CreateUser(r.Context(), newUser)
+	if clientError(w, r, err) {
+		return
+	}
 	if err != nil {
-		http.Error(w, "Internal server error: "+err.Error(), http.StatusInternalServerError)
+		serverError(w, r, "Internal server error", err)
 		return
 	}
 
@@ -72,99 +102,274 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 // @Description Get a user by their ID
 // @Tags users
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param id path int true "User ID"
+// @Param If-None-Match header string false "ETag of a cached copy"
 // @Success 200 {object} models.User
-// @Failure 400 {string} string "Invalid ID"
-// @Failure 404 {string} string "User not found"
+// @Success 304
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 404 {object} problem.Details "User not found"
 // @Router /users/{id} [get]
 func GetUserByID(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		http.Error(w, "Couldn'tt find user with given ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid ID")
 		return
 	}
 
-	user, err := repository.GetUserByID(id)
+	repository := userRepo(r)
+	user, err := repository.GetUserByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		problem.Error(w, r, err)
+		return
+	}
+	if notModified(w, r, user.Version) {
 		return
 	}
 	json.NewEncoder(w).Encode(user)
 }
 
 // UpdateUser godoc
-// @Description Update user details by their unique ID
+// @Description Update user details by their unique ID. Users can update themselves; organization admins can update anyone in the organization.
 // @Tags users
 // @Accept json
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param id path int true "User ID"
 // @Param user body models.User true "Updated user data"
-// @Success 200 {object} models.User
-// @Failure 400 {string} string "Invalid input"
-// @Failure 404 {string} string "User not found"
-// @Failure 500 {string} string "Internal server error"
+// @Param If-Match header string false "ETag the update is based on"
+// @Success 204
+// @Failure 400 {object} problem.Details "Invalid input"
+// @Failure 403 {object} problem.Details "Only organization admins can do this"
+// @Failure 404 {object} problem.Details "User not found"
+// @Failure 409 {object} problem.Details "A user with this email already exists in the organization"
+// @Failure 412 {object} problem.Details "User was modified"
+// @Failure 428 {object} problem.Details "If-Match header is required"
+// @Failure 500 {object} problem.Details "Internal server error"
 // @Router /users/{id} [put]
 func UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if !requireSelfOrAdmin(w, r, id) {
+		return
+	}
+
 	var user models.User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	repository := userRepo(r)
+	current, err := repository.GetUserByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	expected, ok := checkIfMatch(w, r, current.Version)
+	if !ok {
 		return
 	}
 
-	if err := repository.UpdateUser(user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	user.ID = id
+	user.RegistrationDate = current.RegistrationDate
+	version, err := repository.UpdateUser(r.Context(), user, expected)
+	if clientError(w, r, err) {
 		return
 	}
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	setETag(w, version)
 	w.WriteHeader(http.StatusNoContent)
 
 }
 
+// PatchUser godoc
+// @Description Partially update a user with a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902). Only the changed fields are written. Users can update themselves; organization admins can update anyone in the organization.
+// @Tags users
+// @Accept application/merge-patch+json,application/json-patch+json
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "User ID"
+// @Param patch body object true "Merge patch or JSON Patch document"
+// @Param If-Match header string false "ETag the update is based on"
+// @Success 200 {object} models.User
+// @Failure 400 {object} problem.Details "Invalid patch"
+// @Failure 403 {object} problem.Details "Only organization admins can do this"
+// @Failure 404 {object} problem.Details "User not found"
+// @Failure 409 {object} problem.Details "JSON Patch test failed, or a user with this email already exists in the organization"
+// @Failure 412 {object} problem.Details "User was modified"
+// @Failure 415 {object} problem.Details "Unsupported patch format"
+// @Failure 422 {object} problem.Details "Patched user is invalid"
+// @Failure 428 {object} problem.Details "If-Match header is required"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /users/{id} [patch]
+func PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if !requireSelfOrAdmin(w, r, id) {
+		return
+	}
+
+	repository := userRepo(r)
+	current, err := repository.GetUserByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	expected, ok := checkIfMatch(w, r, current.Version)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if !applyPatch(w, r, current, &user) {
+		return
+	}
+	changes, err := changedFields(*current, user)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err := models.Validate(user); err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if len(changes) > 0 {
+		user.Version, err = repository.PatchUser(r.Context(), id, changes, expected)
+		if clientError(w, r, err) {
+			return
+		}
+		if err != nil {
+			serverError(w, r, "Internal server error", err)
+			return
+		}
+	}
+	setETag(w, user.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
 // DeleteUser godoc
-// @Description Delete a user by their unique ID
+// @Description Delete a user by their unique ID. Only organization admins can delete users, and the last admin cannot be deleted.
 // @Tags users
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param id path int true "User ID"
+// @Param If-Match header string false "ETag the deletion is based on"
 // @Success 204
-// @Failure 400 {string} string "Invalid ID"
-// @Failure 404 {string} string "User not found"
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 403 {object} problem.Details "Only organization admins can do this"
+// @Failure 404 {object} problem.Details "User not found"
+// @Failure 409 {object} problem.Details "Organization must keep at least one admin"
+// @Failure 412 {object} problem.Details "User was modified"
+// @Failure 428 {object} problem.Details "If-Match header is required"
 // @Router /users/{id} [delete]
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if !requireOrgAdmin(w, r) {
 		return
 	}
 
-	if err := repository.DeleteUser(id); err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusNotFound)
+	repository := userRepo(r)
+	current, err := repository.GetUserByID(r.Context(), id)
+	if err != nil {
+		problem.Error(w, r, err)
+		return
+	}
+	expected, ok := checkIfMatch(w, r, current.Version)
+	if !ok {
+		return
+	}
+
+	if err := repository.DeleteUser(r.Context(), id, auth.UserRef(r.Context()), expected); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			problem.Write(w, r, http.StatusNotFound, "User not found")
+			return
+		}
+		if clientError(w, r, err) {
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, "Internal server error", err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// RestoreUser godoc
+// @Description Restore a deleted user from the trash. Only organization admins can restore users.
+// @Tags users
+// @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 403 {object} problem.Details "Only organization admins can do this"
+// @Failure 404 {object} problem.Details "User not found in trash"
+// @Failure 500 {object} problem.Details "Internal server error"
+// @Router /users/{id}/restore [post]
+func RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if !requireOrgAdmin(w, r) {
+		return
+	}
+
+	repository := userRepo(r)
+	if err := repository.RestoreUser(r.Context(), id); err != nil {
+		if clientError(w, r, err) {
+			return
+		}
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+
+	user, err := repository.GetUserByID(r.Context(), id)
+	if err != nil {
+		serverError(w, r, "Internal server error", err)
+		return
+	}
+	setETag(w, user.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
 // GetTasksByUserID godoc
 // @Description Get a list of tasks assigned to a user by their ID
 // @Tags tasks
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID; results are limited to the caller's projects"
 // @Param id path int true "User ID"
 // @Success 200 {array} models.Task
-// @Failure 400 {string} string "Invalid ID"
-// @Failure 404 {string} string "Tasks not found"
+// @Failure 400 {object} problem.Details "Invalid ID"
+// @Failure 404 {object} problem.Details "Tasks not found"
 // @Router /users/{id}/tasks [get]
 func GetTasksByUserID(w http.ResponseWriter, r *http.Request) {
 	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
-	tasks, err := repository.GetTasksByUserID(userID)
+	tasks, err := userRepo(r).GetTasksByUserID(r.Context(), userID, callerScope(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, "Internal server error", err)
 		return
 	}
 
@@ -172,25 +377,35 @@ func GetTasksByUserID(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(tasks)
 }
 
+// FindUsers serves /users/search: it searches by email when the email
+// parameter is given and by name otherwise.
+func FindUsers(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("email") {
+		FindUsersByEmail(w, r)
+		return
+	}
+	FindUsersByName(w, r)
+}
+
 // FindUsersByName godoc
 // @Description Find users by their name
 // @Tags users
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param name query string true "Name of the user"
 // @Success 200 {array} models.User
-// @Failure 400 {string} string "Invalid input"
+// @Failure 400 {object} problem.Details "Invalid input"
 // @Router /users/search [get]
 func FindUsersByName(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Query().Get("name")
 	if name == "" {
-		http.Error(w, "Name parameter is required", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Parameter name is required")
 		return
 	}
 
-	repository := repositories.UserRepo{DB: db}
-	users, err := repository.FindUsersByName(name)
+	users, err := userRepo(r).FindUsersByName(r.Context(), name)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, "Internal server error", err)
 		return
 	}
 
@@ -202,21 +417,21 @@ func FindUsersByName(w http.ResponseWriter, r *http.Request) {
 // @Description Find users by their email address
 // @Tags users
 // @Produce json
+// @Param X-User-ID header int true "Caller's user ID"
 // @Param email query string true "Email address of the user"
 // @Success 200 {array} models.User
-// @Failure 400 {string} string "Invalid input"
+// @Failure 400 {object} problem.Details "Invalid input"
 // @Router /users/search [get]
 func FindUsersByEmail(w http.ResponseWriter, r *http.Request) {
 	email := r.URL.Query().Get("email")
 	if email == "" {
-		http.Error(w, "Email is required", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, "Parameter email is required")
 		return
 	}
 
-	repository := repositories.UserRepo{DB: db}
-	users, err := repository.FindUsersByEmail(email)
+	users, err := userRepo(r).FindUsersByEmail(r.Context(), email)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		serverError(w, r, "Internal server error", err)
 		return
 	}
 
@@ -0,0 +1,187 @@
+// Package health answers the probes of the platform running the server:
+// whether the process is alive, whether it is ready to serve requests, and,
+// for admins, the state of each of its dependencies.
+package health
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/problem"
+)
+
+// Checker checks the dependencies the server needs to serve requests.
+type Checker struct {
+	DB *sql.DB
+	// Timeout bounds each check of the database.
+	Timeout time.Duration
+	// SchemaVersion returns the newest migration applied to the database,
+	// which must be at least ExpectedSchema.
+	SchemaVersion  func(context.Context) (int, error)
+	ExpectedSchema int
+	// Workers reports the background workers that are running and those
+	// that have stopped, which they only do on shutdown.
+	Workers interface {
+		Status() (running, stopped []string)
+	}
+
+	started  time.Time
+	draining atomic.Bool
+}
+
+// Start records when the server started, for the uptime in the report.
+func (c *Checker) Start() {
+	c.started = time.Now()
+}
+
+// Drain makes the server report that it is not ready, so that no new
+// requests are sent to it while it shuts down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Report is the detailed health of the server.
+type Report struct {
+	Status   string           `json:"status"`
+	Draining bool             `json:"draining"`
+	Uptime   string           `json:"uptime"`
+	Checks   map[string]Check `json:"checks"`
+}
+
+// Check is the state of one dependency. Details depend on the check.
+type Check struct {
+	Status  string         `json:"status"`
+	Error   string         `json:"error,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// Check checks every dependency.
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{
+		Status:   statusOK,
+		Draining: c.draining.Load(),
+		Uptime:   time.Since(c.started).Round(time.Second).String(),
+		Checks: map[string]Check{
+			"database":   c.checkDatabase(ctx),
+			"migrations": c.checkMigrations(ctx),
+			"workers":    c.checkWorkers(),
+		},
+	}
+	if report.Draining {
+		report.Status = statusUnavailable
+	}
+	for _, check := range report.Checks {
+		if check.Status != statusOK {
+			report.Status = statusUnavailable
+		}
+	}
+	return report
+}
+
+func (c *Checker) checkDatabase(ctx context.Context) Check {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.DB.PingContext(ctx)
+	stats := c.DB.Stats()
+	return result(err, map[string]any{
+		"latency_ms":       time.Since(start).Milliseconds(),
+		"open_connections": stats.OpenConnections,
+		"in_use":           stats.InUse,
+		"idle":             stats.Idle,
+		"wait_count":       stats.WaitCount,
+	})
+}
+
+func (c *Checker) checkMigrations(ctx context.Context) Check {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	applied, err := c.SchemaVersion(ctx)
+	if err == nil && applied < c.ExpectedSchema {
+		err = fmt.Errorf("schema is at migration %d, want %d", applied, c.ExpectedSchema)
+	}
+	return result(err, map[string]any{"applied": applied, "expected": c.ExpectedSchema})
+}
+
+func (c *Checker) checkWorkers() Check {
+	running, stopped := c.Workers.Status()
+	var err error
+	if len(stopped) > 0 {
+		err = fmt.Errorf("stopped: %s", strings.Join(stopped, ", "))
+	}
+	return result(err, map[string]any{"running": running, "stopped": stopped})
+}
+
+func result(err error, details map[string]any) Check {
+	if err != nil {
+		return Check{Status: statusUnavailable, Error: err.Error(), Details: details}
+	}
+	return Check{Status: statusOK, Details: details}
+}
+
+// Live answers 200 as long as the process can serve HTTP at all.
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok\n"))
+}
+
+// Ready answers 200 when the server can serve requests, and 503 listing the
+// failed checks when it cannot or is shutting down.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	report := c.Check(r.Context())
+	if report.Status == statusOK {
+		w.Write([]byte("ok\n"))
+		return
+	}
+	var reasons []string
+	for name, check := range report.Checks {
+		if check.Status != statusOK {
+			reasons = append(reasons, name+": "+check.Error)
+		}
+	}
+	sort.Strings(reasons)
+	if report.Draining {
+		reasons = append([]string{"shutting down"}, reasons...)
+	}
+	http.Error(w, strings.Join(reasons, "\n"), http.StatusServiceUnavailable)
+}
+
+// Handler serves the detailed Report as JSON, with status 503 when the
+// server is not ready. Unless token is empty, requests must carry it as a
+// bearer token.
+func (c *Checker) Handler(token string) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check(r.Context())
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != statusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+	if token == "" {
+		return handler
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			problem.Write(w, r, http.StatusUnauthorized, "Missing or invalid health token")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,228 @@
+// Package idempotency lets clients retry POST requests safely: a request
+// carrying an Idempotency-Key header is carried out once, and retries with
+// the same key get the first response again.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/ratelimit"
+	"github.com/allwsaa/project-api/internal/tracing"
+)
+
+// Header carries the key chosen by the client, typically a UUID.
+const Header = "Idempotency-Key"
+
+// maxKeyLength is the longest key accepted.
+const maxKeyLength = 255
+
+// lockTimeout is how long a request may hold a key before it is considered
+// abandoned, for example because the instance running it crashed, and a
+// retry may claim the key again.
+const lockTimeout = time.Minute
+
+// replayedHeaders are the response headers stored and sent again on replay.
+// Headers set by middleware in front, such as the rate limit ones, describe
+// the retry rather than the first request and are left out.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// Store keeps responses in the idempotency_keys table, shared by every
+// instance of the API, for Window after the first request.
+type Store struct {
+	DB     *sql.DB
+	Window time.Duration
+}
+
+// Middleware makes POST requests with an Idempotency-Key header idempotent.
+// Keys belong to the client that sent them, identified like for rate
+// limiting. A retry with the same key and request gets the stored response
+// with an Idempotent-Replayed header; the same key with a different request,
+// or while the first one is still running, gets 409. Responses with a 5xx
+// status are not stored, so that the request can be retried.
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			problem.Write(w, r, http.StatusBadRequest, "Idempotency-Key must be at most "+strconv.Itoa(maxKeyLength)+" characters")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "Invalid request")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		client := ratelimit.ClientKey(r)
+		fingerprint := fingerprint(r, body)
+		claimed, err := s.claim(r.Context(), client, key, fingerprint)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error claiming idempotency key", "err", err)
+			problem.Write(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if !claimed {
+			s.replay(w, r, client, key, fingerprint)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		done := false
+		defer func() {
+			// The handler panicked or failed: let a retry run it again.
+			if !done {
+				if err := s.release(client, key); err != nil {
+					slog.ErrorContext(r.Context(), "Error releasing idempotency key", "err", err)
+				}
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		if rec.status >= 500 {
+			return
+		}
+		if err := s.save(client, key, rec); err != nil {
+			slog.ErrorContext(r.Context(), "Error saving idempotent response", "err", err)
+			return
+		}
+		done = true
+	})
+}
+
+// claim records that a request with the key has started. It fails to claim
+// a key that is in use, unless it has expired or was abandoned.
+func (s *Store) claim(ctx context.Context, client, key, fingerprint string) (bool, error) {
+	ctx = tracing.WithStatementName(ctx, "idempotency.Store.claim")
+	var claimed bool
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (client, key, fingerprint, created_at, expires_at)
+		VALUES ($1, $2, $3, now(), now() + $4 * interval '1 second')
+		ON CONFLICT (client, key) DO UPDATE SET
+			fingerprint = EXCLUDED.fingerprint, status = NULL, headers = NULL, body = NULL,
+			created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < now()
+			OR (idempotency_keys.status IS NULL AND idempotency_keys.created_at < now() - $5 * interval '1 second')
+		RETURNING true`,
+		client, key, fingerprint, s.Window.Seconds(), lockTimeout.Seconds()).Scan(&claimed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return claimed, err
+}
+
+func (s *Store) replay(w http.ResponseWriter, r *http.Request, client, key, fingerprint string) {
+	// status is NULL while the first request is still running.
+	var stored string
+	var status sql.NullInt64
+	var headers, body []byte
+	ctx := tracing.WithStatementName(r.Context(), "idempotency.Store.replay")
+	err := s.DB.QueryRowContext(ctx, "SELECT fingerprint, status, headers, body FROM idempotency_keys WHERE client = $1 AND key = $2", client, key).
+		Scan(&stored, &status, &headers, &body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error loading idempotent response", "err", err)
+		problem.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if stored != fingerprint {
+		problem.Write(w, r, http.StatusConflict, "Idempotency-Key was already used for a different request")
+		return
+	}
+	if !status.Valid {
+		problem.Write(w, r, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+		return
+	}
+	var replayed http.Header
+	if err := json.Unmarshal(headers, &replayed); err != nil {
+		slog.ErrorContext(r.Context(), "Error loading idempotent response", "err", err)
+		problem.Write(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	for name, values := range replayed {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(int(status.Int64))
+	w.Write(body)
+}
+
+// save and release run outside the request's context, so that they still
+// complete when the client has gone away.
+func (s *Store) save(client, key string, rec *recorder) error {
+	headers := make(http.Header)
+	for _, name := range replayedHeaders {
+		if values := rec.Header().Values(name); len(values) > 0 {
+			headers[name] = values
+		}
+	}
+	encoded, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec("UPDATE idempotency_keys SET status = $3, headers = $4, body = $5 WHERE client = $1 AND key = $2",
+		client, key, rec.status, encoded, rec.body.Bytes())
+	return err
+}
+
+func (s *Store) release(client, key string) error {
+	_, err := s.DB.Exec("DELETE FROM idempotency_keys WHERE client = $1 AND key = $2 AND status IS NULL", client, key)
+	return err
+}
+
+// Run deletes expired keys, once per interval.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ctx = tracing.WithStatementName(ctx, "idempotency.Store.Run")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < now()"); err != nil {
+			slog.ErrorContext(ctx, "Error deleting expired idempotency keys", "err", err)
+		}
+	}
+}
+
+// fingerprint identifies a request by its method, URL and body, which must
+// all match for a retry to be replayed.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder passes a response through while keeping a copy of it.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/repositories"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectTimeout bounds the queries of a scrape, which Prometheus gives up on
+// after 10 seconds by default.
+const collectTimeout = 5 * time.Second
+
+// taskCollector counts open and overdue tasks when metrics are scraped.
+type taskCollector struct {
+	repo    repositories.StatsRepo
+	open    *prometheus.Desc
+	overdue *prometheus.Desc
+}
+
+func newTaskCollector(db *sql.DB) *taskCollector {
+	return &taskCollector{
+		repo: repositories.StatsRepo{DB: db},
+		open: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "open_tasks"),
+			"Tasks that are not done, by status and priority.",
+			[]string{"status", "priority"}, nil),
+		overdue: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "overdue_tasks"),
+			"Tasks that are not done and past their completion date.",
+			nil, nil),
+	}
+}
+
+func (c *taskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.open
+	ch <- c.overdue
+}
+
+// Collect leaves out the metrics it cannot query, so that a database outage
+// shows as missing task counts rather than as zero.
+func (c *taskCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	counts, err := c.repo.CountOpenTasks(ctx)
+	if err != nil {
+		slog.Error("Error counting open tasks", "err", err)
+	} else {
+		for _, count := range counts {
+			ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(count.Count), count.Status, count.Priority)
+		}
+	}
+
+	overdue, err := c.repo.CountOverdueTasks(ctx, time.Now())
+	if err != nil {
+		slog.Error("Error counting overdue tasks", "err", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.overdue, prometheus.GaugeValue, float64(overdue))
+}
@@ -3,30 +3,177 @@ package models
 import "time"
 
 type User struct {
-	ID               int       `json:"id" readonly:"true"`
-	Name             string    `json:"name" validate:"required"`
-	Email            string    `json:"email" validate:"required,email" example:"string@gmail.com"`
-	RegistrationDate time.Time `json:"registrationDate" readonly:"true"`
-	Role             string    `json:"role" validate:"required"`
+	ID               int        `json:"id" readonly:"true"`
+	Name             string     `json:"name" validate:"required"`
+	Email            string     `json:"email" validate:"required,email" example:"string@gmail.com"`
+	RegistrationDate time.Time  `json:"registrationDate" readonly:"true"`
+	Role             string     `json:"role" validate:"required"`
+	OrgID            int        `json:"orgId" readonly:"true"`
+	OrgRole          string     `json:"orgRole" readonly:"true" example:"member"`
+	Version          int        `json:"version" readonly:"true"`
+	DeletedAt        *time.Time `json:"deletedAt,omitempty" readonly:"true"`
+	DeletedBy        *int       `json:"deletedBy,omitempty" readonly:"true"`
+}
+
+// Organization roles. Admins manage the organization's users and see and
+// manage all of its projects; members only see the projects they belong to.
+const (
+	OrgAdmin  = "admin"
+	OrgMember = "member"
+)
+
+// Organization is a tenant. Every user and project belongs to exactly one
+// organization and nothing is shared between organizations.
+type Organization struct {
+	ID        int       `json:"id" readonly:"true"`
+	Name      string    `json:"name" validate:"required" example:"Acme"`
+	CreatedAt time.Time `json:"createdAt" readonly:"true"`
+}
+
+// OrgRoleChange sets a user's role in their organization.
+type OrgRoleChange struct {
+	OrgRole string `json:"orgRole" validate:"oneof=admin member" example:"admin"`
 }
 
 type Task struct {
-	ID             int       `json:"id" readonly:"true"`
-	Title          string    `json:"title" validate:"required"`
-	Description    string    `json:"description"`
-	Priority       string    `json:"priority" validate:"oneof=low medium high"`
-	Status         string    `json:"status" validate:"oneof=new inprogress done"`
-	RespId         int       `json:"respId" validate:"required" example:"1"`
-	ProjectID      int       `json:"projectId"`
-	CreationDate   time.Time `json:"creationDate" readonly:"true"`
-	CompletionDate time.Time `json:"completionDate" example:"2024-09-20T15:04:05Z"`
+	ID             int        `json:"id" readonly:"true"`
+	Title          string     `json:"title" validate:"required"`
+	Description    string     `json:"description"`
+	Priority       string     `json:"priority" validate:"oneof=low medium high"`
+	Status         string     `json:"status" validate:"oneof=new inprogress done"`
+	RespId         int        `json:"respId" validate:"required" example:"1"`
+	ProjectID      int        `json:"projectId"`
+	CreationDate   time.Time  `json:"creationDate" readonly:"true"`
+	CompletionDate time.Time  `json:"completionDate" example:"2024-09-20T15:04:05Z"`
+	Version        int        `json:"version" readonly:"true"`
+	DeletedAt      *time.Time `json:"deletedAt,omitempty" readonly:"true"`
+	DeletedBy      *int       `json:"deletedBy,omitempty" readonly:"true"`
+	// RecurringTaskID and Occurrence are set on tasks created from a
+	// recurring task, Occurrence being the scheduled date they stand for.
+	RecurringTaskID *int       `json:"recurringTaskId,omitempty" readonly:"true"`
+	Occurrence      *time.Time `json:"occurrence,omitempty" readonly:"true"`
+}
+
+// TaskFilter selects tasks by any combination of the /tasks/search criteria.
+// Zero-valued fields are ignored, so an empty filter matches every task.
+// MemberID is not a search criterion: when set it limits the results to the
+// projects that user is a member of.
+type TaskFilter struct {
+	Title     string `json:"title,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Priority  string `json:"priority,omitempty"`
+	RespId    int    `json:"respId,omitempty"`
+	ProjectID int    `json:"projectId,omitempty"`
+	MemberID  int    `json:"-"`
+}
+
+// IsEmpty reports whether the filter has no search criteria.
+func (f TaskFilter) IsEmpty() bool {
+	f.MemberID = 0
+	return f == TaskFilter{}
+}
+
+// Page selects part of a list ordered by ID: the items with an ID greater
+// than After, at most Limit of them. A zero Limit selects them all.
+type Page struct {
+	Limit int
+	After int
 }
 
 type Project struct {
-	ID                 int       `json:"id"  readonly:"true"`
-	ProjectTitle       string    `json:"projectTitle" validate:"required"`
-	ProjectDescription string    `json:"projectDescription"`
-	Started            time.Time `json:"started" readonly:"true"`
-	Completed          time.Time `json:"completed"  example:"2024-09-20T15:04:05Z"`
-	ManagerId          int       `json:"managerId" validate:"required" example:"1"`
+	ID                 int        `json:"id"  readonly:"true"`
+	ProjectTitle       string     `json:"projectTitle" validate:"required"`
+	ProjectDescription string     `json:"projectDescription"`
+	Started            time.Time  `json:"started" readonly:"true"`
+	Completed          time.Time  `json:"completed"  example:"2024-09-20T15:04:05Z"`
+	ManagerId          int        `json:"managerId" validate:"required" example:"1"`
+	Version            int        `json:"version" readonly:"true"`
+	DeletedAt          *time.Time `json:"deletedAt,omitempty" readonly:"true"`
+	DeletedBy          *int       `json:"deletedBy,omitempty" readonly:"true"`
+}
+
+// SavedFilter is a named TaskFilter. It is private to its owner unless it is
+// shared with a project.
+type SavedFilter struct {
+	ID        int        `json:"id" readonly:"true"`
+	Name      string     `json:"name" validate:"required"`
+	OwnerID   int        `json:"ownerId" readonly:"true"`
+	ProjectID *int       `json:"projectId,omitempty"`
+	Criteria  TaskFilter `json:"criteria"`
+	CreatedAt time.Time  `json:"createdAt" readonly:"true"`
+}
+
+// RecurringTask is a template from which a task is created for each
+// occurrence of RRule, a subset of the iCalendar recurrence rule format such
+// as "FREQ=WEEKLY;BYDAY=MO". Occurrences are computed in TimeZone, starting
+// at StartsAt, and each task is due at its occurrence.
+type RecurringTask struct {
+	ID             int        `json:"id" readonly:"true"`
+	Title          string     `json:"title" validate:"required"`
+	Description    string     `json:"description"`
+	Priority       string     `json:"priority" validate:"oneof=low medium high"`
+	RespId         int        `json:"respId" validate:"required" example:"1"`
+	ProjectID      int        `json:"projectId" validate:"required" example:"1"`
+	RRule          string     `json:"rrule" validate:"required" example:"FREQ=WEEKLY;BYDAY=MO"`
+	TimeZone       string     `json:"timeZone" example:"Europe/Berlin"`
+	StartsAt       time.Time  `json:"startsAt" example:"2024-09-02T09:00:00Z"`
+	NextOccurrence *time.Time `json:"nextOccurrence,omitempty" readonly:"true"`
+	CreatedAt      time.Time  `json:"createdAt" readonly:"true"`
+}
+
+// Occurrence is one scheduled date of a recurring task. Status is scheduled,
+// skipped or materialized, in which case TaskID is the task created for it.
+type Occurrence struct {
+	Occurrence time.Time `json:"occurrence"`
+	Status     string    `json:"status"`
+	TaskID     *int      `json:"taskId,omitempty"`
+}
+
+// Notification tells a user about a task's due date. Kind is reminder (the
+// task is due within Threshold), overdue, or escalation (sent to the project
+// manager once the task is overdue by more than Threshold).
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userId"`
+	TaskID    int        `json:"taskId"`
+	Kind      string     `json:"kind" example:"reminder"`
+	Threshold string     `json:"threshold" example:"24h"`
+	DueAt     time.Time  `json:"dueAt"`
+	Message   string     `json:"message"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ReadAt    *time.Time `json:"readAt,omitempty"`
+}
+
+// Comment is a note on a task. Members of the task's project named in Body
+// as @name, by their name or the part of their email before the @, are
+// emailed about it.
+type Comment struct {
+	ID        int       `json:"id" readonly:"true"`
+	TaskID    int       `json:"taskId" readonly:"true"`
+	AuthorID  *int      `json:"authorId,omitempty" readonly:"true"`
+	Body      string    `json:"body" validate:"required" example:"@ada can you review this?"`
+	CreatedAt time.Time `json:"createdAt" readonly:"true"`
+}
+
+// NotificationPreferences says how a user wants to be emailed: immediately,
+// in a daily digest, or not at all.
+type NotificationPreferences struct {
+	Email string `json:"email" validate:"oneof=immediate digest off" example:"immediate"`
+}
+
+// Project roles, from most to least privileged. Owners and maintainers manage
+// members, but only owners can make someone an owner. Viewers cannot be
+// assigned tasks.
+const (
+	RoleOwner       = "owner"
+	RoleMaintainer  = "maintainer"
+	RoleContributor = "contributor"
+	RoleViewer      = "viewer"
+)
+
+type ProjectMember struct {
+	ProjectID int       `json:"projectId" readonly:"true"`
+	UserID    int       `json:"userId" readonly:"true"`
+	Role      string    `json:"role" validate:"oneof=owner maintainer contributor viewer"`
+	AddedAt   time.Time `json:"addedAt" readonly:"true"`
 }
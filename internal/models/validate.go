@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		return name
+	})
+	return v
+}
+
+// Validate checks a model against the rules in its validate tags and
+// describes every violation using the fields' JSON names.
+func Validate(model any) error {
+	return describe(validate.Struct(model))
+}
+
+// ValidateFields is like Validate but only checks the named struct fields.
+func ValidateFields(model any, fields ...string) error {
+	return describe(validate.StructPartial(model, fields...))
+}
+
+func describe(err error) error {
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return err
+	}
+
+	messages := make([]string, len(fieldErrors))
+	for i, fe := range fieldErrors {
+		switch fe.Tag() {
+		case "required":
+			messages[i] = fmt.Sprintf("%s is required", fe.Field())
+		case "email":
+			messages[i] = fmt.Sprintf("%s must be a valid email address", fe.Field())
+		case "oneof":
+			messages[i] = fmt.Sprintf("%s must be one of: %s", fe.Field(), strings.ReplaceAll(fe.Param(), " ", ", "))
+		default:
+			messages[i] = fmt.Sprintf("%s is invalid", fe.Field())
+		}
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
@@ -0,0 +1,90 @@
+// Package notify renders and delivers email notifications.
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Message is a rendered email with a plain-text and an HTML body.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Notifier delivers messages. Send returns an error if the message may not
+// have been delivered, in which case it will be retried. It gives up when
+// ctx is done.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogNotifier only logs messages. It is used when no SMTP server is
+// configured.
+type LogNotifier struct{}
+
+func (LogNotifier) Send(ctx context.Context, msg Message) error {
+	slog.Info("Email", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
+
+// Email preferences, set per user.
+const (
+	PreferenceImmediate = "immediate"
+	PreferenceDigest    = "digest"
+	PreferenceOff       = "off"
+)
+
+// Event types. Each has a <event>.txt and <event>.html template.
+const (
+	EventTaskAssigned = "task_assigned"
+	EventMentioned    = "mentioned"
+	EventDigest       = "digest"
+)
+
+// TaskAssigned is the payload of a task_assigned event.
+type TaskAssigned struct {
+	TaskID      int       `json:"taskId"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ProjectID   int       `json:"projectId"`
+	DueAt       time.Time `json:"dueAt"`
+	AssignedBy  string    `json:"assignedBy,omitempty"`
+}
+
+// Mentioned is the payload of a mentioned event, sent to a user named in a
+// comment on a task.
+type Mentioned struct {
+	TaskID      int    `json:"taskId"`
+	Title       string `json:"title"`
+	CommentID   int    `json:"commentId"`
+	Comment     string `json:"comment"`
+	MentionedBy string `json:"mentionedBy,omitempty"`
+}
+
+// Recipient is who an email goes to.
+type Recipient struct {
+	Name  string
+	Email string
+}
+
+// Event holds the payload of one event. Exactly one of its fields is set.
+type Event struct {
+	TaskAssigned *TaskAssigned
+	Mentioned    *Mentioned
+}
+
+// Notification is the template data of an email about a single event.
+type Notification struct {
+	Recipient
+	Event
+}
+
+// Digest is the template data of a daily digest.
+type Digest struct {
+	Recipient
+	Items []Event
+}
@@ -0,0 +1,100 @@
+// Package problem answers failed requests with RFC 7807 problem details, as
+// application/problem+json.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/allwsaa/project-api/internal/apperr"
+	"github.com/allwsaa/project-api/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// Details describes why a request failed. Type is always about:blank, so
+// Title is the text of Status; Detail explains this occurrence. RequestID
+// and TraceID find the request's log lines and trace.
+type Details struct {
+	Type      string `json:"type" example:"about:blank"`
+	Title     string `json:"title" example:"Not Found"`
+	Status    int    `json:"status" example:"404"`
+	Detail    string `json:"detail,omitempty" example:"Task not found"`
+	Instance  string `json:"instance,omitempty" example:"/tasks/42"`
+	RequestID string `json:"requestId,omitempty" example:"3f2a9c1e5b7d4e60a1b2c3d4e5f60718"`
+	TraceID   string `json:"traceId,omitempty" example:"4bf92f3577b34da6a3ce929d0e0e4736"`
+}
+
+// Write answers r with the given status, explained by detail.
+func Write(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Details{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: logging.RequestID(r.Context()),
+		TraceID:   traceID(r),
+	})
+}
+
+// traceID returns the ID of the trace r is served in, or "". It is read from
+// the span rather than with tracing.TraceID, which would make the client,
+// which decodes Details, depend on the OpenTelemetry SDK.
+func traceID(r *http.Request) string {
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// Error answers r with the problem err describes. An *apperr.Error gives the
+// status and the detail. Any other error, or an internal *apperr.Error, is
+// logged with the request and answered with a 500 that does not reveal it.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	var e *apperr.Error
+	if !errors.As(err, &e) {
+		e = apperr.Wrap(apperr.Internal, "Internal server error", err)
+	}
+	if e.Kind == apperr.Internal {
+		slog.ErrorContext(r.Context(), e.Message, "err", e.Err)
+	}
+	Write(w, r, e.Kind.Status(), e.Message)
+}
+
+// Recoverer answers requests whose handler panicked with a 500, after logging
+// the panic and its stack.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			slog.ErrorContext(r.Context(), "Handler panicked", "panic", v, "stack", string(debug.Stack()))
+			Write(w, r, http.StatusInternalServerError, "Internal server error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NotFound answers requests for paths the API does not serve.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusNotFound, "No such endpoint")
+}
+
+// MethodNotAllowed answers requests with a method the path does not support.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+}
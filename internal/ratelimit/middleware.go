@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/auth"
+	"github.com/allwsaa/project-api/internal/problem"
+)
+
+// Limiter limits requests per client. Each route group limited through it
+// has its own buckets. A Limiter without a Store limits nothing.
+type Limiter struct {
+	Store Store
+}
+
+// Limit returns middleware allowing each client limit requests to the routes
+// it is applied to, under the bucket group name. Responses carry the
+// RateLimit-* headers; refused requests get 429 and Retry-After. If the
+// store fails the request is let through, so that a database outage does not
+// also take down the API.
+func (l *Limiter) Limit(name string, limit Limit) func(http.Handler) http.Handler {
+	return l.LimitMethods(name, limit)
+}
+
+// LimitMethods is like Limit but only counts requests with one of the given
+// methods, or every request if there are none.
+func (l *Limiter) LimitMethods(name string, limit Limit, methods ...string) func(http.Handler) http.Handler {
+	return l.limit(name, limit, ClientKey, methods)
+}
+
+// LimitIP is like Limit but counts requests against their IP address even
+// when their user is known. It guards the middleware that looks the user up.
+func (l *Limiter) LimitIP(name string, limit Limit) func(http.Handler) http.Handler {
+	return l.limit(name, limit, ipKey, nil)
+}
+
+func (l *Limiter) limit(name string, limit Limit, key func(*http.Request) string, methods []string) func(http.Handler) http.Handler {
+	policy := strconv.Itoa(limit.Requests) + ";w=" + strconv.Itoa(int(math.Ceil(limit.Period.Seconds())))
+	return func(next http.Handler) http.Handler {
+		if l.Store == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !matchMethod(r.Method, methods) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			result, err := l.Store.Take(r.Context(), name+":"+key(r), limit)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error checking rate limit", "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			if tighter(h, result) {
+				h.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+				h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+				h.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+				h.Set("RateLimit-Policy", policy)
+			}
+			if !result.Allowed {
+				h.Set("Retry-After", ceilSeconds(result.RetryAfter))
+				problem.Write(w, r, http.StatusTooManyRequests, "Too many requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientKey identifies who a request counts against: its user once the user
+// has been found in an organization, otherwise its IP address. A user ID
+// that has not been checked is not used, so that a client cannot get a fresh
+// bucket by sending a made-up one.
+func ClientKey(r *http.Request) string {
+	if userID, ok := auth.UserID(r.Context()); ok && auth.OrgID(r.Context()) != 0 {
+		return "user:" + strconv.Itoa(userID)
+	}
+	return ipKey(r)
+}
+
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func matchMethod(method string, methods []string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// tighter reports whether result leaves fewer requests than the limit whose
+// headers are already set, if any, so that a request under several limits
+// reports the one it is closest to hitting.
+func tighter(h http.Header, result Result) bool {
+	remaining, err := strconv.Atoi(h.Get("RateLimit-Remaining"))
+	return err != nil || !result.Allowed || result.Remaining < remaining
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
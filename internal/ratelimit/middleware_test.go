@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/auth"
+)
+
+func TestClientKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		known  bool
+		want   string
+	}{
+		{"anonymous", nil, false, "ip:192.0.2.1"},
+		{"unknown user", map[string]string{auth.UserHeader: "7"}, false, "ip:192.0.2.1"},
+		{"made-up API key", map[string]string{"X-API-Key": "random"}, false, "ip:192.0.2.1"},
+		{"known user", map[string]string{auth.UserHeader: "7"}, true, "user:7"},
+		{"known user with an API key", map[string]string{auth.UserHeader: "7", "X-API-Key": "random"}, true, "user:7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/tasks", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			var got string
+			auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.known {
+					r = r.WithContext(auth.WithOrg(r.Context(), 1, false))
+				}
+				got = ClientKey(r)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("ClientKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLimitIP checks that known users sharing an IP address share its
+// bucket.
+func TestLimitIP(t *testing.T) {
+	limiter := Limiter{Store: NewMemoryStore()}
+	limited := limiter.LimitIP("ip", Limit{Requests: 1, Period: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limited.ServeHTTP(w, r.WithContext(auth.WithOrg(r.Context(), 1, false)))
+	}))
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/tasks", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set(auth.UserHeader, strconv.Itoa(i+1))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("request as user %d: status %d, want %d", i+1, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/tracing"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table, so that every
+// instance of the API shares them. Buckets are timed with the database's
+// clock rather than the instances' own.
+type PostgresStore struct {
+	DB *sql.DB
+	// Idle is how long a bucket is kept after its last request. It must be
+	// at least the longest Period in use, after which a bucket is full again
+	// and can be forgotten.
+	Idle time.Duration
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	ctx = tracing.WithStatementName(ctx, "ratelimit.PostgresStore.Take")
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (key) DO NOTHING`, key, float64(limit.Requests))
+	if err != nil {
+		return Result{}, err
+	}
+	var b bucket
+	var now time.Time
+	err = tx.QueryRowContext(ctx, "SELECT tokens, updated_at, now() FROM rate_limit_buckets WHERE key = $1 FOR UPDATE", key).Scan(&b.tokens, &b.updated, &now)
+	if err != nil {
+		return Result{}, err
+	}
+	result := b.take(limit, now)
+	if _, err := tx.ExecContext(ctx, "UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3 WHERE key = $1", key, b.tokens, b.updated); err != nil {
+		return Result{}, err
+	}
+	return result, tx.Commit()
+}
+
+// Run deletes the buckets that have been idle for longer than Idle, once per
+// Idle.
+func (s *PostgresStore) Run(ctx context.Context) {
+	ctx = tracing.WithStatementName(ctx, "ratelimit.PostgresStore.Run")
+	ticker := time.NewTicker(s.Idle)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		_, err := s.DB.ExecContext(ctx, "DELETE FROM rate_limit_buckets WHERE updated_at < now() - $1 * interval '1 second'", s.Idle.Seconds())
+		if err != nil {
+			slog.ErrorContext(ctx, "Error deleting idle rate limit buckets", "err", err)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Package recurrence implements the subset of iCalendar recurrence rules
+// (RFC 5545 RRULE) supported for recurring tasks: FREQ=DAILY, WEEKLY or
+// MONTHLY with INTERVAL, BYDAY, UNTIL and COUNT.
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+// maxPeriods bounds how many days, weeks or months are scanned when looking
+// for an occurrence, so that a rule whose BYDAY never matches cannot loop
+// forever.
+const maxPeriods = 100000
+
+// Weekday is a BYDAY entry. N selects the Nth (or, if negative, Nth from
+// last) such weekday of the month and is only allowed with FREQ=MONTHLY;
+// zero means every such weekday.
+type Weekday struct {
+	Day time.Weekday
+	N   int
+}
+
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []Weekday
+	Until    time.Time
+	Count    int
+}
+
+var dayNames = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=10".
+// An optional "RRULE:" prefix is accepted.
+func Parse(s string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return rule, fmt.Errorf("rrule is empty")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return rule, fmt.Errorf("invalid rrule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			switch f := Frequency(strings.ToUpper(value)); f {
+			case Daily, Weekly, Monthly:
+				rule.Freq = f
+			default:
+				return rule, fmt.Errorf("unsupported FREQ %q, use DAILY, WEEKLY or MONTHLY", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("INTERVAL must be a positive number")
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("COUNT must be a positive number")
+			}
+			rule.Count = n
+		case "UNTIL":
+			t, err := parseUntil(value)
+			if err != nil {
+				return rule, err
+			}
+			rule.Until = t
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, err := parseWeekday(day)
+				if err != nil {
+					return rule, err
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		default:
+			return rule, fmt.Errorf("unsupported rrule part %s", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return rule, fmt.Errorf("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return rule, fmt.Errorf("COUNT and UNTIL cannot be combined")
+	}
+	for _, wd := range rule.ByDay {
+		if wd.N != 0 && rule.Freq != Monthly {
+			return rule, fmt.Errorf("numbered BYDAY values are only supported with FREQ=MONTHLY")
+		}
+	}
+	return rule, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes the whole day.
+				t = t.Add(24*time.Hour - time.Nanosecond)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
+
+func parseWeekday(s string) (Weekday, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return Weekday{}, fmt.Errorf("invalid BYDAY %q", s)
+	}
+	day, ok := dayNames[s[len(s)-2:]]
+	if !ok {
+		return Weekday{}, fmt.Errorf("invalid BYDAY %q", s)
+	}
+	wd := Weekday{Day: day}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return Weekday{}, fmt.Errorf("invalid BYDAY %q", s)
+		}
+		wd.N = n
+	}
+	return wd, nil
+}
+
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = strings.ToUpper(wd.Day.String()[:2])
+			if wd.N != 0 {
+				days[i] = strconv.Itoa(wd.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence strictly after the given time of a series
+// that starts at start. ok is false once the series has ended.
+func (r Rule) Next(start, after time.Time) (next time.Time, ok bool) {
+	r.each(start, func(t time.Time) bool {
+		if t.After(after) {
+			next, ok = t, true
+			return false
+		}
+		return true
+	})
+	return next, ok
+}
+
+// Includes reports whether t is an occurrence of the series starting at start.
+func (r Rule) Includes(start, t time.Time) bool {
+	found := false
+	r.each(start, func(o time.Time) bool {
+		if o.Equal(t) {
+			found = true
+		}
+		return o.Before(t)
+	})
+	return found
+}
+
+// Between returns up to limit occurrences in [from, to) of the series
+// starting at start.
+func (r Rule) Between(start, from, to time.Time, limit int) []time.Time {
+	var occurrences []time.Time
+	r.each(start, func(t time.Time) bool {
+		if !t.Before(to) || len(occurrences) == limit {
+			return false
+		}
+		if !t.Before(from) {
+			occurrences = append(occurrences, t)
+		}
+		return true
+	})
+	return occurrences
+}
+
+// each calls yield for every occurrence of the series in order until yield
+// returns false or the series ends. Occurrences keep the time of day of
+// start, in start's location.
+func (r Rule) each(start time.Time, yield func(time.Time) bool) {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	emitted := 0
+	for period := 0; period < maxPeriods; period += interval {
+		for _, t := range r.candidates(start, period) {
+			if t.Before(start) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return
+			}
+			if !yield(t) {
+				return
+			}
+			emitted++
+			if r.Count > 0 && emitted == r.Count {
+				return
+			}
+		}
+	}
+}
+
+// candidates returns the sorted occurrences falling into the given day, week
+// or month counted from the one containing start.
+func (r Rule) candidates(start time.Time, period int) []time.Time {
+	switch r.Freq {
+	case Daily:
+		day := start.AddDate(0, 0, period)
+		if len(r.ByDay) > 0 && !r.matchesWeekday(day.Weekday()) {
+			return nil
+		}
+		return []time.Time{day}
+
+	case Weekly:
+		// Weeks start on Monday, as with the RFC 5545 default WKST=MO.
+		offset := (int(start.Weekday()) + 6) % 7
+		monday := start.AddDate(0, 0, 7*period-offset)
+		if len(r.ByDay) == 0 {
+			return []time.Time{monday.AddDate(0, 0, offset)}
+		}
+		var days []time.Time
+		for i := 0; i < 7; i++ {
+			day := monday.AddDate(0, 0, i)
+			if r.matchesWeekday(day.Weekday()) {
+				days = append(days, day)
+			}
+		}
+		return days
+
+	case Monthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(period), 1,
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		if len(r.ByDay) == 0 {
+			day := first.AddDate(0, 0, start.Day()-1)
+			if day.Month() != first.Month() {
+				// Months without this day are skipped, as in RFC 5545.
+				return nil
+			}
+			return []time.Time{day}
+		}
+		return r.monthlyByDay(first)
+	}
+	return nil
+}
+
+func (r Rule) monthlyByDay(first time.Time) []time.Time {
+	var all []time.Time
+	for day := first; day.Month() == first.Month(); day = day.AddDate(0, 0, 1) {
+		all = append(all, day)
+	}
+
+	seen := make(map[int]bool)
+	var days []time.Time
+	for _, wd := range r.ByDay {
+		var matching []int
+		for i, day := range all {
+			if day.Weekday() == wd.Day {
+				matching = append(matching, i)
+			}
+		}
+		switch {
+		case wd.N == 0:
+			for _, i := range matching {
+				seen[i] = true
+			}
+		case wd.N > 0 && wd.N <= len(matching):
+			seen[matching[wd.N-1]] = true
+		case wd.N < 0 && -wd.N <= len(matching):
+			seen[matching[len(matching)+wd.N]] = true
+		}
+	}
+	for i := range seen {
+		days = append(days, all[i])
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+func (r Rule) matchesWeekday(day time.Weekday) bool {
+	for _, wd := range r.ByDay {
+		if wd.Day == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package recurrence
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// date parses an RFC 3339 time for the tables below.
+func date(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rrule string
+		want  string // the rule as String writes it
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:FREQ=DAILY", "FREQ=DAILY"},
+		{"  freq=weekly;interval=2;byday=mo,th  ", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"},
+		{"FREQ=DAILY;INTERVAL=1", "FREQ=DAILY"},
+		{"FREQ=MONTHLY;BYDAY=1MO,-1FR;COUNT=6", "FREQ=MONTHLY;BYDAY=1MO,-1FR;COUNT=6"},
+		{"FREQ=MONTHLY;BYDAY=+2TU", "FREQ=MONTHLY;BYDAY=2TU"},
+		{"FREQ=WEEKLY;UNTIL=20240301T120000Z", "FREQ=WEEKLY;UNTIL=20240301T120000Z"},
+		// A date-only UNTIL includes the whole day.
+		{"FREQ=DAILY;UNTIL=20240131", "FREQ=DAILY;UNTIL=20240131T235959Z"},
+		{"FREQ=DAILY;UNTIL=2024-03-01T12:00:00+02:00", "FREQ=DAILY;UNTIL=20240301T100000Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rrule, func(t *testing.T) {
+			rule, err := Parse(tt.rrule)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			again, err := Parse(rule.String())
+			if err != nil || again.String() != tt.want {
+				t.Errorf("Parse(%q) = %q, %v; want it unchanged", tt.want, again.String(), err)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		rrule string
+		want  string // part of the error
+	}{
+		{"", "empty"},
+		{"RRULE:", "empty"},
+		{"FREQ", "invalid rrule part"},
+		{"FREQ=", "invalid rrule part"},
+		{"FREQ=DAILY;", "invalid rrule part"},
+		{"FREQ=YEARLY", "unsupported FREQ"},
+		{"INTERVAL=2", "FREQ is required"},
+		{"FREQ=DAILY;INTERVAL=0", "INTERVAL"},
+		{"FREQ=DAILY;INTERVAL=two", "INTERVAL"},
+		{"FREQ=DAILY;COUNT=-1", "COUNT"},
+		{"FREQ=DAILY;UNTIL=tomorrow", "invalid UNTIL"},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20240101", "cannot be combined"},
+		{"FREQ=WEEKLY;BYDAY=XX", "invalid BYDAY"},
+		{"FREQ=WEEKLY;BYDAY=M", "invalid BYDAY"},
+		{"FREQ=WEEKLY;BYDAY=MO,", "invalid BYDAY"},
+		{"FREQ=MONTHLY;BYDAY=0MO", "invalid BYDAY"},
+		{"FREQ=MONTHLY;BYDAY=6MO", "invalid BYDAY"},
+		{"FREQ=MONTHLY;BYDAY=-6MO", "invalid BYDAY"},
+		{"FREQ=WEEKLY;BYDAY=1MO", "only supported with FREQ=MONTHLY"},
+		{"FREQ=DAILY;BYMONTH=1", "unsupported rrule part"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rrule, func(t *testing.T) {
+			_, err := Parse(tt.rrule)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse(%q) = %v, want an error containing %q", tt.rrule, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	tests := []struct {
+		name  string
+		rrule string
+		start string
+		want  []string // the first occurrences, up to 4
+	}{
+		{"daily", "FREQ=DAILY", "2024-01-30T09:00:00Z",
+			[]string{"2024-01-30T09:00:00Z", "2024-01-31T09:00:00Z", "2024-02-01T09:00:00Z", "2024-02-02T09:00:00Z"}},
+		{"every other day", "FREQ=DAILY;INTERVAL=2", "2024-02-27T09:00:00Z",
+			[]string{"2024-02-27T09:00:00Z", "2024-02-29T09:00:00Z", "2024-03-02T09:00:00Z", "2024-03-04T09:00:00Z"}},
+		{"daily on some weekdays", "FREQ=DAILY;BYDAY=MO,FR", "2024-01-03T09:00:00Z",
+			[]string{"2024-01-05T09:00:00Z", "2024-01-08T09:00:00Z", "2024-01-12T09:00:00Z", "2024-01-15T09:00:00Z"}},
+		{"weekly", "FREQ=WEEKLY", "2024-01-03T09:00:00Z",
+			[]string{"2024-01-03T09:00:00Z", "2024-01-10T09:00:00Z", "2024-01-17T09:00:00Z", "2024-01-24T09:00:00Z"}},
+		// Days of the starting week before the start are left out.
+		{"every other week on two days", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "2024-01-03T09:00:00Z",
+			[]string{"2024-01-04T09:00:00Z", "2024-01-15T09:00:00Z", "2024-01-18T09:00:00Z", "2024-01-29T09:00:00Z"}},
+		// Weeks start on Monday, so Sunday ends the starting week.
+		{"weekly on Sunday", "FREQ=WEEKLY;BYDAY=SU", "2024-01-03T09:00:00Z",
+			[]string{"2024-01-07T09:00:00Z", "2024-01-14T09:00:00Z", "2024-01-21T09:00:00Z", "2024-01-28T09:00:00Z"}},
+		{"weekly across the year end", "FREQ=WEEKLY;BYDAY=MO", "2024-12-25T09:00:00Z",
+			[]string{"2024-12-30T09:00:00Z", "2025-01-06T09:00:00Z", "2025-01-13T09:00:00Z", "2025-01-20T09:00:00Z"}},
+		{"monthly", "FREQ=MONTHLY", "2024-01-15T09:00:00Z",
+			[]string{"2024-01-15T09:00:00Z", "2024-02-15T09:00:00Z", "2024-03-15T09:00:00Z", "2024-04-15T09:00:00Z"}},
+		{"quarterly", "FREQ=MONTHLY;INTERVAL=3", "2024-11-15T09:00:00Z",
+			[]string{"2024-11-15T09:00:00Z", "2025-02-15T09:00:00Z", "2025-05-15T09:00:00Z", "2025-08-15T09:00:00Z"}},
+		// Months without the start's day are skipped rather than clamped.
+		{"monthly on the 31st", "FREQ=MONTHLY", "2024-01-31T09:00:00Z",
+			[]string{"2024-01-31T09:00:00Z", "2024-03-31T09:00:00Z", "2024-05-31T09:00:00Z", "2024-07-31T09:00:00Z"}},
+		{"monthly on the 29th in a leap year", "FREQ=MONTHLY", "2024-01-29T09:00:00Z",
+			[]string{"2024-01-29T09:00:00Z", "2024-02-29T09:00:00Z", "2024-03-29T09:00:00Z", "2024-04-29T09:00:00Z"}},
+		{"monthly on the 29th in a common year", "FREQ=MONTHLY", "2023-01-29T09:00:00Z",
+			[]string{"2023-01-29T09:00:00Z", "2023-03-29T09:00:00Z", "2023-04-29T09:00:00Z", "2023-05-29T09:00:00Z"}},
+		{"last Friday of the month", "FREQ=MONTHLY;BYDAY=-1FR", "2024-01-01T09:00:00Z",
+			[]string{"2024-01-26T09:00:00Z", "2024-02-23T09:00:00Z", "2024-03-29T09:00:00Z", "2024-04-26T09:00:00Z"}},
+		{"first Monday and last Friday", "FREQ=MONTHLY;BYDAY=1MO,-1FR", "2024-01-01T09:00:00Z",
+			[]string{"2024-01-01T09:00:00Z", "2024-01-26T09:00:00Z", "2024-02-05T09:00:00Z", "2024-02-23T09:00:00Z"}},
+		// Months with only four Mondays have no fifth one.
+		{"fifth Monday", "FREQ=MONTHLY;BYDAY=5MO", "2024-01-01T09:00:00Z",
+			[]string{"2024-01-29T09:00:00Z", "2024-04-29T09:00:00Z", "2024-07-29T09:00:00Z", "2024-09-30T09:00:00Z"}},
+		{"every Tuesday of the month", "FREQ=MONTHLY;BYDAY=TU", "2024-02-14T09:00:00Z",
+			[]string{"2024-02-20T09:00:00Z", "2024-02-27T09:00:00Z", "2024-03-05T09:00:00Z", "2024-03-12T09:00:00Z"}},
+		{"count", "FREQ=DAILY;COUNT=2", "2024-01-01T09:00:00Z",
+			[]string{"2024-01-01T09:00:00Z", "2024-01-02T09:00:00Z"}},
+		// COUNT counts occurrences, not the days of the starting week
+		// before the start.
+		{"count with weekdays", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3", "2024-01-03T09:00:00Z",
+			[]string{"2024-01-03T09:00:00Z", "2024-01-08T09:00:00Z", "2024-01-10T09:00:00Z"}},
+		{"until a date", "FREQ=DAILY;UNTIL=20240103", "2024-01-01T09:00:00Z",
+			[]string{"2024-01-01T09:00:00Z", "2024-01-02T09:00:00Z", "2024-01-03T09:00:00Z"}},
+		{"until an occurrence", "FREQ=DAILY;UNTIL=20240102T090000Z", "2024-01-01T09:00:00Z",
+			[]string{"2024-01-01T09:00:00Z", "2024-01-02T09:00:00Z"}},
+		{"until before the start", "FREQ=DAILY;UNTIL=20231231", "2024-01-01T09:00:00Z", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rrule)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			start := date(t, tt.start)
+			got := rule.Between(start, start, start.AddDate(10, 0, 0), 4)
+			if len(got) != len(tt.want) {
+				t.Fatalf("occurrences = %v, want %v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				if !got[i].Equal(date(t, want)) {
+					t.Errorf("occurrence %d = %v, want %s", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	rule, err := Parse("FREQ=WEEKLY;BYDAY=MO,FR;COUNT=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := date(t, "2024-01-01T09:00:00Z") // a Monday
+	tests := []struct {
+		after string
+		want  string // "" once the series has ended
+	}{
+		{"2023-12-01T00:00:00Z", "2024-01-01T09:00:00Z"},
+		// The next occurrence is strictly after the given time.
+		{"2024-01-01T09:00:00Z", "2024-01-05T09:00:00Z"},
+		{"2024-01-05T08:59:59Z", "2024-01-05T09:00:00Z"},
+		{"2024-01-05T09:00:00Z", "2024-01-08T09:00:00Z"},
+		{"2024-01-08T09:00:00Z", ""},
+	}
+	for _, tt := range tests {
+		next, ok := rule.Next(start, date(t, tt.after))
+		if tt.want == "" {
+			if ok {
+				t.Errorf("Next(%s) = %v, want the series to have ended", tt.after, next)
+			}
+			continue
+		}
+		if !ok || !next.Equal(date(t, tt.want)) {
+			t.Errorf("Next(%s) = %v, %v; want %s", tt.after, next, ok, tt.want)
+		}
+	}
+}
+
+func TestBetweenWindow(t *testing.T) {
+	rule, err := Parse("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := date(t, "2024-01-01T09:00:00Z")
+	from, to := date(t, "2024-01-03T09:00:00Z"), date(t, "2024-01-06T09:00:00Z")
+
+	// from is included and to is not.
+	got := rule.Between(start, from, to, 10)
+	want := []string{"2024-01-03T09:00:00Z", "2024-01-04T09:00:00Z", "2024-01-05T09:00:00Z"}
+	if len(got) != len(want) {
+		t.Fatalf("Between = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(date(t, want[i])) {
+			t.Errorf("occurrence %d = %v, want %s", i, got[i], want[i])
+		}
+	}
+	if got := rule.Between(start, from, to, 2); len(got) != 2 {
+		t.Errorf("Between with limit 2 = %v, want 2 occurrences", got)
+	}
+}
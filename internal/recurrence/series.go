@@ -0,0 +1,45 @@
+package recurrence
+
+import (
+	"fmt"
+	"time"
+)
+
+// Series is a rule anchored at its first possible occurrence. Occurrences are
+// computed in Start's location, so that a 09:00 weekly meeting stays at 09:00
+// local time across daylight saving changes.
+type Series struct {
+	Rule  Rule
+	Start time.Time
+}
+
+// NewSeries parses rrule and anchors it at start in the named IANA time zone.
+// An empty timeZone means UTC.
+func NewSeries(rrule, timeZone string, start time.Time) (Series, error) {
+	rule, err := Parse(rrule)
+	if err != nil {
+		return Series{}, err
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return Series{}, fmt.Errorf("unknown time zone %q", timeZone)
+	}
+	return Series{Rule: rule, Start: start.In(loc)}, nil
+}
+
+// First returns the first occurrence of the series, if any.
+func (s Series) First() (time.Time, bool) {
+	return s.Rule.Next(s.Start, s.Start.Add(-time.Nanosecond))
+}
+
+func (s Series) Next(after time.Time) (time.Time, bool) {
+	return s.Rule.Next(s.Start, after)
+}
+
+func (s Series) Includes(t time.Time) bool {
+	return s.Rule.Includes(s.Start, t.In(s.Start.Location()))
+}
+
+func (s Series) Between(from, to time.Time, limit int) []time.Time {
+	return s.Rule.Between(s.Start, from, to, limit)
+}
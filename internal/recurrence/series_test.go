@@ -0,0 +1,132 @@
+package recurrence
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSeriesInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		rrule    string
+		timeZone string
+		want     string // part of the error
+	}{
+		{"invalid rule", "FREQ=HOURLY", "UTC", "unsupported FREQ"},
+		{"unknown time zone", "FREQ=DAILY", "Mars/Olympus_Mons", "unknown time zone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSeries(tt.rrule, tt.timeZone, time.Now())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewSeries = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestSeriesKeepsLocalTime checks that occurrences stay at the start's time
+// of day in the series' time zone when daylight saving time begins or ends,
+// which moves them by an hour in UTC.
+func TestSeriesKeepsLocalTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		rrule    string
+		timeZone string
+		start    string
+		want     []string
+	}{
+		{"daily into summer time", "FREQ=DAILY", "Europe/Berlin", "2024-03-30T08:00:00Z",
+			[]string{"2024-03-30T08:00:00Z", "2024-03-31T07:00:00Z", "2024-04-01T07:00:00Z"}},
+		{"weekly out of summer time", "FREQ=WEEKLY", "America/New_York", "2024-10-26T13:00:00Z",
+			[]string{"2024-10-26T13:00:00Z", "2024-11-02T13:00:00Z", "2024-11-09T14:00:00Z"}},
+		{"monthly across both changes", "FREQ=MONTHLY;BYDAY=-1SU", "Europe/Berlin", "2024-02-25T08:00:00Z",
+			[]string{"2024-02-25T08:00:00Z", "2024-03-31T07:00:00Z", "2024-04-28T07:00:00Z"}},
+		// A local day can start on the previous day in UTC, and BYDAY is
+		// matched against the local weekday.
+		{"weekday in the local time zone", "FREQ=WEEKLY;BYDAY=MO", "Asia/Tokyo", "2024-01-07T23:30:00Z",
+			[]string{"2024-01-07T23:30:00Z", "2024-01-14T23:30:00Z", "2024-01-21T23:30:00Z"}},
+		{"UTC stays put", "FREQ=DAILY", "UTC", "2024-03-30T08:00:00Z",
+			[]string{"2024-03-30T08:00:00Z", "2024-03-31T08:00:00Z", "2024-04-01T08:00:00Z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := date(t, tt.start)
+			series, err := NewSeries(tt.rrule, tt.timeZone, start)
+			if err != nil {
+				t.Fatalf("NewSeries: %v", err)
+			}
+			got := series.Between(start, start.AddDate(1, 0, 0), len(tt.want))
+			if len(got) != len(tt.want) {
+				t.Fatalf("occurrences = %v, want %v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				if !got[i].Equal(date(t, want)) {
+					t.Errorf("occurrence %d = %v, want %s", i, got[i].UTC(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestSeriesFirst(t *testing.T) {
+	tests := []struct {
+		name  string
+		rrule string
+		start string
+		want  string // "" if the series has no occurrences
+	}{
+		{"start is an occurrence", "FREQ=DAILY", "2024-01-01T09:00:00Z", "2024-01-01T09:00:00Z"},
+		{"start is not an occurrence", "FREQ=WEEKLY;BYDAY=FR", "2024-01-01T09:00:00Z", "2024-01-05T09:00:00Z"},
+		{"no day of the month", "FREQ=MONTHLY;BYDAY=5FR", "2024-02-01T09:00:00Z", "2024-03-29T09:00:00Z"},
+		{"until before start", "FREQ=DAILY;UNTIL=20231231", "2024-01-01T09:00:00Z", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series, err := NewSeries(tt.rrule, "UTC", date(t, tt.start))
+			if err != nil {
+				t.Fatalf("NewSeries: %v", err)
+			}
+			first, ok := series.First()
+			if tt.want == "" {
+				if ok {
+					t.Errorf("First() = %v, want no occurrence", first)
+				}
+				return
+			}
+			if !ok || !first.Equal(date(t, tt.want)) {
+				t.Errorf("First() = %v, %v; want %s", first, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeriesIncludes(t *testing.T) {
+	series, err := NewSeries("FREQ=MONTHLY;COUNT=3", "Europe/Berlin", date(t, "2024-01-31T08:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		t    string
+		want bool
+	}{
+		{"2024-01-31T08:00:00Z", true},
+		// The same instant written in another offset.
+		{"2024-01-31T09:00:00+01:00", true},
+		// After the change to summer time the occurrence is at 07:00 UTC.
+		{"2024-03-31T07:00:00Z", true},
+		{"2024-03-31T08:00:00Z", false},
+		// February has no 31st and is skipped.
+		{"2024-02-29T08:00:00Z", false},
+		{"2024-05-31T07:00:00Z", true},
+		// COUNT=3 ends the series before July.
+		{"2024-07-31T07:00:00Z", false},
+		{"2023-12-31T08:00:00Z", false},
+	}
+	for _, tt := range tests {
+		if got := series.Includes(date(t, tt.t)); got != tt.want {
+			t.Errorf("Includes(%s) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
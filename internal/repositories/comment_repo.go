@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/notify"
+)
+
+// CommentRepo works on the comments on the tasks of the projects of
+// organization OrgID.
+type CommentRepo struct {
+	DB    *sql.DB
+	OrgID int
+}
+
+// orgTasks selects the IDs of the tasks of an organization that are not in
+// the trash.
+const orgTasks = "SELECT id FROM tasks WHERE deleted_at IS NULL AND projectId IN (" + orgProjects + ")"
+
+// GetComments returns the comments on the task, oldest first.
+func (r *CommentRepo) GetComments(ctx context.Context, taskID int) ([]models.Comment, error) {
+	ctx = traced(ctx, "CommentRepo.GetComments")
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, task_id, author_id, body, created_at FROM task_comments
+		WHERE task_id = $1`+inOrg("task_id", orgTasks, 2)+`
+		ORDER BY id`, taskID, r.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []models.Comment{}
+	for rows.Next() {
+		var comment models.Comment
+		if err := rows.Scan(&comment.ID, &comment.TaskID, &comment.AuthorID, &comment.Body, &comment.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// CreateComment saves a comment and returns its ID. The emails to the users
+// it mentions are queued with it.
+func (r *CommentRepo) CreateComment(ctx context.Context, comment models.Comment) (int, error) {
+	ctx = traced(ctx, "CommentRepo.CreateComment")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := checkInOrg(ctx, tx, orgTasks, comment.TaskID, r.OrgID, notFound("Task")); err != nil {
+		return 0, err
+	}
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO task_comments (task_id, author_id, body, created_at)
+		VALUES ($1, $2, $3, $4) RETURNING id`,
+		comment.TaskID, comment.AuthorID, comment.Body, comment.CreatedAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	comment.ID = id
+	if err := queueMentions(ctx, tx, comment); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// mention matches an @name in a comment. An @ within a word, as in an email
+// address, is not a mention.
+var mention = regexp.MustCompile(`(?:^|[^\p{L}\p{N}._%+-])@([\p{L}\p{N}._-]*[\p{L}\p{N}])`)
+
+// mentionedNames returns the lower case names mentioned in body.
+func mentionedNames(body string) map[string]bool {
+	names := make(map[string]bool)
+	for _, m := range mention.FindAllStringSubmatch(body, -1) {
+		names[strings.ToLower(m[1])] = true
+	}
+	return names
+}
+
+// queueMentions queues the email to every member of the comment's project
+// that it mentions, other than its author, once each.
+func queueMentions(ctx context.Context, tx *sql.Tx, comment models.Comment) error {
+	names := mentionedNames(comment.Body)
+	if len(names) == 0 {
+		return nil
+	}
+	event := notify.Mentioned{TaskID: comment.TaskID, CommentID: comment.ID, Comment: comment.Body}
+	err := tx.QueryRowContext(ctx, `
+		SELECT t.title, COALESCE(u.name, '')
+		FROM tasks t LEFT JOIN users u ON u.id = $2 AND u.deleted_at IS NULL
+		WHERE t.id = $1`, comment.TaskID, comment.AuthorID).Scan(&event.Title, &event.MentionedBy)
+	if err != nil {
+		return err
+	}
+
+	mentioned, err := mentionedMembers(ctx, tx, comment, names)
+	if err != nil {
+		return err
+	}
+	for _, userID := range mentioned {
+		if err := enqueue(ctx, tx, userID, notify.EventMentioned, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mentionedMembers returns the members of the comment's project, other than
+// its author, whose name or email before the @ is one of names.
+func mentionedMembers(ctx context.Context, tx *sql.Tx, comment models.Comment, names map[string]bool) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT u.id, u.name, u.email
+		FROM project_members m JOIN users u ON u.id = m.user_id AND u.deleted_at IS NULL
+		WHERE m.project_id = (SELECT projectId FROM tasks WHERE id = $1)
+		ORDER BY u.id`, comment.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentioned []int
+	for rows.Next() {
+		var id int
+		var name, email string
+		if err := rows.Scan(&id, &name, &email); err != nil {
+			return nil, err
+		}
+		local, _, _ := strings.Cut(email, "@")
+		if (names[strings.ToLower(name)] || names[strings.ToLower(local)]) && (comment.AuthorID == nil || *comment.AuthorID != id) {
+			mentioned = append(mentioned, id)
+		}
+	}
+	return mentioned, rows.Err()
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/allwsaa/project-api/internal/apperr"
+	"github.com/allwsaa/project-api/internal/dialect"
+)
+
+// The errors of the repositories are *apperr.Error values, so that handlers
+// can answer them as they are. Compare them with errors.Is: methods wrap
+// ErrNotFound, ErrConflict and ErrForeignKey with a message naming what was
+// not found or conflicted.
+var (
+	// ErrNotFound is returned when the row a method reads or writes does
+	// not exist in the repository's organization, or is in the trash.
+	ErrNotFound = apperr.New(apperr.NotFound, "Not found")
+	// ErrConflict is returned when a write would duplicate a unique value,
+	// such as a user's email.
+	ErrConflict = apperr.New(apperr.Conflict, "Already exists")
+	// ErrForeignKey is returned when a write refers to a row that does not
+	// exist, such as a task's assignee.
+	ErrForeignKey = apperr.New(apperr.Unprocessable, "Refers to a missing resource")
+
+	ErrNotInTrash    = apperr.Wrap(apperr.NotFound, "Not found in trash", ErrNotFound)
+	ErrParentDeleted = apperr.New(apperr.Conflict, "Project is deleted, restore it first")
+
+	// ErrVersionMismatch is returned by conditional writes when the stored
+	// row is no longer at the version the caller based its change on.
+	ErrVersionMismatch = apperr.New(apperr.PreconditionFailed, "Resource has been modified, fetch it again and retry")
+)
+
+// notFound returns ErrNotFound for the named resource, such as "Task".
+func notFound(what string) error {
+	return apperr.Wrap(apperr.NotFound, what+" not found", ErrNotFound)
+}
+
+// constraintError explains a write that violated a constraint: a duplicate
+// unique value is ErrConflict and a reference to a missing row ErrForeignKey,
+// each wrapped with its message. Other errors are returned as they are.
+func constraintError(err error, duplicate, missingRef string) error {
+	switch dialect.Violated(err) {
+	case dialect.Unique:
+		return apperr.Wrap(apperr.Conflict, duplicate, ErrConflict)
+	case dialect.ForeignKey:
+		return apperr.Wrap(apperr.Unprocessable, missingRef, ErrForeignKey)
+	}
+	return err
+}
+
+// noRowsError explains why a conditional write found no row: with an
+// expectedVersion it looks the row up in table, limited to organization orgID
+// by scope as in patchRow, to tell a row at another version from a missing
+// one. Without, the row is missing.
+func noRowsError(ctx context.Context, db queryRower, table, scope string, orgID, id, expectedVersion int) error {
+	if expectedVersion == 0 {
+		return ErrNotFound
+	}
+	var exists bool
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1 AND deleted_at IS NULL AND %s)", table, fmt.Sprintf(scope, 2)),
+		id, orgID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionMismatch
+	}
+	return ErrNotFound
+}
+
+// checkAffected fails with ErrNotFound if the write changed no row.
+func checkAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// checkUpdated is checkAffected for a write conditional on expectedVersion,
+// explaining a write that changed no row with noRowsError.
+func checkUpdated(ctx context.Context, db queryRower, res sql.Result, table, scope string, orgID, id, expectedVersion int) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return noRowsError(ctx, db, table, scope, orgID, id, expectedVersion)
+	}
+	return nil
+}
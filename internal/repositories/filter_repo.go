@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/allwsaa/project-api/internal/models"
+)
+
+// FilterRepo works on the saved filters of the users of organization OrgID.
+type FilterRepo struct {
+	DB    *sql.DB
+	OrgID int
+}
+
+// GetVisibleFilters returns the user's own filters and the filters shared
+// with the projects they are a member of.
+func (r *FilterRepo) GetVisibleFilters(ctx context.Context, userID int) ([]models.SavedFilter, error) {
+	ctx = traced(ctx, "FilterRepo.GetVisibleFilters")
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, name, owner_id, project_id, criteria, created_at FROM saved_filters
+		WHERE (owner_id = $1 OR project_id IN (`+fmt.Sprintf(memberProjects, 1)+`))`+inOrg("owner_id", orgUsers, 2)+`
+		ORDER BY name, id`, userID, r.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filters := []models.SavedFilter{}
+	for rows.Next() {
+		filter, err := scanFilter(rows)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, *filter)
+	}
+	return filters, rows.Err()
+}
+
+func (r *FilterRepo) GetFilterByID(ctx context.Context, id int) (*models.SavedFilter, error) {
+	ctx = traced(ctx, "FilterRepo.GetFilterByID")
+	row := r.DB.QueryRowContext(ctx, "SELECT id, name, owner_id, project_id, criteria, created_at FROM saved_filters WHERE id = $1"+inOrg("owner_id", orgUsers, 2), id, r.OrgID)
+	filter, err := scanFilter(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("Filter")
+		}
+		return nil, err
+	}
+	return filter, nil
+}
+
+func (r *FilterRepo) CreateFilter(ctx context.Context, filter models.SavedFilter) (int, error) {
+	ctx = traced(ctx, "FilterRepo.CreateFilter")
+	if err := checkInOrg(ctx, r.DB, liveOrgUsers, filter.OwnerID, r.OrgID, ErrUserNotFound); err != nil {
+		return 0, err
+	}
+	if filter.ProjectID != nil {
+		if err := checkInOrg(ctx, r.DB, liveOrgProjects, *filter.ProjectID, r.OrgID, ErrProjectNotFound); err != nil {
+			return 0, err
+		}
+	}
+	criteria, err := json.Marshal(filter.Criteria)
+	if err != nil {
+		return 0, err
+	}
+	var id int
+	err = r.DB.QueryRowContext(ctx, `
+		INSERT INTO saved_filters (name, owner_id, project_id, criteria, created_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		filter.Name, filter.OwnerID, filter.ProjectID, criteria, filter.CreatedAt).Scan(&id)
+	if err != nil {
+		return 0, constraintError(err, "A filter with this name already exists", "Project not found")
+	}
+	return id, nil
+}
+
+func (r *FilterRepo) DeleteFilter(ctx context.Context, id int) error {
+	ctx = traced(ctx, "FilterRepo.DeleteFilter")
+	res, err := r.DB.ExecContext(ctx, "DELETE FROM saved_filters WHERE id = $1"+inOrg("owner_id", orgUsers, 2), id, r.OrgID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+func scanFilter(row interface{ Scan(...any) error }) (*models.SavedFilter, error) {
+	var filter models.SavedFilter
+	var criteria []byte
+	if err := row.Scan(&filter.ID, &filter.Name, &filter.OwnerID, &filter.ProjectID, &criteria, &filter.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(criteria, &filter.Criteria); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+func (r *FilterRepo) FilterNameExists(ctx context.Context, ownerID int, name string) (bool, error) {
+	ctx = traced(ctx, "FilterRepo.FilterNameExists")
+	var exists bool
+	err := r.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM saved_filters WHERE owner_id = $1 AND name = $2"+inOrg("owner_id", orgUsers, 3)+")", ownerID, name, r.OrgID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,174 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/apperr"
+	"github.com/allwsaa/project-api/internal/models"
+)
+
+// ErrLastOwner is returned when a change would leave a project without an
+// owner.
+var ErrLastOwner = apperr.New(apperr.Conflict, "Project must keep at least one owner")
+
+// memberProjects selects the IDs of the projects a user is a member of; %d
+// is the user's parameter number.
+const memberProjects = "SELECT project_id FROM project_members WHERE user_id = $%d"
+
+// memberScope returns a condition limiting column, a project ID, to the
+// projects of memberID, bound as parameter argN. It is empty when memberID is
+// zero, which means no limit; pass memberArgs(memberID) along with it.
+func memberScope(column string, memberID, argN int) string {
+	if memberID == 0 {
+		return ""
+	}
+	return " AND " + column + " IN (" + fmt.Sprintf(memberProjects, argN) + ")"
+}
+
+func memberArgs(memberID int) []any {
+	if memberID == 0 {
+		return nil
+	}
+	return []any{memberID}
+}
+
+// MemberRepo works on the members of the projects of organization OrgID.
+type MemberRepo struct {
+	DB    *sql.DB
+	OrgID int
+}
+
+func (r *MemberRepo) GetMembers(ctx context.Context, projectID int) ([]models.ProjectMember, error) {
+	ctx = traced(ctx, "MemberRepo.GetMembers")
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT m.project_id, m.user_id, m.role, m.added_at FROM project_members m
+		JOIN users u ON u.id = m.user_id AND u.deleted_at IS NULL
+		WHERE m.project_id = $1`+inOrg("m.project_id", orgProjects, 2)+` ORDER BY m.added_at, m.user_id`, projectID, r.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.ProjectMember{}
+	for rows.Next() {
+		var member models.ProjectMember
+		if err := rows.Scan(&member.ProjectID, &member.UserID, &member.Role, &member.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// GetRole returns the user's role in the project, or "" if they are not a
+// member.
+func (r *MemberRepo) GetRole(ctx context.Context, projectID, userID int) (string, error) {
+	ctx = traced(ctx, "MemberRepo.GetRole")
+	var role string
+	err := r.DB.QueryRowContext(ctx, "SELECT role FROM project_members WHERE project_id = $1 AND user_id = $2"+inOrg("project_id", orgProjects, 3), projectID, userID, r.OrgID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// SetMember adds the user to the project or changes their role. Both must
+// belong to the repository's organization.
+func (r *MemberRepo) SetMember(ctx context.Context, projectID, userID int, role string) error {
+	ctx = traced(ctx, "MemberRepo.SetMember")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkInOrg(ctx, tx, liveOrgProjects, projectID, r.OrgID, ErrProjectNotFound); err != nil {
+		return err
+	}
+	if err := checkInOrg(ctx, tx, liveOrgUsers, userID, r.OrgID, ErrUserNotFound); err != nil {
+		return err
+	}
+	if role != models.RoleOwner {
+		if err := checkNotLastOwner(ctx, tx, projectID, userID); err != nil {
+			return err
+		}
+	}
+	if err := setMember(ctx, tx, projectID, userID, role); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveMember removes the user from the project. It returns ErrNotFound if
+// they were not a member.
+func (r *MemberRepo) RemoveMember(ctx context.Context, projectID, userID int) error {
+	ctx = traced(ctx, "MemberRepo.RemoveMember")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkInOrg(ctx, tx, orgProjects, projectID, r.OrgID, notFound("Project")); err != nil {
+		return err
+	}
+	if err := checkNotLastOwner(ctx, tx, projectID, userID); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM project_members WHERE project_id = $1 AND user_id = $2"+inOrg("project_id", orgProjects, 3), projectID, userID, r.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// canBeAssigned reports whether the user may be assigned tasks in the project
+// of organization orgID, that is, they are a member with a role other than
+// viewer and neither is in the trash. The same members may edit the
+// project's tasks.
+func canBeAssigned(ctx context.Context, db queryRower, orgID, projectID, userID int) (bool, error) {
+	var role string
+	err := db.QueryRowContext(ctx, "SELECT role FROM project_members WHERE project_id = $1 AND user_id = $2"+inOrg("project_id", liveOrgProjects, 3)+inOrg("user_id", liveOrgUsers, 3), projectID, userID, orgID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil && role != models.RoleViewer, err
+}
+
+// setMember upserts a membership. It is shared with ProjectRepo, which makes
+// a project's manager one of its owners.
+func setMember(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, projectID, userID int, role string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO project_members (project_id, user_id, role, added_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (project_id, user_id) DO UPDATE SET role = EXCLUDED.role`,
+		projectID, userID, role, time.Now())
+	return err
+}
+
+// checkNotLastOwner fails with ErrLastOwner if the user is the project's only
+// owner. The project row is locked so that two owners cannot step down at
+// the same time.
+func checkNotLastOwner(ctx context.Context, tx *sql.Tx, projectID, userID int) error {
+	if _, err := tx.ExecContext(ctx, "SELECT id FROM projects WHERE id = $1 FOR UPDATE", projectID); err != nil {
+		return err
+	}
+	var owners, isOwner int
+	err := tx.QueryRowContext(ctx, `
+		SELECT count(*), COALESCE(SUM(CASE WHEN user_id = $2 THEN 1 ELSE 0 END), 0)
+		FROM project_members WHERE project_id = $1 AND role = 'owner'`, projectID, userID).Scan(&owners, &isOwner)
+	if err != nil {
+		return err
+	}
+	if isOwner == 1 && owners == 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/models"
+)
+
+const (
+	NotificationReminder   = "reminder"
+	NotificationOverdue    = "overdue"
+	NotificationEscalation = "escalation"
+)
+
+type NotificationRepo struct {
+	DB *sql.DB
+}
+
+// DueTask is an open task that a notification is about, with its recipient.
+type DueTask struct {
+	TaskID      int
+	Title       string
+	RecipientID int
+	DueAt       time.Time
+}
+
+// GetTasksToNotify returns the open tasks due in (dueAfter, dueBefore] that
+// have no notification of the given kind and threshold yet for their current
+// due date. Escalations go to the project manager, everything else to the
+// assignee.
+func (r *NotificationRepo) GetTasksToNotify(ctx context.Context, kind, threshold string, dueAfter, dueBefore time.Time) ([]DueTask, error) {
+	ctx = traced(ctx, "NotificationRepo.GetTasksToNotify")
+	recipient := "t.respId"
+	if kind == NotificationEscalation {
+		recipient = "p.managerId"
+	}
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT t.id, t.title, `+recipient+`, t.completionDate
+		FROM tasks t JOIN projects p ON p.id = t.projectId
+		WHERE t.deleted_at IS NULL AND p.deleted_at IS NULL AND t.status <> 'done'
+		AND t.completionDate > $1 AND t.completionDate <= $2
+		AND NOT EXISTS (
+			SELECT 1 FROM notifications n
+			WHERE n.task_id = t.id AND n.user_id = `+recipient+` AND n.kind = $3 AND n.threshold = $4 AND n.due_at = t.completionDate)
+		ORDER BY t.completionDate`,
+		dueAfter, dueBefore, kind, threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []DueTask
+	for rows.Next() {
+		var task DueTask
+		if err := rows.Scan(&task.TaskID, &task.Title, &task.RecipientID, &task.DueAt); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// CreateNotification stores a notification unless the same one was already
+// created, for instance by another instance of the scheduler. It reports
+// whether the notification is new.
+func (r *NotificationRepo) CreateNotification(ctx context.Context, n models.Notification) (bool, error) {
+	ctx = traced(ctx, "NotificationRepo.CreateNotification")
+	res, err := r.DB.ExecContext(ctx, `
+		INSERT INTO notifications (user_id, task_id, kind, threshold, due_at, message, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (task_id, user_id, kind, threshold, due_at) DO NOTHING`,
+		n.UserID, n.TaskID, n.Kind, n.Threshold, n.DueAt, n.Message, n.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	created, err := res.RowsAffected()
+	return created > 0, err
+}
+
+func (r *NotificationRepo) GetNotifications(ctx context.Context, userID int, unreadOnly bool) ([]models.Notification, error) {
+	ctx = traced(ctx, "NotificationRepo.GetNotifications")
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, user_id, task_id, kind, threshold, due_at, message, created_at, read_at FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC, id DESC`, userID, unreadOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.TaskID, &n.Kind, &n.Threshold, &n.DueAt, &n.Message, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// MarkNotificationRead marks one of the user's notifications as read. It
+// returns ErrNotFound if the user has no such notification.
+func (r *NotificationRepo) MarkNotificationRead(ctx context.Context, id, userID int) error {
+	ctx = traced(ctx, "NotificationRepo.MarkNotificationRead")
+	res, err := r.DB.ExecContext(ctx, "UPDATE notifications SET read_at = COALESCE(read_at, $3) WHERE id = $1 AND user_id = $2", id, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
@@ -0,0 +1,166 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/allwsaa/project-api/internal/apperr"
+	"github.com/allwsaa/project-api/internal/models"
+)
+
+// Every repository holding an organization's data has an OrgID and limits all
+// of its queries to that organization. A zero OrgID matches no organization,
+// so a repository used without one finds nothing rather than everything.
+// Methods working across organizations are meant for the background workers
+// and say so.
+
+var (
+	// ErrLastAdmin is returned when a change would leave an organization
+	// without an admin.
+	ErrLastAdmin = apperr.New(apperr.Conflict, "Organization must keep at least one admin")
+
+	// ErrProjectNotFound and ErrUserNotFound are returned by writes that
+	// refer to a project or user outside the repository's organization.
+	// They wrap ErrForeignKey.
+	ErrProjectNotFound = apperr.Wrap(apperr.Unprocessable, "Project not found", ErrForeignKey)
+	ErrUserNotFound    = apperr.Wrap(apperr.Unprocessable, "User not found", ErrForeignKey)
+)
+
+// orgProjects and orgUsers select the IDs of an organization's projects and
+// users; %d is the organization's parameter number. liveOrgProjects and
+// liveOrgUsers leave out those in the trash: writes check the projects and
+// users they refer to against them.
+const (
+	orgProjects     = "SELECT id FROM projects WHERE org_id = $%d"
+	orgUsers        = "SELECT id FROM users WHERE org_id = $%d"
+	liveOrgProjects = "SELECT id FROM projects WHERE deleted_at IS NULL AND org_id = $%d"
+	liveOrgUsers    = "SELECT id FROM users WHERE deleted_at IS NULL AND org_id = $%d"
+)
+
+// inOrg returns a condition limiting column to the IDs selected by one of the
+// org* queries, with the organization bound as parameter argN.
+func inOrg(column, ids string, argN int) string {
+	return " AND " + column + " IN (" + fmt.Sprintf(ids, argN) + ")"
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// checkInOrg fails with notFound unless id is one of the IDs selected by ids
+// for the organization.
+func checkInOrg(ctx context.Context, db queryRower, ids string, id, orgID int, notFound error) error {
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT $1 IN ("+fmt.Sprintf(ids, 2)+")", id, orgID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return notFound
+	}
+	return nil
+}
+
+type OrganizationRepo struct {
+	DB *sql.DB
+}
+
+// CreateOrganization creates an organization together with its first admin
+// and returns both IDs.
+func (r *OrganizationRepo) CreateOrganization(ctx context.Context, org models.Organization, admin models.User) (orgID, adminID int, err error) {
+	ctx = traced(ctx, "OrganizationRepo.CreateOrganization")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, "INSERT INTO organizations (name, created_at) VALUES ($1, $2) RETURNING id", org.Name, org.CreatedAt).Scan(&orgID)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (name, email, registrationDate, role, org_id, org_role)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		admin.Name, admin.Email, admin.RegistrationDate, admin.Role, orgID, models.OrgAdmin).Scan(&adminID)
+	if err != nil {
+		return 0, 0, constraintError(err, "A user with this email already exists", "Organization not found")
+	}
+	return orgID, adminID, tx.Commit()
+}
+
+func (r *OrganizationRepo) GetOrganization(ctx context.Context, id int) (*models.Organization, error) {
+	ctx = traced(ctx, "OrganizationRepo.GetOrganization")
+	var org models.Organization
+	err := r.DB.QueryRowContext(ctx, "SELECT id, name, created_at FROM organizations WHERE id = $1", id).Scan(&org.ID, &org.Name, &org.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *OrganizationRepo) RenameOrganization(ctx context.Context, id int, name string) error {
+	ctx = traced(ctx, "OrganizationRepo.RenameOrganization")
+	res, err := r.DB.ExecContext(ctx, "UPDATE organizations SET name = $2 WHERE id = $1", id, name)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+// GetCaller returns the organization of the user making a request and their
+// role in it. It returns ErrNotFound if there is no such user.
+func (r *OrganizationRepo) GetCaller(ctx context.Context, userID int) (orgID int, orgRole string, err error) {
+	ctx = traced(ctx, "OrganizationRepo.GetCaller")
+	err = r.DB.QueryRowContext(ctx, "SELECT org_id, org_role FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&orgID, &orgRole)
+	if err == sql.ErrNoRows {
+		return 0, "", notFound("User")
+	}
+	return orgID, orgRole, err
+}
+
+// SetOrgRole changes the role of one of the organization's users. It returns
+// ErrNotFound if the user is not in the organization.
+func (r *OrganizationRepo) SetOrgRole(ctx context.Context, orgID, userID int, role string) error {
+	ctx = traced(ctx, "OrganizationRepo.SetOrgRole")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if role != models.OrgAdmin {
+		if err := checkNotLastAdmin(ctx, tx, orgID, userID); err != nil {
+			return err
+		}
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE users SET org_role = $3, version = version + 1 WHERE id = $2 AND org_id = $1 AND deleted_at IS NULL", orgID, userID, role)
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkNotLastAdmin fails with ErrLastAdmin if the user is the organization's
+// only admin. The organization row is locked so that two admins cannot step
+// down at the same time.
+func checkNotLastAdmin(ctx context.Context, tx *sql.Tx, orgID, userID int) error {
+	if _, err := tx.ExecContext(ctx, "SELECT id FROM organizations WHERE id = $1 FOR UPDATE", orgID); err != nil {
+		return err
+	}
+	var admins, isAdmin int
+	err := tx.QueryRowContext(ctx, `
+		SELECT count(*), COALESCE(SUM(CASE WHEN id = $2 THEN 1 ELSE 0 END), 0)
+		FROM users WHERE org_id = $1 AND org_role = 'admin' AND deleted_at IS NULL`, orgID, userID).Scan(&admins, &isAdmin)
+	if err != nil {
+		return err
+	}
+	if isAdmin == 1 && admins == 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
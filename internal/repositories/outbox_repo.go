@@ -0,0 +1,264 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/notify"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// OutboxRepo stores emails until the outbox worker has delivered them.
+type OutboxRepo struct {
+	DB *sql.DB
+}
+
+// OutboxEmail is a queued email together with its recipient.
+type OutboxEmail struct {
+	ID        int
+	UserID    int
+	Event     string
+	Payload   json.RawMessage
+	Attempts  int
+	Recipient notify.Recipient
+}
+
+// GetEmailPreference returns how the user wants to be emailed. Users who
+// never chose get immediate emails.
+func (r *OutboxRepo) GetEmailPreference(ctx context.Context, userID int) (string, error) {
+	ctx = traced(ctx, "OutboxRepo.GetEmailPreference")
+	return emailPreference(ctx, r.DB, userID)
+}
+
+func emailPreference(ctx context.Context, db queryRower, userID int) (string, error) {
+	var preference string
+	err := db.QueryRowContext(ctx, "SELECT email FROM notification_preferences WHERE user_id = $1", userID).Scan(&preference)
+	if err == sql.ErrNoRows {
+		return notify.PreferenceImmediate, nil
+	}
+	return preference, err
+}
+
+func (r *OutboxRepo) SetEmailPreference(ctx context.Context, userID int, preference string) error {
+	ctx = traced(ctx, "OutboxRepo.SetEmailPreference")
+	_, err := r.DB.ExecContext(ctx, `
+		INSERT INTO notification_preferences (user_id, email) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET email = EXCLUDED.email`, userID, preference)
+	return err
+}
+
+// Enqueue queues an email about an event for the user according to their
+// preference: right away, in the next daily digest, or not at all.
+func (r *OutboxRepo) Enqueue(ctx context.Context, userID int, event string, payload any) error {
+	ctx = traced(ctx, "OutboxRepo.Enqueue")
+	return enqueue(ctx, r.DB, userID, event, payload)
+}
+
+type execQueryRower interface {
+	queryRower
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// enqueue is Enqueue on db, which is the transaction of the write the email
+// is about, so that the email is queued if and only if the write is
+// committed.
+func enqueue(ctx context.Context, db execQueryRower, userID int, event string, payload any) error {
+	preference, err := emailPreference(ctx, db, userID)
+	if err != nil || preference == notify.PreferenceOff {
+		return err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO email_outbox (user_id, event, payload, digest, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $5)`,
+		userID, event, data, preference == notify.PreferenceDigest, now)
+	return err
+}
+
+// queueAssignment queues the email telling the assignee of task id that
+// assigner, if set, assigned it to them, unless they assigned it to
+// themselves.
+func queueAssignment(ctx context.Context, tx *sql.Tx, id int, assigner *int) error {
+	var event notify.TaskAssigned
+	var respID int
+	err := tx.QueryRowContext(ctx, `
+		SELECT t.id, t.title, t.description, t.projectId, t.completionDate, t.respId, COALESCE(u.name, '')
+		FROM tasks t LEFT JOIN users u ON u.id = $2 AND u.deleted_at IS NULL
+		WHERE t.id = $1`, id, assigner).
+		Scan(&event.TaskID, &event.Title, &event.Description, &event.ProjectID, &event.DueAt, &respID, &event.AssignedBy)
+	if err != nil {
+		return err
+	}
+	if assigner != nil && *assigner == respID {
+		return nil
+	}
+	return enqueue(ctx, tx, respID, notify.EventTaskAssigned, event)
+}
+
+// claimTimeout is how long an email handed to send is kept from the other
+// senders. If its outcome has not been recorded by then, for instance
+// because the instance sending it stopped, it is sent again.
+const claimTimeout = 10 * time.Minute
+
+// SendDue hands up to limit pending immediate emails to send and records the
+// outcome. Failed emails are retried with exponential backoff and given up
+// after maxAttempts. The emails are claimed in a short transaction, so that
+// none is held open while they are sent, and several instances can send at
+// once without sending an email twice. SendDue stops early when ctx is done;
+// the emails it did not get to are sent once their claim runs out.
+func (r *OutboxRepo) SendDue(ctx context.Context, now time.Time, limit, maxAttempts int, send func(OutboxEmail) error) (sent, failed int, err error) {
+	ctx = traced(ctx, "OutboxRepo.SendDue")
+	emails, err := claimOutbox(ctx, r.DB, now, `
+		SELECT o.id, o.user_id, o.event, o.payload, o.attempts, u.name, u.email
+		FROM email_outbox o JOIN users u ON u.id = o.user_id AND u.deleted_at IS NULL
+		WHERE o.status = 'pending' AND NOT o.digest AND o.next_attempt_at <= $1
+		ORDER BY o.next_attempt_at
+		LIMIT $2
+		FOR UPDATE OF o SKIP LOCKED`, now, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, email := range emails {
+		if err := ctx.Err(); err != nil {
+			return sent, failed, err
+		}
+		sendErr := send(email)
+		// The outcome is recorded even if ctx was cancelled meanwhile, so
+		// that an email that went out is not sent again.
+		if err := recordDelivery(context.WithoutCancel(ctx), r.DB, []OutboxEmail{email}, sendErr, now, maxAttempts); err != nil {
+			return sent, failed, err
+		}
+		if sendErr == nil {
+			sent++
+		} else {
+			failed++
+		}
+	}
+	return sent, failed, nil
+}
+
+// SendDigests collects each user's pending digest emails queued before
+// cutoff and hands them to send as one batch per user, claimed as in
+// SendDue.
+func (r *OutboxRepo) SendDigests(ctx context.Context, now, cutoff time.Time, maxAttempts int, send func(notify.Recipient, []OutboxEmail) error) (int, error) {
+	ctx = traced(ctx, "OutboxRepo.SendDigests")
+	emails, err := claimOutbox(ctx, r.DB, now, `
+		SELECT o.id, o.user_id, o.event, o.payload, o.attempts, u.name, u.email
+		FROM email_outbox o JOIN users u ON u.id = o.user_id AND u.deleted_at IS NULL
+		WHERE o.status = 'pending' AND o.digest AND o.created_at < $1 AND o.next_attempt_at <= $2
+		ORDER BY o.user_id, o.id
+		FOR UPDATE OF o SKIP LOCKED`, cutoff, now)
+	if err != nil {
+		return 0, err
+	}
+
+	digests := 0
+	for start := 0; start < len(emails); {
+		if err := ctx.Err(); err != nil {
+			return digests, err
+		}
+		end := start
+		for end < len(emails) && emails[end].UserID == emails[start].UserID {
+			end++
+		}
+		batch := emails[start:end]
+		if err := recordDelivery(context.WithoutCancel(ctx), r.DB, batch, send(batch[0].Recipient, batch), now, maxAttempts); err != nil {
+			return digests, err
+		}
+		digests++
+		start = end
+	}
+	return digests, nil
+}
+
+// claimOutbox locks the emails query selects and puts off their next attempt
+// by claimTimeout from now, which hides them from the other senders once
+// the claim is committed.
+func claimOutbox(ctx context.Context, db *sql.DB, now time.Time, query string, args ...any) ([]OutboxEmail, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	emails, err := lockOutbox(ctx, tx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, email := range emails {
+		if _, err := tx.ExecContext(ctx, "UPDATE email_outbox SET next_attempt_at = $2 WHERE id = $1", email.ID, now.Add(claimTimeout)); err != nil {
+			return nil, err
+		}
+	}
+	return emails, tx.Commit()
+}
+
+func lockOutbox(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]OutboxEmail, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []OutboxEmail
+	for rows.Next() {
+		var email OutboxEmail
+		if err := rows.Scan(&email.ID, &email.UserID, &email.Event, &email.Payload, &email.Attempts, &email.Recipient.Name, &email.Recipient.Email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+// recordDelivery marks emails as sent, or schedules their next attempt if
+// sendErr is set, in one transaction.
+func recordDelivery(ctx context.Context, db *sql.DB, emails []OutboxEmail, sendErr error, now time.Time, maxAttempts int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, email := range emails {
+		var err error
+		if sendErr == nil {
+			_, err = tx.ExecContext(ctx, "UPDATE email_outbox SET status = $2, attempts = attempts + 1, last_error = NULL, sent_at = $3 WHERE id = $1",
+				email.ID, OutboxSent, now)
+		} else {
+			attempts := email.Attempts + 1
+			status := OutboxPending
+			if attempts >= maxAttempts {
+				status = OutboxFailed
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE email_outbox SET status = $2, attempts = $3, last_error = $4, next_attempt_at = $5 WHERE id = $1",
+				email.ID, status, attempts, sendErr.Error(), now.Add(retryDelay(attempts)))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// retryDelay doubles the wait after every failed attempt, starting at one
+// minute and capped at six hours.
+func retryDelay(attempts int) time.Duration {
+	delay := time.Minute << (attempts - 1)
+	if attempts > 10 || delay > 6*time.Hour {
+		return 6 * time.Hour
+	}
+	return delay
+}
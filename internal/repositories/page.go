@@ -0,0 +1,25 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/allwsaa/project-api/internal/models"
+)
+
+// pageClause returns the end of a query listing a page of rows by id: a
+// condition to append to its WHERE clause, then the order and the limit. The
+// parameters are numbered from argN; pass the returned arguments along.
+func pageClause(page models.Page, argN int) (string, []any) {
+	var clause string
+	var args []any
+	if page.After > 0 {
+		args = append(args, page.After)
+		clause += fmt.Sprintf(" AND id > $%d", argN)
+	}
+	clause += " ORDER BY id"
+	if page.Limit > 0 {
+		args = append(args, page.Limit)
+		clause += fmt.Sprintf(" LIMIT $%d", argN+len(args)-1)
+	}
+	return clause, args
+}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Columns a PATCH may change, keyed by the JSON name of the model field.
+var (
+	taskPatchColumns = map[string]string{
+		"title":          "title",
+		"description":    "description",
+		"priority":       "priority",
+		"status":         "status",
+		"respId":         "respId",
+		"projectId":      "projectId",
+		"completionDate": "completionDate",
+	}
+	projectPatchColumns = map[string]string{
+		"projectTitle":       "projectTitle",
+		"projectDescription": "projectDescription",
+		"completed":          "completed",
+		"managerId":          "managerId",
+	}
+	userPatchColumns = map[string]string{
+		"name":  "name",
+		"email": "email",
+		"role":  "role",
+	}
+)
+
+// patchRow writes only the given fields of a row and returns its new version.
+// A non-zero expectedVersion makes the update conditional on the stored
+// version. scope is a condition limiting the row to organization orgID, whose
+// parameter number is its %d.
+func patchRow(ctx context.Context, db queryRower, table string, columns map[string]string, scope string, orgID int, id int, fields map[string]any, expectedVersion int) (int, error) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	set := make([]string, 0, len(names)+1)
+	args := make([]any, 0, len(names)+2)
+	for _, name := range names {
+		column, ok := columns[name]
+		if !ok {
+			return 0, fmt.Errorf("%s cannot be patched", name)
+		}
+		args = append(args, fields[name])
+		set = append(set, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	set = append(set, "version = version + 1")
+	args = append(args, id, expectedVersion, orgID)
+
+	query := fmt.Sprintf(`UPDATE %s SET %s
+		WHERE id = $%d AND deleted_at IS NULL AND ($%d = 0 OR version = $%d) AND %s
+		RETURNING version`, table, strings.Join(set, ", "), len(args)-2, len(args)-1, len(args)-1, fmt.Sprintf(scope, len(args)))
+
+	var version int
+	err := db.QueryRowContext(ctx, query, args...).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, noRowsError(ctx, db, table, scope, orgID, id, expectedVersion)
+	}
+	return version, err
+}
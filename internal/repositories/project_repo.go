@@ -1,18 +1,27 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"time"
 
 	"github.com/allwsaa/project-api/internal/models"
 )
 
+// ProjectRepo works on the projects of organization OrgID.
 type ProjectRepo struct {
-	DB *sql.DB
+	DB    *sql.DB
+	OrgID int
 }
 
-func (r *ProjectRepo) GetAllProjects() ([]models.Project, error) {
-	rows, err := r.DB.Query("SELECT id, projectTitle, projectDescription, started FROM projects")
+// GetAllProjects returns every project, or with a non-zero memberID only the
+// projects that user is a member of, limited to page.
+func (r *ProjectRepo) GetAllProjects(ctx context.Context, memberID int, page models.Page) ([]models.Project, error) {
+	ctx = traced(ctx, "ProjectRepo.GetAllProjects")
+	args := append([]any{r.OrgID}, memberArgs(memberID)...)
+	paging, pageArgs := pageClause(page, len(args)+1)
+	rows, err := r.DB.QueryContext(ctx, "SELECT id, projectTitle, projectDescription, started, version FROM projects WHERE deleted_at IS NULL AND org_id = $1"+memberScope("id", memberID, 2)+paging,
+		append(args, pageArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -21,7 +30,7 @@ func (r *ProjectRepo) GetAllProjects() ([]models.Project, error) {
 	var projects []models.Project
 	for rows.Next() {
 		var project models.Project
-		if err := rows.Scan(&project.ID, &project.ProjectTitle, &project.ProjectDescription, &project.Started); err != nil {
+		if err := rows.Scan(&project.ID, &project.ProjectTitle, &project.ProjectDescription, &project.Started, &project.Version); err != nil {
 			return nil, err
 		}
 		projects = append(projects, project)
@@ -29,46 +38,213 @@ func (r *ProjectRepo) GetAllProjects() ([]models.Project, error) {
 	return projects, nil
 }
 
-func (r *ProjectRepo) CreateProject(project models.Project) (int, error) {
+// CreateProject creates the project with its manager as owner.
+func (r *ProjectRepo) CreateProject(ctx context.Context, project models.Project) (int, error) {
+	ctx = traced(ctx, "ProjectRepo.CreateProject")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := checkInOrg(ctx, tx, liveOrgUsers, project.ManagerId, r.OrgID, ErrUserNotFound); err != nil {
+		return 0, err
+	}
 	var id int
-	err := r.DB.QueryRow(`
-		INSERT INTO projects (projectTitle, projectDescription, started, completed, managerId)
-		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
-		project.ProjectTitle, project.ProjectDescription, project.Started, project.Completed, project.ManagerId).Scan(&id)
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO projects (projectTitle, projectDescription, started, completed, managerId, org_id)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		project.ProjectTitle, project.ProjectDescription, project.Started, project.Completed, project.ManagerId, r.OrgID).Scan(&id)
 	if err != nil {
+		return 0, constraintError(err, "Project already exists", "Manager not found")
+	}
+	if err := setMember(ctx, tx, id, project.ManagerId, models.RoleOwner); err != nil {
 		return 0, err
 	}
-	return id, nil
+	return id, tx.Commit()
 }
 
-func (r *ProjectRepo) GetProjectByID(id int) (*models.Project, error) {
-	row := r.DB.QueryRow("SELECT id, projectTitle, projectDescription, started, completed, managerId FROM projects WHERE id = $1", id)
+func (r *ProjectRepo) GetProjectByID(ctx context.Context, id int) (*models.Project, error) {
+	ctx = traced(ctx, "ProjectRepo.GetProjectByID")
+	row := r.DB.QueryRowContext(ctx, "SELECT id, projectTitle, projectDescription, started, completed, managerId, version FROM projects WHERE id = $1 AND deleted_at IS NULL AND org_id = $2", id, r.OrgID)
 	var project models.Project
-	err := row.Scan(&project.ID, &project.ProjectTitle, &project.ProjectDescription, &project.Started, &project.Completed, &project.ManagerId)
+	err := row.Scan(&project.ID, &project.ProjectTitle, &project.ProjectDescription, &project.Started, &project.Completed, &project.ManagerId, &project.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("project with this ID not found")
+			return nil, notFound("Project")
 		}
 		return nil, err
 	}
 	return &project, nil
 }
 
-func (r *ProjectRepo) UpdateProject(project models.Project) error {
-	_, err := r.DB.Exec(`
-		UPDATE projects SET projectTitle = $1, projectDescription = $2, started = $3, completed = $4, managerId = $5
-		WHERE id = $6`,
-		project.ProjectTitle, project.ProjectDescription, project.Started, project.Completed, project.ManagerId, project.ID)
-	return err
+// UpdateProject saves the project and returns its new version. A non-zero
+// expectedVersion makes the update conditional on the stored version. The
+// manager is made an owner of the project.
+func (r *ProjectRepo) UpdateProject(ctx context.Context, project models.Project, expectedVersion int) (int, error) {
+	ctx = traced(ctx, "ProjectRepo.UpdateProject")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := checkInOrg(ctx, tx, liveOrgUsers, project.ManagerId, r.OrgID, ErrUserNotFound); err != nil {
+		return 0, err
+	}
+	var version int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE projects SET projectTitle = $1, projectDescription = $2, started = $3, completed = $4, managerId = $5, version = version + 1
+		WHERE id = $6 AND deleted_at IS NULL AND ($7 = 0 OR version = $7) AND org_id = $8
+		RETURNING version`,
+		project.ProjectTitle, project.ProjectDescription, project.Started, project.Completed, project.ManagerId, project.ID, expectedVersion, r.OrgID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, noRowsError(ctx, tx, "projects", "org_id = $%d", r.OrgID, project.ID, expectedVersion)
+	}
+	if err != nil {
+		return 0, constraintError(err, "Project already exists", "Manager not found")
+	}
+	if err := setMember(ctx, tx, project.ID, project.ManagerId, models.RoleOwner); err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
 }
 
-func (r *ProjectRepo) DeleteProject(id int) error {
-	_, err := r.DB.Exec("DELETE FROM projects WHERE id = $1", id)
-	return err
+// PatchProject changes the given fields. A new manager is made an owner of
+// the project.
+func (r *ProjectRepo) PatchProject(ctx context.Context, id int, fields map[string]any, expectedVersion int) (int, error) {
+	ctx = traced(ctx, "ProjectRepo.PatchProject")
+	managerID, newManager := fields["managerId"].(int)
+	if newManager {
+		if err := checkInOrg(ctx, r.DB, liveOrgUsers, managerID, r.OrgID, ErrUserNotFound); err != nil {
+			return 0, err
+		}
+	}
+	version, err := patchRow(ctx, r.DB, "projects", projectPatchColumns, "org_id = $%d", r.OrgID, id, fields, expectedVersion)
+	if err != nil {
+		return 0, constraintError(err, "Project already exists", "Manager not found")
+	}
+	if newManager {
+		if err := setMember(ctx, r.DB, id, managerID, models.RoleOwner); err != nil {
+			return 0, err
+		}
+	}
+	return version, nil
+}
+
+// DeleteProject moves a project and its tasks to the trash. The tasks share
+// the project's deleted_at so that RestoreProject can bring back exactly the
+// tasks that went with it.
+func (r *ProjectRepo) DeleteProject(ctx context.Context, id int, deletedBy *int, expectedVersion int) error {
+	ctx = traced(ctx, "ProjectRepo.DeleteProject")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, `
+		UPDATE projects SET deleted_at = $2, deleted_by = $3, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND ($4 = 0 OR version = $4) AND org_id = $5`,
+		id, now, deletedBy, expectedVersion, r.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkUpdated(ctx, tx, res, "projects", "org_id = $%d", r.OrgID, id, expectedVersion); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE tasks SET deleted_at = $2, deleted_by = $3, version = version + 1 WHERE projectId = $1 AND deleted_at IS NULL"+inOrg("projectId", orgProjects, 4), id, now, deletedBy, r.OrgID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetDeletedProjects returns the projects in the trash, or with a non-zero
+// memberID only those that user is a member of.
+func (r *ProjectRepo) GetDeletedProjects(ctx context.Context, memberID int) ([]models.Project, error) {
+	ctx = traced(ctx, "ProjectRepo.GetDeletedProjects")
+	rows, err := r.DB.QueryContext(ctx, "SELECT id, projectTitle, projectDescription, started, completed, managerId, version, deleted_at, deleted_by FROM projects WHERE deleted_at IS NOT NULL AND org_id = $1"+memberScope("id", memberID, 2)+" ORDER BY deleted_at DESC",
+		append([]any{r.OrgID}, memberArgs(memberID)...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	for rows.Next() {
+		var project models.Project
+		if err := rows.Scan(&project.ID, &project.ProjectTitle, &project.ProjectDescription, &project.Started, &project.Completed, &project.ManagerId, &project.Version, &project.DeletedAt, &project.DeletedBy); err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+// RestoreProject brings a project back from the trash together with the tasks
+// that were deleted along with it.
+func (r *ProjectRepo) RestoreProject(ctx context.Context, id int) error {
+	ctx = traced(ctx, "ProjectRepo.RestoreProject")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	err = tx.QueryRowContext(ctx, "SELECT deleted_at FROM projects WHERE id = $1 AND deleted_at IS NOT NULL AND org_id = $2 FOR UPDATE", id, r.OrgID).Scan(&deletedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotInTrash
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE projects SET deleted_at = NULL, deleted_by = NULL, version = version + 1 WHERE id = $1 AND org_id = $2", id, r.OrgID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE tasks SET deleted_at = NULL, deleted_by = NULL, version = version + 1 WHERE projectId = $1 AND deleted_at = $2"+inOrg("projectId", orgProjects, 3), id, deletedAt, r.OrgID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// purgeableProjects selects the IDs of the projects PurgeDeletedProjects
+// removes; $1 is the time they must have been deleted before.
+const purgeableProjects = `SELECT id FROM projects WHERE deleted_at < $1
+	AND NOT EXISTS (SELECT 1 FROM tasks WHERE tasks.projectId = projects.id)
+	AND NOT EXISTS (SELECT 1 FROM recurring_tasks WHERE recurring_tasks.projectId = projects.id)`
+
+// PurgeDeletedProjects permanently removes projects of every organization
+// deleted before the given time, together with the saved filters limited to
+// them. Projects that still have tasks, deleted or not, or recurring tasks
+// are kept until those are gone.
+func (r *ProjectRepo) PurgeDeletedProjects(ctx context.Context, before time.Time) (int64, error) {
+	ctx = traced(ctx, "ProjectRepo.PurgeDeletedProjects")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM saved_filters WHERE project_id IN ("+purgeableProjects+")", before); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM projects WHERE id IN ("+purgeableProjects+")", before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
 }
 
-func (r *ProjectRepo) SearchProjectsByTitle(title string) ([]models.Project, error) {
-	rows, err := r.DB.Query("SELECT id, projectTitle, projectDescription, started, completed, managerId FROM projects WHERE projectTitle ILIKE $1", "%"+title+"%")
+func (r *ProjectRepo) SearchProjectsByTitle(ctx context.Context, title string, memberID int) ([]models.Project, error) {
+	ctx = traced(ctx, "ProjectRepo.SearchProjectsByTitle")
+	rows, err := r.DB.QueryContext(ctx, "SELECT id, projectTitle, projectDescription, started, completed, managerId, version FROM projects WHERE projectTitle ILIKE $1 AND deleted_at IS NULL AND org_id = $2"+memberScope("id", memberID, 3),
+		append([]any{"%" + title + "%", r.OrgID}, memberArgs(memberID)...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +253,7 @@ func (r *ProjectRepo) SearchProjectsByTitle(title string) ([]models.Project, err
 	var projects []models.Project
 	for rows.Next() {
 		var project models.Project
-		if err := rows.Scan(&project.ID, &project.ProjectTitle, &project.ProjectDescription, &project.Started, &project.Completed, &project.ManagerId); err != nil {
+		if err := rows.Scan(&project.ID, &project.ProjectTitle, &project.ProjectDescription, &project.Started, &project.Completed, &project.ManagerId, &project.Version); err != nil {
 			return nil, err
 		}
 		projects = append(projects, project)
@@ -85,8 +261,10 @@ func (r *ProjectRepo) SearchProjectsByTitle(title string) ([]models.Project, err
 	return projects, nil
 }
 
-func (r *ProjectRepo) SearchProjectsByManager(managerId int) ([]models.Project, error) {
-	rows, err := r.DB.Query("SELECT id, projectTitle, projectDescription, started, completed, managerId FROM projects WHERE managerId = $1", managerId)
+func (r *ProjectRepo) SearchProjectsByManager(ctx context.Context, managerId int, memberID int) ([]models.Project, error) {
+	ctx = traced(ctx, "ProjectRepo.SearchProjectsByManager")
+	rows, err := r.DB.QueryContext(ctx, "SELECT id, projectTitle, projectDescription, started, completed, managerId, version FROM projects WHERE managerId = $1 AND deleted_at IS NULL AND org_id = $2"+memberScope("id", memberID, 3),
+		append([]any{managerId, r.OrgID}, memberArgs(memberID)...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +273,7 @@ func (r *ProjectRepo) SearchProjectsByManager(managerId int) ([]models.Project,
 	var projects []models.Project
 	for rows.Next() {
 		var project models.Project
-		if err := rows.Scan(&project.ID, &project.ProjectTitle, &project.ProjectDescription, &project.Started, &project.Completed, &project.ManagerId); err != nil {
+		if err := rows.Scan(&project.ID, &project.ProjectTitle, &project.ProjectDescription, &project.Started, &project.Completed, &project.ManagerId, &project.Version); err != nil {
 			return nil, err
 		}
 		projects = append(projects, project)
@@ -103,8 +281,9 @@ func (r *ProjectRepo) SearchProjectsByManager(managerId int) ([]models.Project,
 	return projects, nil
 }
 
-func (r *ProjectRepo) GetTasksByProjectID(projectID int) ([]models.Task, error) {
-	rows, err := r.DB.Query("SELECT id, title, description, priority, status, respId, projectId, creationDate, completionDate FROM tasks WHERE projectId = $1", projectID)
+func (r *ProjectRepo) GetTasksByProjectID(ctx context.Context, projectID int) ([]models.Task, error) {
+	ctx = traced(ctx, "ProjectRepo.GetTasksByProjectID")
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE projectId = $1 AND deleted_at IS NULL"+inOrg("projectId", orgProjects, 2), projectID, r.OrgID)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +292,7 @@ func (r *ProjectRepo) GetTasksByProjectID(projectID int) ([]models.Task, error)
 	var tasks []models.Task
 	for rows.Next() {
 		var task models.Task
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.Status, &task.RespId, &task.ProjectID, &task.CreationDate, &task.CompletionDate); err != nil {
+		if err := scanTask(rows, &task); err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, task)
@@ -0,0 +1,285 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/recurrence"
+)
+
+// RecurringTaskRepo works on the recurring tasks of the projects of
+// organization OrgID.
+type RecurringTaskRepo struct {
+	DB    *sql.DB
+	OrgID int
+}
+
+// orgRecurringTasks selects the IDs of an organization's recurring tasks; %d
+// is the organization's parameter number.
+const orgRecurringTasks = "SELECT id FROM recurring_tasks WHERE projectId IN (" + orgProjects + ")"
+
+const recurringTaskColumns = "id, title, description, priority, respId, projectId, rrule, timezone, starts_at, next_occurrence, created_at"
+
+func scanRecurringTask(row interface{ Scan(...any) error }, rt *models.RecurringTask) error {
+	return row.Scan(&rt.ID, &rt.Title, &rt.Description, &rt.Priority, &rt.RespId, &rt.ProjectID,
+		&rt.RRule, &rt.TimeZone, &rt.StartsAt, &rt.NextOccurrence, &rt.CreatedAt)
+}
+
+func seriesOf(rt models.RecurringTask) (recurrence.Series, error) {
+	return recurrence.NewSeries(rt.RRule, rt.TimeZone, rt.StartsAt)
+}
+
+func (r *RecurringTaskRepo) GetRecurringTasks(ctx context.Context, memberID int) ([]models.RecurringTask, error) {
+	ctx = traced(ctx, "RecurringTaskRepo.GetRecurringTasks")
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+recurringTaskColumns+" FROM recurring_tasks WHERE true"+inOrg("projectId", orgProjects, 1)+memberScope("projectId", memberID, 2)+" ORDER BY id",
+		append([]any{r.OrgID}, memberArgs(memberID)...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recurringTasks := []models.RecurringTask{}
+	for rows.Next() {
+		var rt models.RecurringTask
+		if err := scanRecurringTask(rows, &rt); err != nil {
+			return nil, err
+		}
+		recurringTasks = append(recurringTasks, rt)
+	}
+	return recurringTasks, rows.Err()
+}
+
+func (r *RecurringTaskRepo) GetRecurringTaskByID(ctx context.Context, id int) (*models.RecurringTask, error) {
+	ctx = traced(ctx, "RecurringTaskRepo.GetRecurringTaskByID")
+	row := r.DB.QueryRowContext(ctx, "SELECT "+recurringTaskColumns+" FROM recurring_tasks WHERE id = $1"+inOrg("projectId", orgProjects, 2), id, r.OrgID)
+	var rt models.RecurringTask
+	if err := scanRecurringTask(row, &rt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("Recurring task")
+		}
+		return nil, err
+	}
+	return &rt, nil
+}
+
+func (r *RecurringTaskRepo) CreateRecurringTask(ctx context.Context, rt models.RecurringTask) (int, error) {
+	ctx = traced(ctx, "RecurringTaskRepo.CreateRecurringTask")
+	if err := checkInOrg(ctx, r.DB, liveOrgProjects, rt.ProjectID, r.OrgID, ErrProjectNotFound); err != nil {
+		return 0, err
+	}
+	if err := checkInOrg(ctx, r.DB, liveOrgUsers, rt.RespId, r.OrgID, ErrUserNotFound); err != nil {
+		return 0, err
+	}
+	var id int
+	err := r.DB.QueryRowContext(ctx, `
+		INSERT INTO recurring_tasks (title, description, priority, respId, projectId, rrule, timezone, starts_at, next_occurrence, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+		rt.Title, rt.Description, rt.Priority, rt.RespId, rt.ProjectID, rt.RRule, rt.TimeZone, rt.StartsAt, rt.NextOccurrence, rt.CreatedAt).Scan(&id)
+	if err != nil {
+		return 0, constraintError(err, "Recurring task already exists", "Assignee or project not found")
+	}
+	return id, nil
+}
+
+// DeleteRecurringTask stops a series. Tasks already created from it are kept
+// and lose their link to the series.
+func (r *RecurringTaskRepo) DeleteRecurringTask(ctx context.Context, id int) error {
+	ctx = traced(ctx, "RecurringTaskRepo.DeleteRecurringTask")
+	res, err := r.DB.ExecContext(ctx, "DELETE FROM recurring_tasks WHERE id = $1"+inOrg("projectId", orgProjects, 2), id, r.OrgID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(res)
+}
+
+// GetOccurrenceStates returns the skipped occurrences of a series and the
+// tasks created for the others, keyed by occurrence in Unix seconds.
+func (r *RecurringTaskRepo) GetOccurrenceStates(ctx context.Context, id int) (skipped map[int64]bool, tasks map[int64]int, err error) {
+	ctx = traced(ctx, "RecurringTaskRepo.GetOccurrenceStates")
+	skipped = make(map[int64]bool)
+	rows, err := r.DB.QueryContext(ctx, "SELECT occurrence FROM recurrence_exceptions WHERE recurring_task_id = $1"+inOrg("recurring_task_id", orgRecurringTasks, 2), id, r.OrgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var occurrence time.Time
+		if err := rows.Scan(&occurrence); err != nil {
+			return nil, nil, err
+		}
+		skipped[occurrence.Unix()] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	tasks = make(map[int64]int)
+	rows, err = r.DB.QueryContext(ctx, "SELECT id, occurrence FROM tasks WHERE recurring_task_id = $1 AND deleted_at IS NULL"+inOrg("projectId", orgProjects, 2), id, r.OrgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var taskID int
+		var occurrence time.Time
+		if err := rows.Scan(&taskID, &occurrence); err != nil {
+			return nil, nil, err
+		}
+		tasks[occurrence.Unix()] = taskID
+	}
+	return skipped, tasks, rows.Err()
+}
+
+func (r *RecurringTaskRepo) IsSkipped(ctx context.Context, id int, occurrence time.Time) (bool, error) {
+	ctx = traced(ctx, "RecurringTaskRepo.IsSkipped")
+	var skipped bool
+	err := r.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM recurrence_exceptions WHERE recurring_task_id = $1 AND occurrence = $2"+inOrg("recurring_task_id", orgRecurringTasks, 3)+")", id, occurrence, r.OrgID).Scan(&skipped)
+	return skipped, err
+}
+
+// SkipOccurrence records that an occurrence must not produce a task. If its
+// task already exists it is moved to the trash. It returns ErrNotFound if
+// the recurring task does not exist.
+func (r *RecurringTaskRepo) SkipOccurrence(ctx context.Context, id int, occurrence time.Time, deletedBy *int) error {
+	ctx = traced(ctx, "RecurringTaskRepo.SkipOccurrence")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkInOrg(ctx, tx, orgRecurringTasks, id, r.OrgID, notFound("Recurring task")); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO recurrence_exceptions (recurring_task_id, occurrence) VALUES ($1, $2) ON CONFLICT DO NOTHING", id, occurrence); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE tasks SET deleted_at = $3, deleted_by = $4, version = version + 1
+		WHERE recurring_task_id = $1 AND occurrence = $2 AND deleted_at IS NULL`+inOrg("projectId", orgProjects, 5),
+		id, occurrence, time.Now(), deletedBy, r.OrgID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SaveOccurrence creates the task of a single occurrence ahead of schedule,
+// or updates it if it already exists, and returns its ID. The scheduler will
+// not create the occurrence again. It returns ErrNotFound if the task was
+// deleted.
+func (r *RecurringTaskRepo) SaveOccurrence(ctx context.Context, task models.Task) (int, error) {
+	ctx = traced(ctx, "RecurringTaskRepo.SaveOccurrence")
+	if err := checkInOrg(ctx, r.DB, orgRecurringTasks, *task.RecurringTaskID, r.OrgID, notFound("Recurring task")); err != nil {
+		return 0, err
+	}
+	if err := checkInOrg(ctx, r.DB, liveOrgUsers, task.RespId, r.OrgID, ErrUserNotFound); err != nil {
+		return 0, err
+	}
+	var id int
+	err := r.DB.QueryRowContext(ctx, `
+		INSERT INTO tasks (title, description, priority, status, respId, projectId, creationDate, completionDate, recurring_task_id, occurrence)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (recurring_task_id, occurrence) DO UPDATE SET
+			title = EXCLUDED.title, description = EXCLUDED.description, priority = EXCLUDED.priority, status = EXCLUDED.status,
+			respId = EXCLUDED.respId, completionDate = EXCLUDED.completionDate, version = tasks.version + 1
+		WHERE tasks.deleted_at IS NULL
+		RETURNING id`,
+		task.Title, task.Description, task.Priority, task.Status, task.RespId, task.ProjectID, task.CreationDate, task.CompletionDate,
+		task.RecurringTaskID, task.Occurrence).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, notFound("Task")
+	}
+	if err != nil {
+		return 0, constraintError(err, "Task already exists", "Assignee not found")
+	}
+	return id, nil
+}
+
+// MaterializeDue creates the next task of up to limit series of every
+// organization and returns how many tasks were created. A series is due once
+// its next occurrence has come, or earlier when none of its tasks is still
+// open, so that completing one occurrence brings up the next. Skipped
+// occurrences are passed over. Series are locked with SKIP LOCKED, so several
+// instances can run this at once.
+func (r *RecurringTaskRepo) MaterializeDue(ctx context.Context, now time.Time, limit int) (int, error) {
+	ctx = traced(ctx, "RecurringTaskRepo.MaterializeDue")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT r.id, r.title, r.description, r.priority, r.respId, r.projectId, r.rrule, r.timezone, r.starts_at, r.next_occurrence, r.created_at
+		FROM recurring_tasks r JOIN projects p ON p.id = r.projectId AND p.deleted_at IS NULL
+		WHERE r.next_occurrence IS NOT NULL AND (r.next_occurrence <= $1 OR NOT EXISTS (
+			SELECT 1 FROM tasks t WHERE t.recurring_task_id = r.id AND t.status <> 'done' AND t.deleted_at IS NULL))
+		ORDER BY r.next_occurrence
+		LIMIT $2
+		FOR UPDATE OF r SKIP LOCKED`, now, limit)
+	if err != nil {
+		return 0, err
+	}
+	var due []models.RecurringTask
+	for rows.Next() {
+		var rt models.RecurringTask
+		if err := scanRecurringTask(rows, &rt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, rt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, rt := range due {
+		n, err := materializeNext(ctx, tx, rt, now)
+		if err != nil {
+			return 0, fmt.Errorf("recurring task %d: %w", rt.ID, err)
+		}
+		created += n
+	}
+	return created, tx.Commit()
+}
+
+// materializeNext moves the series' next_occurrence one step forward and
+// creates the task for the occurrence it passed, unless that occurrence was
+// skipped. The following occurrence is left for a later run to decide on.
+func materializeNext(ctx context.Context, tx *sql.Tx, rt models.RecurringTask, now time.Time) (int, error) {
+	series, err := seriesOf(rt)
+	if err != nil {
+		return 0, err
+	}
+
+	occurrence := *rt.NextOccurrence
+	var next *time.Time
+	if t, ok := series.Next(occurrence); ok {
+		next = &t
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE recurring_tasks SET next_occurrence = $2 WHERE id = $1", rt.ID, next); err != nil {
+		return 0, err
+	}
+
+	var skipped bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM recurrence_exceptions WHERE recurring_task_id = $1 AND occurrence = $2)", rt.ID, occurrence).Scan(&skipped)
+	if err != nil || skipped {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO tasks (title, description, priority, status, respId, projectId, creationDate, completionDate, recurring_task_id, occurrence)
+		VALUES ($1, $2, $3, 'new', $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (recurring_task_id, occurrence) DO NOTHING`,
+		rt.Title, rt.Description, rt.Priority, rt.RespId, rt.ProjectID, now, occurrence.UTC(), rt.ID, occurrence)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
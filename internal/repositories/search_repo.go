@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/allwsaa/project-api/internal/dialect"
+)
+
+// IndexedSearchLanguage is the text search configuration the stored
+// search_vector columns are built with.
+const IndexedSearchLanguage = "english"
+
+// SearchRepo searches the tasks and projects of organization OrgID.
+type SearchRepo struct {
+	DB    *sql.DB
+	OrgID int
+}
+
+type SearchHit struct {
+	ID        int     `json:"id"`
+	Title     string  `json:"title"`
+	Snippet   string  `json:"snippet" example:"Prepare the <mark>release</mark> checklist"`
+	Rank      float64 `json:"rank"`
+	ProjectID int     `json:"projectId,omitempty"`
+}
+
+// PrefixQuery turns free text into a tsquery that matches documents
+// containing every word, each as a prefix, e.g. "rel check" becomes
+// 'rel':* & 'check':*. It returns "" if the text has no searchable words.
+func PrefixQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = "'" + strings.ToLower(word) + "':*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// LanguageExists reports whether language is a text search configuration.
+// SQLite does not stem words, so it searches every language alike.
+func (r *SearchRepo) LanguageExists(ctx context.Context, language string) (bool, error) {
+	ctx = traced(ctx, "SearchRepo.LanguageExists")
+	if dialect.Of(r.DB) == dialect.SQLite {
+		return true, nil
+	}
+	var exists bool
+	err := r.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = $1)", language).Scan(&exists)
+	return exists, err
+}
+
+// SearchTasks ranks the tasks matching query. A non-zero memberID limits the
+// results to the projects that user is a member of.
+func (r *SearchRepo) SearchTasks(ctx context.Context, query, language string, limit int, memberID int) ([]SearchHit, error) {
+	ctx = traced(ctx, "SearchRepo.SearchTasks")
+	search := r.searchSQL(language, "tasks", "title", "description")
+	rows, err := r.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, title, projectId, %[1]s AS rank, %[2]s
+		FROM %[3]s
+		WHERE deleted_at IS NULL AND %[4]s%[5]s
+		ORDER BY rank DESC, id
+		LIMIT $3`, search.rank, search.snippet, search.from, search.match, inOrg("projectId", orgProjects, 4)+memberScope("projectId", memberID, 5)), append([]any{language, query, limit, r.OrgID}, memberArgs(memberID)...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		var hit SearchHit
+		if err := rows.Scan(&hit.ID, &hit.Title, &hit.ProjectID, &hit.Rank, &hit.Snippet); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+func (r *SearchRepo) SearchProjects(ctx context.Context, query, language string, limit int, memberID int) ([]SearchHit, error) {
+	ctx = traced(ctx, "SearchRepo.SearchProjects")
+	search := r.searchSQL(language, "projects", "projectTitle", "projectDescription")
+	rows, err := r.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, projectTitle, %[1]s AS rank, %[2]s
+		FROM %[3]s
+		WHERE deleted_at IS NULL AND %[4]s%[5]s
+		ORDER BY rank DESC, id
+		LIMIT $3`, search.rank, search.snippet, search.from, search.match, " AND org_id = $4"+memberScope("id", memberID, 5)), append([]any{language, query, limit, r.OrgID}, memberArgs(memberID)...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		var hit SearchHit
+		if err := rows.Scan(&hit.ID, &hit.Title, &hit.Rank, &hit.Snippet); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// searchSQL is the SQL of a search in language $1 for the query $2: the
+// table to search, with the query as q in PostgreSQL, the condition for a
+// row to match, and the expressions ranking it and highlighting the words
+// that matched.
+type searchSQL struct {
+	from, match, rank, snippet string
+}
+
+func (r *SearchRepo) searchSQL(language, table, titleColumn, bodyColumn string) searchSQL {
+	text := titleColumn + " || ' ' || " + bodyColumn
+	if dialect.Of(r.DB) == dialect.SQLite {
+		rank := fmt.Sprintf("search_rank(%s, %s, $2)", titleColumn, bodyColumn)
+		return searchSQL{
+			from:    table,
+			match:   rank + " > 0",
+			rank:    rank,
+			snippet: "search_snippet(" + text + ", $2)",
+		}
+	}
+	vector := searchVector(language, titleColumn, bodyColumn)
+	return searchSQL{
+		from:    table + ", to_tsquery($1::regconfig, $2) q",
+		match:   vector + " @@ q",
+		rank:    "ts_rank(" + vector + ", q)",
+		snippet: "ts_headline($1::regconfig, " + text + ", q, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')",
+	}
+}
+
+// searchVector returns the indexed search_vector column when the search uses
+// the indexed language and an equivalent expression built with the requested
+// language otherwise.
+func searchVector(language, titleColumn, bodyColumn string) string {
+	if language == IndexedSearchLanguage {
+		return "search_vector"
+	}
+	return fmt.Sprintf("(setweight(to_tsvector($1::regconfig, coalesce(%s, '')), 'A') || setweight(to_tsvector($1::regconfig, coalesce(%s, '')), 'B'))", titleColumn, bodyColumn)
+}
@@ -0,0 +1,696 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allwsaa/project-api/database"
+	"github.com/allwsaa/project-api/internal/config"
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/notify"
+)
+
+// The tests in this file run the repositories against a real, embedded
+// SQLite database with every migration applied, so the SQL itself is
+// exercised without an external service.
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	cfg := config.Default().Database
+	cfg.Driver = "sqlite"
+	cfg.Path = filepath.Join(t.TempDir(), "test.db")
+	db, err := database.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// fixture is an organization with an admin, a second user and a project
+// managed by the admin.
+type fixture struct {
+	db        *sql.DB
+	orgID     int
+	adminID   int
+	userID    int
+	projectID int
+}
+
+func newFixture(t *testing.T) fixture {
+	t.Helper()
+	db := openSQLite(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	orgs := OrganizationRepo{DB: db}
+	orgID, adminID, err := orgs.CreateOrganization(ctx,
+		models.Organization{Name: "Acme", CreatedAt: now},
+		models.User{Name: "Ada", Email: "ada@example.com", Role: "manager", RegistrationDate: now})
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	users := UserRepo{DB: db, OrgID: orgID}
+	userID, err := users.CreateUser(ctx, models.User{Name: "Bob", Email: "bob@example.com", Role: "developer", RegistrationDate: now})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	projects := ProjectRepo{DB: db, OrgID: orgID}
+	projectID, err := projects.CreateProject(ctx, models.Project{
+		ProjectTitle: "Launch", ProjectDescription: "Ship the release", ManagerId: adminID,
+		Started: now, Completed: now.Add(30 * 24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	return fixture{db: db, orgID: orgID, adminID: adminID, userID: userID, projectID: projectID}
+}
+
+func (f fixture) tasks() *TaskRepo {
+	return &TaskRepo{DB: f.db, OrgID: f.orgID}
+}
+
+func (f fixture) createTask(t *testing.T, title, description string, due time.Time) int {
+	t.Helper()
+	id, err := f.tasks().CreateTask(context.Background(), models.Task{
+		Title: title, Description: description, Priority: "high", Status: "new",
+		RespId: f.adminID, ProjectID: f.projectID, CreationDate: time.Now(), CompletionDate: due}, &f.adminID)
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	return id
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	db := openSQLite(t)
+	latest, err := database.LatestMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := database.SchemaVersion(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != latest {
+		t.Errorf("schema version = %d, want %d", version, latest)
+	}
+}
+
+func TestSQLiteTasks(t *testing.T) {
+	f := newFixture(t)
+	repo := f.tasks()
+	due := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	id := f.createTask(t, "Write release notes", "Summarize the changes", due)
+
+	task, err := repo.GetTaskByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetTaskByID: %v", err)
+	}
+	if task.Title != "Write release notes" || !task.CompletionDate.Equal(due) || task.Version != 1 {
+		t.Errorf("GetTaskByID = %+v", task)
+	}
+
+	task.Status = "inprogress"
+	version, err := repo.UpdateTask(context.Background(), *task, 1, nil)
+	if err != nil || version != 2 {
+		t.Fatalf("UpdateTask = %d, %v; want 2, nil", version, err)
+	}
+	if _, err := repo.UpdateTask(context.Background(), *task, 1, nil); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("UpdateTask with a stale version: err = %v, want ErrVersionMismatch", err)
+	}
+	version, err = repo.PatchTask(context.Background(), id, map[string]any{"priority": "low"}, 2, nil)
+	if err != nil || version != 3 {
+		t.Fatalf("PatchTask = %d, %v; want 3, nil", version, err)
+	}
+
+	found, err := repo.FindTasks(context.Background(), models.TaskFilter{Title: "RELEASE", Priority: "low"}, models.Page{})
+	if err != nil {
+		t.Fatalf("FindTasks: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != id {
+		t.Errorf("FindTasks = %+v, want task %d", found, id)
+	}
+	n, err := repo.CountTasks(context.Background(), models.TaskFilter{Status: "inprogress"})
+	if err != nil || n != 1 {
+		t.Errorf("CountTasks = %d, %v; want 1, nil", n, err)
+	}
+
+	if err := repo.DeleteTask(context.Background(), id, &f.adminID, 3); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	if _, err := repo.GetTaskByID(context.Background(), id); err == nil {
+		t.Error("GetTaskByID of a deleted task succeeded")
+	}
+	deleted, err := repo.GetDeletedTasks(context.Background(), 0)
+	if err != nil || len(deleted) != 1 || deleted[0].DeletedAt == nil {
+		t.Fatalf("GetDeletedTasks = %+v, %v", deleted, err)
+	}
+	if err := repo.RestoreTask(context.Background(), id); err != nil {
+		t.Fatalf("RestoreTask: %v", err)
+	}
+	if err := repo.DeleteTask(context.Background(), id, &f.adminID, 5); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	purged, err := repo.PurgeDeletedTasks(context.Background(), time.Now().Add(time.Minute))
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeDeletedTasks = %d, %v; want 1, nil", purged, err)
+	}
+}
+
+func TestSQLiteUsersAndMembers(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	users := UserRepo{DB: f.db, OrgID: f.orgID}
+
+	found, err := users.FindUsersByName(ctx, "bo")
+	if err != nil || len(found) != 1 || found[0].ID != f.userID {
+		t.Errorf("FindUsersByName = %+v, %v", found, err)
+	}
+	found, err = users.FindUsersByEmail(ctx, "BOB@EXAMPLE.COM")
+	if err != nil || len(found) != 1 {
+		t.Errorf("FindUsersByEmail = %+v, %v", found, err)
+	}
+
+	members := MemberRepo{DB: f.db, OrgID: f.orgID}
+	if err := members.SetMember(ctx, f.projectID, f.userID, models.RoleContributor); err != nil {
+		t.Fatalf("SetMember: %v", err)
+	}
+	role, err := members.GetRole(ctx, f.projectID, f.userID)
+	if err != nil || role != models.RoleContributor {
+		t.Errorf("GetRole = %q, %v", role, err)
+	}
+	if err := members.RemoveMember(ctx, f.projectID, f.adminID); !errors.Is(err, ErrLastOwner) {
+		t.Errorf("RemoveMember of the last owner: err = %v, want ErrLastOwner", err)
+	}
+	list, err := members.GetMembers(ctx, f.projectID)
+	if err != nil || len(list) != 2 {
+		t.Errorf("GetMembers = %+v, %v", list, err)
+	}
+
+	projects := ProjectRepo{DB: f.db, OrgID: f.orgID}
+	visible, err := projects.GetAllProjects(ctx, f.userID, models.Page{})
+	if err != nil || len(visible) != 1 {
+		t.Errorf("GetAllProjects = %+v, %v", visible, err)
+	}
+}
+
+func TestSQLiteBulkUpdate(t *testing.T) {
+	f := newFixture(t)
+	a := f.createTask(t, "First", "", time.Now())
+	b := f.createTask(t, "Second", "", time.Now())
+
+	results, err := f.tasks().BulkUpdateTasks(context.Background(), []int{a, b}, models.TaskFilter{}, 1000, TaskChange{Status: "done"}, false)
+	if err != nil {
+		t.Fatalf("BulkUpdateTasks: %v", err)
+	}
+	for _, res := range results {
+		if res.Result != BulkUpdated {
+			t.Errorf("task %d: result = %q, want %q", res.ID, res.Result, BulkUpdated)
+		}
+	}
+	n, err := f.tasks().CountTasks(context.Background(), models.TaskFilter{Status: "done"})
+	if err != nil || n != 2 {
+		t.Errorf("CountTasks = %d, %v; want 2, nil", n, err)
+	}
+
+	// A filter may select no more tasks than the limit.
+	_, err = f.tasks().BulkUpdateTasks(context.Background(), nil, models.TaskFilter{Status: "done"}, 1, TaskChange{Delete: true}, false)
+	if !errors.Is(err, ErrTooManyTasks) {
+		t.Errorf("BulkUpdateTasks of 2 tasks with a limit of 1: err = %v, want ErrTooManyTasks", err)
+	}
+	results, err = f.tasks().BulkUpdateTasks(context.Background(), nil, models.TaskFilter{Status: "done"}, 2, TaskChange{Priority: "low"}, true)
+	if err != nil || len(results) != 2 {
+		t.Errorf("BulkUpdateTasks of 2 tasks with a limit of 2 = %+v, %v; want 2 results", results, err)
+	}
+}
+
+func TestSQLiteSearch(t *testing.T) {
+	f := newFixture(t)
+	want := f.createTask(t, "Prepare the release checklist", "", time.Now())
+	f.createTask(t, "Book a venue", "For the release party", time.Now())
+	f.createTask(t, "Unrelated", "", time.Now())
+
+	repo := SearchRepo{DB: f.db, OrgID: f.orgID}
+	hits, err := repo.SearchTasks(context.Background(), PrefixQuery("rel check"), "english", 10, 0)
+	if err != nil {
+		t.Fatalf("SearchTasks: %v", err)
+	}
+	if len(hits) != 1 || hits[0].ID != want {
+		t.Fatalf("SearchTasks = %+v, want task %d", hits, want)
+	}
+	if !strings.Contains(hits[0].Snippet, "Prepare the <mark>release</mark> <mark>checklist</mark>") {
+		t.Errorf("snippet = %q", hits[0].Snippet)
+	}
+
+	hits, err = repo.SearchTasks(context.Background(), PrefixQuery("release"), "english", 10, 0)
+	if err != nil {
+		t.Fatalf("SearchTasks: %v", err)
+	}
+	if len(hits) != 2 || hits[0].ID != want {
+		t.Errorf("SearchTasks = %+v, want the title match first", hits)
+	}
+}
+
+func TestSQLiteRecurringTasks(t *testing.T) {
+	f := newFixture(t)
+	repo := RecurringTaskRepo{DB: f.db, OrgID: f.orgID}
+	start := time.Now().Add(-73 * time.Hour).Truncate(time.Second)
+	if _, err := repo.CreateRecurringTask(context.Background(), models.RecurringTask{
+		Title: "Stand-up", Priority: "low", RespId: f.adminID, ProjectID: f.projectID,
+		RRule: "FREQ=DAILY", TimeZone: "UTC", StartsAt: start, NextOccurrence: &start}); err != nil {
+		t.Fatalf("CreateRecurringTask: %v", err)
+	}
+
+	// Each run creates the next task of the series, until its next
+	// occurrence is in the future.
+	created := 0
+	for i := 0; i < 10; i++ {
+		n, err := repo.MaterializeDue(context.Background(), time.Now(), 100)
+		if err != nil {
+			t.Fatalf("MaterializeDue: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		created += n
+	}
+	if created != 4 {
+		t.Errorf("MaterializeDue created %d tasks, want 4", created)
+	}
+	n, err := f.tasks().CountTasks(context.Background(), models.TaskFilter{Title: "Stand-up"})
+	if err != nil || n != created {
+		t.Errorf("CountTasks = %d, %v; want %d", n, err, created)
+	}
+}
+
+func TestSQLiteNotificationsAndOutbox(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	now := time.Now()
+	id := f.createTask(t, "Renew certificate", "", now.Add(time.Hour))
+
+	notifications := NotificationRepo{DB: f.db}
+	due, err := notifications.GetTasksToNotify(ctx, "reminder", "24h", now, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetTasksToNotify: %v", err)
+	}
+	if len(due) != 1 || due[0].TaskID != id || due[0].RecipientID != f.adminID {
+		t.Fatalf("GetTasksToNotify = %+v", due)
+	}
+	created, err := notifications.CreateNotification(ctx, models.Notification{
+		UserID: f.adminID, TaskID: id, Kind: "reminder", Threshold: "24h", DueAt: due[0].DueAt, Message: "due soon"})
+	if err != nil || !created {
+		t.Fatalf("CreateNotification = %v, %v", created, err)
+	}
+	if created, err := notifications.CreateNotification(ctx, models.Notification{
+		UserID: f.adminID, TaskID: id, Kind: "reminder", Threshold: "24h", DueAt: due[0].DueAt, Message: "due soon"}); err != nil || created {
+		t.Errorf("duplicate CreateNotification = %v, %v; want false, nil", created, err)
+	}
+	due, err = notifications.GetTasksToNotify(ctx, "reminder", "24h", now, now.Add(24*time.Hour))
+	if err != nil || len(due) != 0 {
+		t.Errorf("GetTasksToNotify after notifying = %+v, %v", due, err)
+	}
+
+	outbox := OutboxRepo{DB: f.db}
+	if err := outbox.Enqueue(ctx, f.adminID, "task.due", map[string]any{"taskId": id}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	var got []OutboxEmail
+	sent, failed, err := outbox.SendDue(ctx, time.Now().Add(time.Second), 10, 3, func(e OutboxEmail) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil || sent != 1 || failed != 0 {
+		t.Fatalf("SendDue = %d, %d, %v; want 1, 0, nil", sent, failed, err)
+	}
+	if got[0].Recipient.Email != "ada@example.com" {
+		t.Errorf("recipient = %+v", got[0].Recipient)
+	}
+}
+
+// TestSQLiteAssignmentEmails checks that the email to a task's new assignee
+// is queued by the write itself, and that emails are claimed rather than
+// locked while they are sent.
+func TestSQLiteAssignmentEmails(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	members := MemberRepo{DB: f.db, OrgID: f.orgID}
+	if err := members.SetMember(ctx, f.projectID, f.userID, models.RoleContributor); err != nil {
+		t.Fatalf("SetMember: %v", err)
+	}
+	queued := func() int {
+		var n int
+		if err := f.db.QueryRow("SELECT count(*) FROM email_outbox").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	id := f.createTask(t, "Write changelog", "", time.Now().Add(time.Hour))
+	if n := queued(); n != 0 {
+		t.Fatalf("%d emails queued for a task assigned to its creator, want 0", n)
+	}
+	if _, err := f.tasks().PatchTask(ctx, id, map[string]any{"respId": f.userID}, 5, &f.adminID); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("stale PatchTask = %v, want ErrVersionMismatch", err)
+	}
+	if n := queued(); n != 0 {
+		t.Fatalf("%d emails queued by a failed write, want 0", n)
+	}
+	if _, err := f.tasks().PatchTask(ctx, id, map[string]any{"respId": f.userID}, 1, &f.adminID); err != nil {
+		t.Fatalf("PatchTask: %v", err)
+	}
+	if _, err := f.tasks().PatchTask(ctx, id, map[string]any{"title": "Write the changelog"}, 2, &f.adminID); err != nil {
+		t.Fatalf("PatchTask: %v", err)
+	}
+	if n := queued(); n != 1 {
+		t.Fatalf("%d emails queued, want 1 for the reassignment", n)
+	}
+
+	outbox := OutboxRepo{DB: f.db}
+	now := time.Now().Add(time.Second)
+	var got []OutboxEmail
+	sent, failed, err := outbox.SendDue(ctx, now, 10, 3, func(e OutboxEmail) error {
+		got = append(got, e)
+		// Another sender running meanwhile must not get the same email.
+		if sent, failed, err := outbox.SendDue(ctx, now, 10, 3, func(e OutboxEmail) error {
+			t.Errorf("email %d sent twice", e.ID)
+			return nil
+		}); err != nil || sent+failed != 0 {
+			t.Errorf("concurrent SendDue = %d, %d, %v; want 0, 0, nil", sent, failed, err)
+		}
+		return nil
+	})
+	if err != nil || sent != 1 || failed != 0 {
+		t.Fatalf("SendDue = %d, %d, %v; want 1, 0, nil", sent, failed, err)
+	}
+	var event notify.TaskAssigned
+	if err := json.Unmarshal(got[0].Payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Recipient.Email != "bob@example.com" || event.TaskID != id || event.AssignedBy != "Ada" {
+		t.Errorf("email = %+v, %+v; want Bob told that Ada assigned task %d", got[0].Recipient, event, id)
+	}
+}
+
+// TestSQLiteSendDueStopsWhenCancelled checks that SendDue sends no more
+// emails once its context is cancelled, and keeps the outcome of the one it
+// was sending.
+func TestSQLiteSendDueStopsWhenCancelled(t *testing.T) {
+	f := newFixture(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	outbox := OutboxRepo{DB: f.db}
+	for i := 0; i < 2; i++ {
+		if err := outbox.Enqueue(ctx, f.adminID, "task.due", map[string]any{"n": i}); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	sent, failed, err := outbox.SendDue(ctx, time.Now().Add(time.Second), 10, 3, func(e OutboxEmail) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || sent != 1 || failed != 0 {
+		t.Fatalf("SendDue = %d, %d, %v; want 1, 0, context.Canceled", sent, failed, err)
+	}
+	var delivered, pending int
+	if err := f.db.QueryRow("SELECT count(*) FILTER (WHERE status = 'sent'), count(*) FILTER (WHERE status = 'pending') FROM email_outbox").Scan(&delivered, &pending); err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 1 || pending != 1 {
+		t.Errorf("outbox holds %d sent and %d pending emails, want 1 and 1", delivered, pending)
+	}
+}
+
+// TestSQLiteCommentMentions checks that a comment queues an email for each
+// member of the task's project it mentions, with the comment.
+func TestSQLiteCommentMentions(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	members := MemberRepo{DB: f.db, OrgID: f.orgID}
+	if err := members.SetMember(ctx, f.projectID, f.userID, models.RoleContributor); err != nil {
+		t.Fatalf("SetMember: %v", err)
+	}
+	users := UserRepo{DB: f.db, OrgID: f.orgID}
+	if _, err := users.CreateUser(ctx, models.User{Name: "Carol", Email: "carol@example.com", Role: "developer", RegistrationDate: time.Now()}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	taskID := f.createTask(t, "Write changelog", "", time.Now().Add(time.Hour))
+
+	comments := CommentRepo{DB: f.db, OrgID: f.orgID}
+	tests := []struct {
+		author int
+		body   string
+		want   []int // the users emailed
+	}{
+		// Authors are not told about their own mentions, nor users outside
+		// the project, and an email address is not a mention.
+		{f.adminID, "@bob @ada @carol, mail ada@example.com or @bob again", []int{f.userID}},
+		{f.userID, "Thanks @ADA.", []int{f.adminID}},
+		{f.userID, "No mentions here", nil},
+	}
+	for _, tt := range tests {
+		before := time.Now()
+		id, err := comments.CreateComment(ctx, models.Comment{TaskID: taskID, AuthorID: &tt.author, Body: tt.body, CreatedAt: before})
+		if err != nil {
+			t.Fatalf("CreateComment(%q): %v", tt.body, err)
+		}
+		rows, err := f.db.Query("SELECT user_id, payload FROM email_outbox WHERE event = 'mentioned' AND created_at >= $1 ORDER BY id", before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for rows.Next() {
+			var userID int
+			var payload []byte
+			var event notify.Mentioned
+			if err := rows.Scan(&userID, &payload); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(payload, &event); err != nil || event.CommentID != id || event.Comment != tt.body || event.Title != "Write changelog" {
+				t.Errorf("payload = %s, want comment %d", payload, id)
+			}
+			got = append(got, userID)
+		}
+		rows.Close()
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%q emailed %v, want %v", tt.body, got, tt.want)
+		}
+	}
+
+	list, err := comments.GetComments(ctx, taskID)
+	if err != nil || len(list) != len(tests) || list[0].Body != tests[0].body || *list[1].AuthorID != f.userID {
+		t.Errorf("GetComments = %+v, %v", list, err)
+	}
+	if err := f.tasks().DeleteTask(ctx, taskID, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := comments.CreateComment(ctx, models.Comment{TaskID: taskID, Body: "Hi", CreatedAt: time.Now()}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("comment on a task in the trash = %v, want ErrNotFound", err)
+	}
+}
+
+// TestSQLiteDueDateInOtherZone checks that a due date given with an offset is
+// stored as the instant it names, and reminded of at that instant.
+func TestSQLiteDueDateInOtherZone(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	due := time.Date(2030, 1, 2, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	id := f.createTask(t, "Renew certificate", "", due)
+
+	task, err := f.tasks().GetTaskByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetTaskByID: %v", err)
+	}
+	if want := time.Date(2030, 1, 2, 8, 0, 0, 0, time.UTC); !task.CompletionDate.Equal(want) {
+		t.Errorf("due date = %v, want %v", task.CompletionDate, want)
+	}
+
+	notifications := NotificationRepo{DB: f.db}
+	tests := []struct {
+		after, before time.Time
+		want          int
+	}{
+		{due.Add(-time.Hour), due, 1},
+		{due.Add(-time.Hour), due.Add(-time.Second), 0},
+		{due, due.Add(2 * time.Hour), 0},
+	}
+	for _, tt := range tests {
+		got, err := notifications.GetTasksToNotify(ctx, "reminder", "1h", tt.after.UTC(), tt.before.UTC())
+		if err != nil || len(got) != tt.want {
+			t.Errorf("GetTasksToNotify(%v, %v) = %+v, %v; want %d tasks", tt.after.UTC(), tt.before.UTC(), got, err, tt.want)
+		}
+	}
+}
+
+func TestSQLiteFilters(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	members := MemberRepo{DB: f.db, OrgID: f.orgID}
+	if err := members.SetMember(ctx, f.projectID, f.userID, models.RoleViewer); err != nil {
+		t.Fatalf("SetMember: %v", err)
+	}
+
+	repo := FilterRepo{DB: f.db, OrgID: f.orgID}
+	criteria := models.TaskFilter{Status: "new", Priority: "high"}
+	id, err := repo.CreateFilter(ctx, models.SavedFilter{
+		Name: "Urgent", OwnerID: f.adminID, ProjectID: &f.projectID, Criteria: criteria, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateFilter: %v", err)
+	}
+	filters, err := repo.GetVisibleFilters(ctx, f.userID)
+	if err != nil {
+		t.Fatalf("GetVisibleFilters: %v", err)
+	}
+	if len(filters) != 1 || filters[0].ID != id || filters[0].Criteria != criteria {
+		t.Errorf("GetVisibleFilters = %+v", filters)
+	}
+	exists, err := repo.FilterNameExists(ctx, f.adminID, "Urgent")
+	if err != nil || !exists {
+		t.Errorf("FilterNameExists = %v, %v; want true, nil", exists, err)
+	}
+}
+
+// Saved filters refer to their owner and project without ON DELETE, so the
+// purge must remove them first or the trash could never be emptied.
+func TestSQLitePurgeSavedFilters(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	filters := FilterRepo{DB: f.db, OrgID: f.orgID}
+	projectFilter, err := filters.CreateFilter(ctx, models.SavedFilter{
+		Name: "Launch", OwnerID: f.adminID, ProjectID: &f.projectID, Criteria: models.TaskFilter{Status: "new"}, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateFilter: %v", err)
+	}
+	userFilter, err := filters.CreateFilter(ctx, models.SavedFilter{
+		Name: "Mine", OwnerID: f.userID, Criteria: models.TaskFilter{Status: "new"}, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateFilter: %v", err)
+	}
+
+	projects := ProjectRepo{DB: f.db, OrgID: f.orgID}
+	if err := projects.DeleteProject(ctx, f.projectID, &f.adminID, 0); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+	users := UserRepo{DB: f.db, OrgID: f.orgID}
+	if err := users.DeleteUser(ctx, f.userID, &f.adminID, 0); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	before := time.Now().Add(time.Minute)
+	if n, err := projects.PurgeDeletedProjects(ctx, before); err != nil || n != 1 {
+		t.Errorf("PurgeDeletedProjects = %d, %v; want 1, nil", n, err)
+	}
+	if n, err := users.PurgeDeletedUsers(ctx, before); err != nil || n != 1 {
+		t.Errorf("PurgeDeletedUsers = %d, %v; want 1, nil", n, err)
+	}
+	for _, id := range []int{projectFilter, userFilter} {
+		if _, err := filters.GetFilterByID(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetFilterByID(%d) after the purge: err = %v, want ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestSQLitePaging(t *testing.T) {
+	f := newFixture(t)
+	due := time.Now().Add(time.Hour)
+	var ids []int
+	for _, title := range []string{"One", "Two", "Three", "Four", "Five"} {
+		ids = append(ids, f.createTask(t, title, "", due))
+	}
+
+	var got []int
+	page := models.Page{Limit: 2}
+	for {
+		tasks, err := f.tasks().FindTasks(context.Background(), models.TaskFilter{}, page)
+		if err != nil {
+			t.Fatalf("FindTasks: %v", err)
+		}
+		for _, task := range tasks {
+			got = append(got, task.ID)
+		}
+		if len(tasks) < page.Limit {
+			break
+		}
+		page.After = tasks[len(tasks)-1].ID
+	}
+	if fmt.Sprint(got) != fmt.Sprint(ids) {
+		t.Errorf("paged task IDs = %v, want %v", got, ids)
+	}
+
+	users := UserRepo{DB: f.db, OrgID: f.orgID}
+	rest, err := users.GetAll(context.Background(), models.Page{After: f.adminID})
+	if err != nil || len(rest) != 1 || rest[0].ID != f.userID {
+		t.Errorf("GetAll after the admin = %+v, %v; want only user %d", rest, err, f.userID)
+	}
+}
+
+func TestSQLiteErrors(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	projects := ProjectRepo{DB: f.db, OrgID: f.orgID}
+	users := UserRepo{DB: f.db, OrgID: f.orgID}
+
+	// Missing rows are ErrNotFound, for reads and writes alike.
+	if _, err := f.tasks().GetTaskByID(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetTaskByID of a missing task: err = %v, want ErrNotFound", err)
+	}
+	if _, err := projects.UpdateProject(ctx, models.Project{ID: 999, ProjectTitle: "Ghost", ManagerId: f.adminID}, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateProject of a missing project: err = %v, want ErrNotFound", err)
+	}
+	if err := projects.DeleteProject(ctx, 999, nil, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteProject of a missing project: err = %v, want ErrNotFound", err)
+	}
+	if err := (&FilterRepo{DB: f.db, OrgID: f.orgID}).DeleteFilter(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteFilter of a missing filter: err = %v, want ErrNotFound", err)
+	}
+
+	// A conditional write is ErrVersionMismatch only if the row exists in the
+	// organization: a missing row, or one of another organization, is
+	// ErrNotFound whatever version was expected.
+	taskID := f.createTask(t, "Versioned", "", time.Now())
+	if _, err := f.tasks().PatchTask(ctx, taskID, map[string]any{"title": "Stale"}, 5, nil); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("PatchTask at a stale version: err = %v, want ErrVersionMismatch", err)
+	}
+	if _, err := f.tasks().PatchTask(ctx, 999, map[string]any{"title": "Ghost"}, 5, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("PatchTask of a missing task with a version: err = %v, want ErrNotFound", err)
+	}
+	if _, err := projects.UpdateProject(ctx, models.Project{ID: 999, ProjectTitle: "Ghost", ManagerId: f.adminID}, 5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateProject of a missing project with a version: err = %v, want ErrNotFound", err)
+	}
+	if err := users.DeleteUser(ctx, 999, nil, 5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteUser of a missing user with a version: err = %v, want ErrNotFound", err)
+	}
+	otherOrgID, _, err := (&OrganizationRepo{DB: f.db}).CreateOrganization(ctx,
+		models.Organization{Name: "Globex", CreatedAt: time.Now()},
+		models.User{Name: "Gus", Email: "gus@example.com", Role: "manager", RegistrationDate: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	other := TaskRepo{DB: f.db, OrgID: otherOrgID}
+	if err := other.DeleteTask(ctx, taskID, nil, 5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteTask of another organization's task with a version: err = %v, want ErrNotFound", err)
+	}
+
+	// Constraint violations are ErrConflict and ErrForeignKey.
+	_, err = users.CreateUser(ctx, models.User{Name: "Bobby", Email: "bob@example.com", Role: "developer", RegistrationDate: time.Now()})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("CreateUser with a taken email: err = %v, want ErrConflict", err)
+	}
+	if _, err := users.PatchUser(ctx, f.userID, map[string]any{"email": "ada@example.com"}, 0); !errors.Is(err, ErrConflict) {
+		t.Errorf("PatchUser to a taken email: err = %v, want ErrConflict", err)
+	}
+	_, err = f.db.ExecContext(ctx, "INSERT INTO tasks (title, priority, status, respId, projectId, creationDate, completionDate) VALUES ('Orphan', 'low', 'new', 999, $1, $2, $2)",
+		f.projectID, time.Now())
+	if err := constraintError(err, "Task already exists", "Assignee not found"); !errors.Is(err, ErrForeignKey) {
+		t.Errorf("inserting a task with a missing respId: err = %v, want ErrForeignKey", err)
+	}
+	if _, err := f.tasks().CreateTask(ctx, models.Task{Title: "Orphan", RespId: 999, ProjectID: f.projectID}, nil); !errors.Is(err, ErrForeignKey) {
+		t.Errorf("CreateTask with a missing assignee: err = %v, want ErrForeignKey", err)
+	}
+}
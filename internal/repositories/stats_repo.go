@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// StatsRepo counts tasks of every organization for the metrics endpoint.
+// Tasks in the trash or in deleted projects are not counted.
+type StatsRepo struct {
+	DB *sql.DB
+}
+
+// TaskCount is the number of tasks with a status and priority.
+type TaskCount struct {
+	Status   string
+	Priority string
+	Count    int
+}
+
+// CountOpenTasks counts the tasks that are not done by status and priority.
+func (r *StatsRepo) CountOpenTasks(ctx context.Context) ([]TaskCount, error) {
+	ctx = traced(ctx, "StatsRepo.CountOpenTasks")
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT t.status, t.priority, count(*) FROM tasks t JOIN projects p ON p.id = t.projectId
+		WHERE t.deleted_at IS NULL AND p.deleted_at IS NULL AND t.status <> 'done'
+		GROUP BY t.status, t.priority`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []TaskCount
+	for rows.Next() {
+		var count TaskCount
+		if err := rows.Scan(&count.Status, &count.Priority, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// CountOverdueTasks counts the tasks that are not done and were due before
+// now.
+func (r *StatsRepo) CountOverdueTasks(ctx context.Context, now time.Time) (int, error) {
+	ctx = traced(ctx, "StatsRepo.CountOverdueTasks")
+	var count int
+	err := r.DB.QueryRowContext(ctx, `
+		SELECT count(*) FROM tasks t JOIN projects p ON p.id = t.projectId
+		WHERE t.deleted_at IS NULL AND p.deleted_at IS NULL AND t.status <> 'done' AND t.completionDate < $1`, now).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,201 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/apperr"
+	"github.com/allwsaa/project-api/internal/models"
+)
+
+// TaskChange is the change a bulk operation applies to every selected task.
+// Only non-zero fields are changed; Delete moves the tasks to the trash.
+// With a non-zero EditorID only the tasks of the projects that user may edit
+// tasks in are changed. Assigner is the user reassigning the tasks, whom the
+// emails to their new assignees name.
+type TaskChange struct {
+	Status    string
+	Priority  string
+	RespId    int
+	ProjectID int
+	Delete    bool
+	DeletedBy *int
+	EditorID  int
+	Assigner  *int
+}
+
+// Outcomes of a bulk operation for a single task.
+const (
+	BulkUpdated   = "updated"
+	BulkDeleted   = "deleted"
+	BulkUnchanged = "unchanged"
+	BulkNotFound  = "not_found"
+	BulkNotMember = "not_member"
+	BulkForbidden = "forbidden"
+)
+
+// ErrTooManyTasks is returned by BulkUpdateTasks when its filter matches more
+// tasks than a single bulk operation may change.
+var ErrTooManyTasks = apperr.New(apperr.Validation, "Filter matches too many tasks")
+
+type BulkTaskResult struct {
+	ID     int          `json:"id"`
+	Result string       `json:"result" enums:"updated,deleted,unchanged,not_found,not_member,forbidden"`
+	Task   *models.Task `json:"task,omitempty"`
+}
+
+// BulkUpdateTasks applies change to the tasks with the given IDs, or to the
+// tasks matching filter when ids is empty, inside a single transaction. A
+// filter matching more than limit tasks fails with ErrTooManyTasks and
+// changes nothing. A task of a project change.EditorID may only view is left
+// unchanged and reported as BulkForbidden, and one whose assignee would not be
+// a contributing member of its project as BulkNotMember. Reassigned tasks
+// queue their assignment emails in the same transaction. With dryRun the
+// transaction is rolled back, so the results are a preview of what the
+// operation would do.
+func (r *TaskRepo) BulkUpdateTasks(ctx context.Context, ids []int, filter models.TaskFilter, limit int, change TaskChange, dryRun bool) ([]BulkTaskResult, error) {
+	ctx = traced(ctx, "TaskRepo.BulkUpdateTasks")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tasks, err := lockTasks(ctx, tx, r.OrgID, ids, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []BulkTaskResult
+	if len(ids) > 0 {
+		found := make(map[int]bool, len(tasks))
+		for _, task := range tasks {
+			found[task.ID] = true
+		}
+		for _, id := range ids {
+			if !found[id] {
+				results = append(results, BulkTaskResult{ID: id, Result: BulkNotFound})
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, task := range tasks {
+		if change.EditorID != 0 {
+			ok, err := canBeAssigned(ctx, tx, r.OrgID, task.ProjectID, change.EditorID)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				results = append(results, BulkTaskResult{ID: task.ID, Result: BulkForbidden, Task: &task})
+				continue
+			}
+		}
+		if change.Delete {
+			if _, err := tx.ExecContext(ctx, "UPDATE tasks SET deleted_at = $2, deleted_by = $3, version = version + 1 WHERE id = $1"+inOrg("projectId", orgProjects, 4), task.ID, now, change.DeletedBy, r.OrgID); err != nil {
+				return nil, err
+			}
+			task.DeletedAt = &now
+			task.DeletedBy = change.DeletedBy
+			task.Version++
+			results = append(results, BulkTaskResult{ID: task.ID, Result: BulkDeleted, Task: &task})
+			continue
+		}
+
+		updated := task
+		if change.Status != "" {
+			updated.Status = change.Status
+		}
+		if change.Priority != "" {
+			updated.Priority = change.Priority
+		}
+		if change.RespId != 0 {
+			updated.RespId = change.RespId
+		}
+		if change.ProjectID != 0 {
+			updated.ProjectID = change.ProjectID
+		}
+		if updated == task {
+			results = append(results, BulkTaskResult{ID: task.ID, Result: BulkUnchanged, Task: &task})
+			continue
+		}
+		if updated.RespId != task.RespId || updated.ProjectID != task.ProjectID {
+			ok, err := canBeAssigned(ctx, tx, r.OrgID, updated.ProjectID, updated.RespId)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				results = append(results, BulkTaskResult{ID: task.ID, Result: BulkNotMember, Task: &task})
+				continue
+			}
+		}
+
+		err := tx.QueryRowContext(ctx, `
+			UPDATE tasks SET status = $1, priority = $2, respId = $3, projectId = $4, version = version + 1
+			WHERE id = $5`+inOrg("projectId", orgProjects, 6)+` RETURNING version`,
+			updated.Status, updated.Priority, updated.RespId, updated.ProjectID, task.ID, r.OrgID).Scan(&updated.Version)
+		if err != nil {
+			return nil, err
+		}
+		if updated.RespId != task.RespId {
+			if err := queueAssignment(ctx, tx, task.ID, change.Assigner); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, BulkTaskResult{ID: task.ID, Result: BulkUpdated, Task: &updated})
+	}
+
+	if dryRun {
+		return results, nil
+	}
+	return results, tx.Commit()
+}
+
+// lockTasks loads and locks the tasks of organization orgID a bulk operation
+// works on. Tasks listed by ID are limited to the projects of filter.MemberID
+// as well. At most limit tasks matching a filter are locked; one more fails
+// with ErrTooManyTasks.
+func lockTasks(ctx context.Context, tx *sql.Tx, orgID int, ids []int, filter models.TaskFilter, limit int) ([]models.Task, error) {
+	var where, limitClause string
+	var args []any
+	if len(ids) > 0 {
+		placeholders := make([]string, len(ids))
+		for i, id := range ids {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+			args = append(args, id)
+		}
+		where = "deleted_at IS NULL AND id IN (" + strings.Join(placeholders, ", ") + ")" +
+			inOrg("projectId", orgProjects, len(ids)+1) + memberScope("projectId", filter.MemberID, len(ids)+2)
+		args = append(args, orgID)
+		args = append(args, memberArgs(filter.MemberID)...)
+	} else {
+		where, args = taskFilterWhere(filter, orgID, 0)
+		args = append(args, limit+1)
+		limitClause = fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE "+where+" ORDER BY id"+limitClause+" FOR UPDATE", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		var task models.Task
+		if err := scanTask(rows, &task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 && len(tasks) > limit {
+		return nil, apperr.Wrap(apperr.Validation, fmt.Sprintf("Filter matches more than %d tasks, narrow it down", limit), ErrTooManyTasks)
+	}
+	return tasks, nil
+}
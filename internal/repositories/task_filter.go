@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/allwsaa/project-api/internal/models"
+)
+
+// taskFilterWhere renders the filter as a SQL condition on the tasks of
+// organization orgID. Parameter numbering starts after the given number of
+// arguments already in use.
+func taskFilterWhere(f models.TaskFilter, orgID int, argsInUse int) (string, []any) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []any
+	add := func(format string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, argsInUse+len(args)))
+	}
+
+	add("projectId IN ("+orgProjects+")", orgID)
+	if f.Title != "" {
+		add("title ILIKE '%%' || $%d || '%%'", f.Title)
+	}
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.Priority != "" {
+		add("priority = $%d", f.Priority)
+	}
+	if f.RespId != 0 {
+		add("respId = $%d", f.RespId)
+	}
+	if f.ProjectID != 0 {
+		add("projectId = $%d", f.ProjectID)
+	}
+	if f.MemberID != 0 {
+		add("projectId IN ("+memberProjects+")", f.MemberID)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (r *TaskRepo) FindTasks(ctx context.Context, filter models.TaskFilter, page models.Page) ([]models.Task, error) {
+	ctx = traced(ctx, "TaskRepo.FindTasks")
+	where, args := taskFilterWhere(filter, r.OrgID, 0)
+	paging, pageArgs := pageClause(page, len(args)+1)
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE "+where+paging, append(args, pageArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.Task
+	for rows.Next() {
+		var task models.Task
+		if err := scanTask(rows, &task); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+func (r *TaskRepo) CountTasks(ctx context.Context, filter models.TaskFilter) (int, error) {
+	ctx = traced(ctx, "TaskRepo.CountTasks")
+	where, args := taskFilterWhere(filter, r.OrgID, 0)
+	var count int
+	err := r.DB.QueryRowContext(ctx, "SELECT count(*) FROM tasks WHERE "+where, args...).Scan(&count)
+	return count, err
+}
@@ -1,18 +1,30 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"time"
 
 	"github.com/allwsaa/project-api/internal/models"
 )
 
+// TaskRepo works on the tasks of the projects of organization OrgID.
 type TaskRepo struct {
-	DB *sql.DB
+	DB    *sql.DB
+	OrgID int
 }
 
-func (r *TaskRepo) GetTasks() ([]models.Task, error) {
-	rows, err := r.DB.Query("SELECT id, title, description, priority, status, respId, projectId, creationDate, completionDate FROM tasks")
+// taskColumns lists the columns scanTask reads, in order.
+const taskColumns = "id, title, description, priority, status, respId, projectId, creationDate, completionDate, version, deleted_at, deleted_by, recurring_task_id, occurrence"
+
+func scanTask(row interface{ Scan(...any) error }, task *models.Task) error {
+	return row.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.Status, &task.RespId, &task.ProjectID,
+		&task.CreationDate, &task.CompletionDate, &task.Version, &task.DeletedAt, &task.DeletedBy, &task.RecurringTaskID, &task.Occurrence)
+}
+
+func (r *TaskRepo) GetTasks(ctx context.Context) ([]models.Task, error) {
+	ctx = traced(ctx, "TaskRepo.GetTasks")
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NULL"+inOrg("projectId", orgProjects, 1), r.OrgID)
 	if err != nil {
 		return nil, err
 	}
@@ -21,7 +33,7 @@ func (r *TaskRepo) GetTasks() ([]models.Task, error) {
 	var tasks []models.Task
 	for rows.Next() {
 		var task models.Task
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.Status, &task.RespId, &task.ProjectID, &task.CreationDate, &task.CompletionDate); err != nil {
+		if err := scanTask(rows, &task); err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, task)
@@ -29,100 +41,162 @@ func (r *TaskRepo) GetTasks() ([]models.Task, error) {
 	return tasks, nil
 }
 
-func (r *TaskRepo) CreateTask(task models.Task) (int, error) {
+// CreateTask saves a new task and returns its ID. The email telling the
+// assignee is queued with it, unless assigner, the user creating the task,
+// assigned it to themselves.
+func (r *TaskRepo) CreateTask(ctx context.Context, task models.Task, assigner *int) (int, error) {
+	ctx = traced(ctx, "TaskRepo.CreateTask")
+	if err := r.checkRefs(ctx, task.ProjectID, task.RespId); err != nil {
+		return 0, err
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	var id int
-	err := r.DB.QueryRow(`
+	err = tx.QueryRowContext(ctx, `
 		INSERT INTO tasks (title, description, priority, status, respId, projectId, creationDate, completionDate)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
 		task.Title, task.Description, task.Priority, task.Status, task.RespId, task.ProjectID, task.CreationDate, task.CompletionDate).Scan(&id)
 	if err != nil {
+		return 0, constraintError(err, "Task already exists", "Assignee or project not found")
+	}
+	if err := queueAssignment(ctx, tx, id, assigner); err != nil {
 		return 0, err
 	}
-	return id, nil
+	return id, tx.Commit()
 }
 
-func (r *TaskRepo) GetTaskByID(id int) (*models.Task, error) {
-	row := r.DB.QueryRow("SELECT id, title, description, priority, status, respId, projectId, creationDate, completionDate FROM tasks WHERE id = $1", id)
+func (r *TaskRepo) GetTaskByID(ctx context.Context, id int) (*models.Task, error) {
+	ctx = traced(ctx, "TaskRepo.GetTaskByID")
+	row := r.DB.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = $1 AND deleted_at IS NULL"+inOrg("projectId", orgProjects, 2), id, r.OrgID)
 	var task models.Task
-	err := row.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.Status, &task.RespId, &task.ProjectID, &task.CreationDate, &task.CompletionDate)
+	err := scanTask(row, &task)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("task with this ID not found")
+			return nil, notFound("Task")
 		}
 		return nil, err
 	}
 	return &task, nil
 }
 
-func (r *TaskRepo) UpdateTask(task models.Task) error {
-	_, err := r.DB.Exec(`
-		UPDATE tasks SET title = $1, description = $2, priority = $3, status = $4, respId = $5, projectId = $6, creationDate = $7, completionDate = $8
-		WHERE id = $9`,
-		task.Title, task.Description, task.Priority, task.Status, task.RespId, task.ProjectID, task.CreationDate, task.CompletionDate, task.ID)
-	return err
-}
-
-func (r *TaskRepo) DeleteTask(id int) error {
-	_, err := r.DB.Exec("DELETE FROM tasks WHERE id = $1", id)
-	return err
-}
-
-func (r *TaskRepo) FindTasksByTitle(title string) ([]models.Task, error) {
-	rows, err := r.DB.Query("SELECT id, title, description, priority, status, respId, projectId, creationDate, completionDate FROM tasks WHERE title ILIKE '%' || $1 || '%'", title)
+// UpdateTask saves the task and returns its new version. A non-zero
+// expectedVersion makes the update conditional on the stored version. If the
+// task gets a new assignee, the email telling them is queued with it, as in
+// CreateTask.
+func (r *TaskRepo) UpdateTask(ctx context.Context, task models.Task, expectedVersion int, assigner *int) (int, error) {
+	ctx = traced(ctx, "TaskRepo.UpdateTask")
+	if err := r.checkRefs(ctx, task.ProjectID, task.RespId); err != nil {
+		return 0, err
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var tasks []models.Task
-	for rows.Next() {
-		var task models.Task
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.Status, &task.RespId, &task.ProjectID, &task.CreationDate, &task.CompletionDate); err != nil {
-			return nil, err
+	previous, err := lockAssignee(ctx, tx, r.OrgID, task.ID)
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE tasks SET title = $1, description = $2, priority = $3, status = $4, respId = $5, projectId = $6, creationDate = $7, completionDate = $8, version = version + 1
+		WHERE id = $9 AND deleted_at IS NULL AND ($10 = 0 OR version = $10)`+inOrg("projectId", orgProjects, 11)+`
+		RETURNING version`,
+		task.Title, task.Description, task.Priority, task.Status, task.RespId, task.ProjectID, task.CreationDate, task.CompletionDate, task.ID, expectedVersion, r.OrgID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, noRowsError(ctx, tx, "tasks", "projectId IN ("+orgProjects+")", r.OrgID, task.ID, expectedVersion)
+	}
+	if err != nil {
+		return 0, constraintError(err, "Task already exists", "Assignee or project not found")
+	}
+	if task.RespId != previous {
+		if err := queueAssignment(ctx, tx, task.ID, assigner); err != nil {
+			return 0, err
 		}
-		tasks = append(tasks, task)
 	}
-	return tasks, nil
+	return version, tx.Commit()
 }
 
-func (r *TaskRepo) FindTasksByStatus(status string) ([]models.Task, error) {
-	rows, err := r.DB.Query("SELECT id, title, description, priority, status, respId, projectId, creationDate, completionDate FROM tasks WHERE status = $1", status)
+// PatchTask writes only the given fields of the task and returns its new
+// version, as UpdateTask.
+func (r *TaskRepo) PatchTask(ctx context.Context, id int, fields map[string]any, expectedVersion int, assigner *int) (int, error) {
+	ctx = traced(ctx, "TaskRepo.PatchTask")
+	if projectID, ok := fields["projectId"].(int); ok {
+		if err := checkInOrg(ctx, r.DB, liveOrgProjects, projectID, r.OrgID, ErrProjectNotFound); err != nil {
+			return 0, err
+		}
+	}
+	respID, reassigned := fields["respId"].(int)
+	if reassigned {
+		if err := checkInOrg(ctx, r.DB, liveOrgUsers, respID, r.OrgID, ErrUserNotFound); err != nil {
+			return 0, err
+		}
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var tasks []models.Task
-	for rows.Next() {
-		var task models.Task
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.Status, &task.RespId, &task.ProjectID, &task.CreationDate, &task.CompletionDate); err != nil {
-			return nil, err
+	previous, err := lockAssignee(ctx, tx, r.OrgID, id)
+	if err != nil {
+		return 0, err
+	}
+	version, err := patchRow(ctx, tx, "tasks", taskPatchColumns, "projectId IN ("+orgProjects+")", r.OrgID, id, fields, expectedVersion)
+	if err != nil {
+		return 0, constraintError(err, "Task already exists", "Assignee or project not found")
+	}
+	if reassigned && respID != previous {
+		if err := queueAssignment(ctx, tx, id, assigner); err != nil {
+			return 0, err
 		}
-		tasks = append(tasks, task)
 	}
-	return tasks, nil
+	return version, tx.Commit()
 }
 
-func (r *TaskRepo) FindTasksByPriority(priority string) ([]models.Task, error) {
-	rows, err := r.DB.Query("SELECT id, title, description, priority, status, respId, projectId, creationDate, completionDate FROM tasks WHERE priority = $1", priority)
-	if err != nil {
-		return nil, err
+// lockAssignee locks the task of organization orgID for a write and returns
+// its assignee, or 0 if there is no such task, which the write then reports.
+func lockAssignee(ctx context.Context, tx *sql.Tx, orgID, id int) (int, error) {
+	var respID int
+	err := tx.QueryRowContext(ctx, "SELECT respId FROM tasks WHERE id = $1 AND deleted_at IS NULL"+inOrg("projectId", orgProjects, 2)+" FOR UPDATE", id, orgID).Scan(&respID)
+	if err == sql.ErrNoRows {
+		return 0, nil
 	}
-	defer rows.Close()
+	return respID, err
+}
 
-	var tasks []models.Task
-	for rows.Next() {
-		var task models.Task
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.Status, &task.RespId, &task.ProjectID, &task.CreationDate, &task.CompletionDate); err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, task)
+// checkRefs fails unless the task's project and assignee belong to the
+// repository's organization and are not in the trash.
+func (r *TaskRepo) checkRefs(ctx context.Context, projectID, respID int) error {
+	if err := checkInOrg(ctx, r.DB, liveOrgProjects, projectID, r.OrgID, ErrProjectNotFound); err != nil {
+		return err
 	}
-	return tasks, nil
+	return checkInOrg(ctx, r.DB, liveOrgUsers, respID, r.OrgID, ErrUserNotFound)
 }
 
-func (r *TaskRepo) FindTasksByAssignedUserId(userID int) ([]models.Task, error) {
-	rows, err := r.DB.Query("SELECT id, title, description, priority, status, respId, projectId, creationDate, completionDate FROM tasks WHERE respId = $1", userID)
+func (r *TaskRepo) DeleteTask(ctx context.Context, id int, deletedBy *int, expectedVersion int) error {
+	ctx = traced(ctx, "TaskRepo.DeleteTask")
+	res, err := r.DB.ExecContext(ctx, `
+		UPDATE tasks SET deleted_at = $2, deleted_by = $3, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND ($4 = 0 OR version = $4)`+inOrg("projectId", orgProjects, 5),
+		id, time.Now(), deletedBy, expectedVersion, r.OrgID)
+	if err != nil {
+		return err
+	}
+	return checkUpdated(ctx, r.DB, res, "tasks", "projectId IN ("+orgProjects+")", r.OrgID, id, expectedVersion)
+}
+
+// GetDeletedTasks returns the tasks in the trash, or with a non-zero memberID
+// only those of the projects that user is a member of.
+func (r *TaskRepo) GetDeletedTasks(ctx context.Context, memberID int) ([]models.Task, error) {
+	ctx = traced(ctx, "TaskRepo.GetDeletedTasks")
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NOT NULL"+inOrg("projectId", orgProjects, 1)+memberScope("projectId", memberID, 2)+" ORDER BY deleted_at DESC",
+		append([]any{r.OrgID}, memberArgs(memberID)...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -131,28 +205,58 @@ func (r *TaskRepo) FindTasksByAssignedUserId(userID int) ([]models.Task, error)
 	var tasks []models.Task
 	for rows.Next() {
 		var task models.Task
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.Status, &task.RespId, &task.ProjectID, &task.CreationDate, &task.CompletionDate); err != nil {
+		if err := scanTask(rows, &task); err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, task)
 	}
-	return tasks, nil
+	return tasks, rows.Err()
 }
 
-func (r *TaskRepo) FindTasksByProject(projectID int) ([]models.Task, error) {
-	rows, err := r.DB.Query("SELECT id, title, description, priority, status, respId, projectId, creationDate, completionDate FROM tasks WHERE projectId = $1", projectID)
+// GetDeletedTaskByID returns a task in the trash, or ErrNotInTrash.
+func (r *TaskRepo) GetDeletedTaskByID(ctx context.Context, id int) (*models.Task, error) {
+	ctx = traced(ctx, "TaskRepo.GetDeletedTaskByID")
+	row := r.DB.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = $1 AND deleted_at IS NOT NULL"+inOrg("projectId", orgProjects, 2), id, r.OrgID)
+	var task models.Task
+	err := scanTask(row, &task)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotInTrash
+		}
 		return nil, err
 	}
-	defer rows.Close()
+	return &task, nil
+}
 
-	var tasks []models.Task
-	for rows.Next() {
-		var task models.Task
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.Status, &task.RespId, &task.ProjectID, &task.CreationDate, &task.CompletionDate); err != nil {
-			return nil, err
+// RestoreTask brings a task back from the trash. A task cannot be restored
+// while its project is still deleted.
+func (r *TaskRepo) RestoreTask(ctx context.Context, id int) error {
+	ctx = traced(ctx, "TaskRepo.RestoreTask")
+	var projectDeleted bool
+	err := r.DB.QueryRowContext(ctx, `
+		SELECT p.deleted_at IS NOT NULL FROM tasks t JOIN projects p ON p.id = t.projectId
+		WHERE t.id = $1 AND t.deleted_at IS NOT NULL AND p.org_id = $2`, id, r.OrgID).Scan(&projectDeleted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotInTrash
 		}
-		tasks = append(tasks, task)
+		return err
 	}
-	return tasks, nil
+	if projectDeleted {
+		return ErrParentDeleted
+	}
+
+	_, err = r.DB.ExecContext(ctx, "UPDATE tasks SET deleted_at = NULL, deleted_by = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL"+inOrg("projectId", orgProjects, 2), id, r.OrgID)
+	return err
+}
+
+// PurgeDeletedTasks permanently removes the tasks of every organization
+// deleted before the given time.
+func (r *TaskRepo) PurgeDeletedTasks(ctx context.Context, before time.Time) (int64, error) {
+	ctx = traced(ctx, "TaskRepo.PurgeDeletedTasks")
+	res, err := r.DB.ExecContext(ctx, "DELETE FROM tasks WHERE deleted_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
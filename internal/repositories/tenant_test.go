@@ -0,0 +1,368 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/models"
+)
+
+// The tests in this file point the repositories of one organization at the
+// rows of another, in a real SQLite database, and check that every method
+// acts as if those rows did not exist: reads find nothing and writes fail
+// without changing them.
+
+// tenant is the fixture's organization filled with one row of every kind,
+// some of them in the trash.
+type tenant struct {
+	fixture
+	taskID, trashedTaskID       int
+	trashedProjectID            int
+	trashedUserID               int
+	filterID, recurringID       int
+	occurrence                  time.Time
+	otherOrgID, otherAdminID    int
+	otherProjectID, otherUserID int
+}
+
+func newTenant(t *testing.T) tenant {
+	t.Helper()
+	ctx := context.Background()
+	tn := tenant{fixture: newFixture(t)}
+	now := time.Now()
+
+	tn.taskID = tn.createTask(t, "Launch plan", "Plan the release", now)
+	tn.trashedTaskID = tn.createTask(t, "Old plan", "", now)
+	if err := tn.tasks().DeleteTask(ctx, tn.trashedTaskID, &tn.adminID, 0); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+
+	projects := ProjectRepo{DB: tn.db, OrgID: tn.orgID}
+	var err error
+	tn.trashedProjectID, err = projects.CreateProject(ctx, models.Project{
+		ProjectTitle: "Retired", ManagerId: tn.adminID, Started: now, Completed: now})
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	if err := projects.DeleteProject(ctx, tn.trashedProjectID, &tn.adminID, 0); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+
+	users := UserRepo{DB: tn.db, OrgID: tn.orgID}
+	tn.trashedUserID, err = users.CreateUser(ctx, models.User{Name: "Eve", Email: "eve@example.com", Role: "developer", RegistrationDate: now})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := users.DeleteUser(ctx, tn.trashedUserID, &tn.adminID, 0); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	members := MemberRepo{DB: tn.db, OrgID: tn.orgID}
+	if err := members.SetMember(ctx, tn.projectID, tn.userID, models.RoleContributor); err != nil {
+		t.Fatalf("SetMember: %v", err)
+	}
+	comments := CommentRepo{DB: tn.db, OrgID: tn.orgID}
+	if _, err := comments.CreateComment(ctx, models.Comment{TaskID: tn.taskID, AuthorID: &tn.adminID, Body: "@bob take a look", CreatedAt: now}); err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+	filters := FilterRepo{DB: tn.db, OrgID: tn.orgID}
+	tn.filterID, err = filters.CreateFilter(ctx, models.SavedFilter{
+		Name: "Open", OwnerID: tn.adminID, ProjectID: &tn.projectID, Criteria: models.TaskFilter{Status: "new"}, CreatedAt: now})
+	if err != nil {
+		t.Fatalf("CreateFilter: %v", err)
+	}
+	recurring := RecurringTaskRepo{DB: tn.db, OrgID: tn.orgID}
+	tn.occurrence = now.Add(24 * time.Hour).Truncate(time.Second)
+	tn.recurringID, err = recurring.CreateRecurringTask(ctx, models.RecurringTask{
+		Title: "Stand-up", Priority: "low", RespId: tn.adminID, ProjectID: tn.projectID,
+		RRule: "FREQ=DAILY", TimeZone: "UTC", StartsAt: tn.occurrence, NextOccurrence: &tn.occurrence, CreatedAt: now})
+	if err != nil {
+		t.Fatalf("CreateRecurringTask: %v", err)
+	}
+
+	tn.otherOrgID, tn.otherAdminID, err = (&OrganizationRepo{DB: tn.db}).CreateOrganization(ctx,
+		models.Organization{Name: "Globex", CreatedAt: now},
+		models.User{Name: "Gus", Email: "gus@example.com", Role: "manager", RegistrationDate: now})
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	tn.otherProjectID, err = (&ProjectRepo{DB: tn.db, OrgID: tn.otherOrgID}).CreateProject(ctx, models.Project{
+		ProjectTitle: "Rollout", ManagerId: tn.otherAdminID, Started: now, Completed: now})
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	tn.otherUserID, err = (&UserRepo{DB: tn.db, OrgID: tn.otherOrgID}).CreateUser(ctx, models.User{
+		Name: "Hank", Email: "hank@example.com", Role: "developer", RegistrationDate: now})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return tn
+}
+
+// snapshot returns everything the fixture's organization holds, so that a
+// test can check that none of it changed.
+func (tn tenant) snapshot(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+	users := UserRepo{DB: tn.db, OrgID: tn.orgID}
+	projects := ProjectRepo{DB: tn.db, OrgID: tn.orgID}
+	members := MemberRepo{DB: tn.db, OrgID: tn.orgID}
+	filters := FilterRepo{DB: tn.db, OrgID: tn.orgID}
+	recurring := RecurringTaskRepo{DB: tn.db, OrgID: tn.orgID}
+
+	var parts []any
+	add := func(v any, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		parts = append(parts, v)
+	}
+	add(users.GetAll(ctx, models.Page{}))
+	add(users.GetDeletedUsers(ctx))
+	add(tn.tasks().GetTasks(ctx))
+	add(tn.tasks().GetDeletedTasks(ctx, 0))
+	add(projects.GetAllProjects(ctx, 0, models.Page{}))
+	add(projects.GetDeletedProjects(ctx, 0))
+	add(members.GetMembers(ctx, tn.projectID))
+	add(filters.GetVisibleFilters(ctx, tn.adminID))
+	add(recurring.GetRecurringTasks(ctx, 0))
+	add((&CommentRepo{DB: tn.db, OrgID: tn.orgID}).GetComments(ctx, tn.taskID))
+	skipped, tasks, err := recurring.GetOccurrenceStates(ctx, tn.recurringID)
+	add(fmt.Sprint(skipped, tasks), err)
+	snapshot, err := json.Marshal(parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(snapshot)
+}
+
+// crossTenant calls every method of the organization-scoped repositories of
+// organization orgID on the fixture's rows and fails the test if any of
+// them reaches one. projectID and userID belong to that organization, so
+// that writes can name a valid project or user of their own; they are 0 if
+// it has none.
+func (tn tenant) crossTenant(t *testing.T, orgID, projectID, userID int) {
+	ctx := context.Background()
+	users := UserRepo{DB: tn.db, OrgID: orgID}
+	tasks := TaskRepo{DB: tn.db, OrgID: orgID}
+	projects := ProjectRepo{DB: tn.db, OrgID: orgID}
+	members := MemberRepo{DB: tn.db, OrgID: orgID}
+	filters := FilterRepo{DB: tn.db, OrgID: orgID}
+	recurring := RecurringTaskRepo{DB: tn.db, OrgID: orgID}
+	comments := CommentRepo{DB: tn.db, OrgID: orgID}
+	search := SearchRepo{DB: tn.db, OrgID: orgID}
+	orgs := OrganizationRepo{DB: tn.db}
+	now := time.Now()
+
+	// fails checks that a method failed with want.
+	fails := func(method string, err, want error) {
+		t.Helper()
+		if !errors.Is(err, want) {
+			t.Errorf("%s: err = %v, want %v", method, err, want)
+		}
+	}
+	// finds checks that a method found none of the fixture's rows: n is how
+	// many it found.
+	finds := func(method string, n int, err error) {
+		t.Helper()
+		if err != nil || n != 0 {
+			t.Errorf("%s found %d rows, %v; want none", method, n, err)
+		}
+	}
+
+	all, err := users.GetAll(ctx, models.Page{})
+	for _, user := range all {
+		if user.ID == tn.adminID || user.ID == tn.userID {
+			t.Errorf("UserRepo.GetAll found user %d of another organization", user.ID)
+		}
+	}
+	if err != nil {
+		t.Errorf("UserRepo.GetAll: %v", err)
+	}
+	_, err = users.GetUserByID(ctx, tn.userID)
+	fails("UserRepo.GetUserByID", err, ErrNotFound)
+	_, err = users.UpdateUser(ctx, models.User{ID: tn.userID, Name: "Mallory", Email: "mallory@example.com", Role: "developer"}, 0)
+	fails("UserRepo.UpdateUser", err, ErrNotFound)
+	_, err = users.PatchUser(ctx, tn.userID, map[string]any{"name": "Mallory"}, 1)
+	fails("UserRepo.PatchUser", err, ErrNotFound)
+	fails("UserRepo.DeleteUser", users.DeleteUser(ctx, tn.userID, nil, 0), ErrNotFound)
+	deletedUsers, err := users.GetDeletedUsers(ctx)
+	finds("UserRepo.GetDeletedUsers", len(deletedUsers), err)
+	fails("UserRepo.RestoreUser", users.RestoreUser(ctx, tn.trashedUserID), ErrNotInTrash)
+	userTasks, err := users.GetTasksByUserID(ctx, tn.adminID, 0)
+	finds("UserRepo.GetTasksByUserID", len(userTasks), err)
+	byName, err := users.FindUsersByName(ctx, "Ada")
+	finds("UserRepo.FindUsersByName", len(byName), err)
+	byEmail, err := users.FindUsersByEmail(ctx, "ada@example.com")
+	finds("UserRepo.FindUsersByEmail", len(byEmail), err)
+
+	allTasks, err := tasks.GetTasks(ctx)
+	finds("TaskRepo.GetTasks", len(allTasks), err)
+	_, err = tasks.GetTaskByID(ctx, tn.taskID)
+	fails("TaskRepo.GetTaskByID", err, ErrNotFound)
+	_, err = tasks.CreateTask(ctx, models.Task{Title: "Planted", Priority: "low", Status: "new", RespId: tn.adminID, ProjectID: tn.projectID}, nil)
+	fails("TaskRepo.CreateTask", err, ErrForeignKey)
+	if projectID != 0 {
+		_, err = tasks.UpdateTask(ctx, models.Task{ID: tn.taskID, Title: "Hijacked", Priority: "low", Status: "new", RespId: userID, ProjectID: projectID}, 0, nil)
+		fails("TaskRepo.UpdateTask", err, ErrNotFound)
+	}
+	_, err = tasks.PatchTask(ctx, tn.taskID, map[string]any{"title": "Hijacked"}, 1, nil)
+	fails("TaskRepo.PatchTask", err, ErrNotFound)
+	fails("TaskRepo.DeleteTask", tasks.DeleteTask(ctx, tn.taskID, nil, 1), ErrNotFound)
+	deletedTasks, err := tasks.GetDeletedTasks(ctx, 0)
+	finds("TaskRepo.GetDeletedTasks", len(deletedTasks), err)
+	_, err = tasks.GetDeletedTaskByID(ctx, tn.trashedTaskID)
+	fails("TaskRepo.GetDeletedTaskByID", err, ErrNotInTrash)
+	fails("TaskRepo.RestoreTask", tasks.RestoreTask(ctx, tn.trashedTaskID), ErrNotInTrash)
+	found, err := tasks.FindTasks(ctx, models.TaskFilter{Status: "new"}, models.Page{})
+	finds("TaskRepo.FindTasks", len(found), err)
+	count, err := tasks.CountTasks(ctx, models.TaskFilter{Status: "new"})
+	finds("TaskRepo.CountTasks", count, err)
+	results, err := tasks.BulkUpdateTasks(ctx, []int{tn.taskID}, models.TaskFilter{}, 1000, TaskChange{Delete: true}, false)
+	if err != nil || len(results) != 1 || results[0].Result != BulkNotFound {
+		t.Errorf("TaskRepo.BulkUpdateTasks by ID = %+v, %v; want not_found", results, err)
+	}
+	results, err = tasks.BulkUpdateTasks(ctx, nil, models.TaskFilter{Status: "new"}, 1000, TaskChange{Status: "done"}, false)
+	finds("TaskRepo.BulkUpdateTasks by filter", len(results), err)
+
+	allProjects, err := projects.GetAllProjects(ctx, 0, models.Page{})
+	for _, project := range allProjects {
+		if project.ID == tn.projectID {
+			t.Errorf("ProjectRepo.GetAllProjects found project %d of another organization", project.ID)
+		}
+	}
+	if err != nil {
+		t.Errorf("ProjectRepo.GetAllProjects: %v", err)
+	}
+	_, err = projects.GetProjectByID(ctx, tn.projectID)
+	fails("ProjectRepo.GetProjectByID", err, ErrNotFound)
+	if userID != 0 {
+		_, err = projects.UpdateProject(ctx, models.Project{ID: tn.projectID, ProjectTitle: "Hijacked", ManagerId: userID}, 0)
+		fails("ProjectRepo.UpdateProject", err, ErrNotFound)
+	}
+	_, err = projects.PatchProject(ctx, tn.projectID, map[string]any{"projectTitle": "Hijacked"}, 1)
+	fails("ProjectRepo.PatchProject", err, ErrNotFound)
+	fails("ProjectRepo.DeleteProject", projects.DeleteProject(ctx, tn.projectID, nil, 1), ErrNotFound)
+	deletedProjects, err := projects.GetDeletedProjects(ctx, 0)
+	finds("ProjectRepo.GetDeletedProjects", len(deletedProjects), err)
+	fails("ProjectRepo.RestoreProject", projects.RestoreProject(ctx, tn.trashedProjectID), ErrNotInTrash)
+	byTitle, err := projects.SearchProjectsByTitle(ctx, "Launch", 0)
+	finds("ProjectRepo.SearchProjectsByTitle", len(byTitle), err)
+	byManager, err := projects.SearchProjectsByManager(ctx, tn.adminID, 0)
+	finds("ProjectRepo.SearchProjectsByManager", len(byManager), err)
+	projectTasks, err := projects.GetTasksByProjectID(ctx, tn.projectID)
+	finds("ProjectRepo.GetTasksByProjectID", len(projectTasks), err)
+
+	projectMembers, err := members.GetMembers(ctx, tn.projectID)
+	finds("MemberRepo.GetMembers", len(projectMembers), err)
+	if role, err := members.GetRole(ctx, tn.projectID, tn.userID); err != nil || role != "" {
+		t.Errorf("MemberRepo.GetRole = %q, %v; want no role", role, err)
+	}
+	if userID != 0 {
+		fails("MemberRepo.SetMember", members.SetMember(ctx, tn.projectID, userID, models.RoleOwner), ErrForeignKey)
+	}
+	fails("MemberRepo.RemoveMember", members.RemoveMember(ctx, tn.projectID, tn.userID), ErrNotFound)
+
+	visible, err := filters.GetVisibleFilters(ctx, tn.adminID)
+	finds("FilterRepo.GetVisibleFilters", len(visible), err)
+	_, err = filters.GetFilterByID(ctx, tn.filterID)
+	fails("FilterRepo.GetFilterByID", err, ErrNotFound)
+	_, err = filters.CreateFilter(ctx, models.SavedFilter{Name: "Planted", OwnerID: tn.adminID, CreatedAt: now})
+	fails("FilterRepo.CreateFilter", err, ErrForeignKey)
+	fails("FilterRepo.DeleteFilter", filters.DeleteFilter(ctx, tn.filterID), ErrNotFound)
+	if exists, err := filters.FilterNameExists(ctx, tn.adminID, "Open"); err != nil || exists {
+		t.Errorf("FilterRepo.FilterNameExists = %v, %v; want false", exists, err)
+	}
+
+	series, err := recurring.GetRecurringTasks(ctx, 0)
+	finds("RecurringTaskRepo.GetRecurringTasks", len(series), err)
+	_, err = recurring.GetRecurringTaskByID(ctx, tn.recurringID)
+	fails("RecurringTaskRepo.GetRecurringTaskByID", err, ErrNotFound)
+	_, err = recurring.CreateRecurringTask(ctx, models.RecurringTask{
+		Title: "Planted", Priority: "low", RespId: tn.adminID, ProjectID: tn.projectID,
+		RRule: "FREQ=DAILY", TimeZone: "UTC", StartsAt: now, NextOccurrence: &now, CreatedAt: now})
+	fails("RecurringTaskRepo.CreateRecurringTask", err, ErrForeignKey)
+	fails("RecurringTaskRepo.DeleteRecurringTask", recurring.DeleteRecurringTask(ctx, tn.recurringID), ErrNotFound)
+	skipped, occurrenceTasks, err := recurring.GetOccurrenceStates(ctx, tn.recurringID)
+	finds("RecurringTaskRepo.GetOccurrenceStates", len(skipped)+len(occurrenceTasks), err)
+	if isSkipped, err := recurring.IsSkipped(ctx, tn.recurringID, tn.occurrence); err != nil || isSkipped {
+		t.Errorf("RecurringTaskRepo.IsSkipped = %v, %v; want false", isSkipped, err)
+	}
+	fails("RecurringTaskRepo.SkipOccurrence", recurring.SkipOccurrence(ctx, tn.recurringID, tn.occurrence, nil), ErrNotFound)
+	_, err = recurring.SaveOccurrence(ctx, models.Task{
+		Title: "Planted", Priority: "low", Status: "new", RespId: tn.adminID, ProjectID: tn.projectID,
+		RecurringTaskID: &tn.recurringID, Occurrence: &tn.occurrence})
+	fails("RecurringTaskRepo.SaveOccurrence", err, ErrNotFound)
+
+	taskComments, err := comments.GetComments(ctx, tn.taskID)
+	finds("CommentRepo.GetComments", len(taskComments), err)
+	_, err = comments.CreateComment(ctx, models.Comment{TaskID: tn.taskID, Body: "@bob planted", CreatedAt: now})
+	fails("CommentRepo.CreateComment", err, ErrNotFound)
+
+	taskHits, err := search.SearchTasks(ctx, PrefixQuery("launch"), "english", 10, 0)
+	finds("SearchRepo.SearchTasks", len(taskHits), err)
+	projectHits, err := search.SearchProjects(ctx, PrefixQuery("launch"), "english", 10, 0)
+	for _, hit := range projectHits {
+		if hit.ID == tn.projectID {
+			t.Errorf("SearchRepo.SearchProjects found project %d of another organization", hit.ID)
+		}
+	}
+	if err != nil {
+		t.Errorf("SearchRepo.SearchProjects: %v", err)
+	}
+
+	fails("OrganizationRepo.SetOrgRole", orgs.SetOrgRole(ctx, orgID, tn.userID, models.OrgAdmin), ErrNotFound)
+}
+
+func TestRepositoriesAreScopedToOrganization(t *testing.T) {
+	tn := newTenant(t)
+	before := tn.snapshot(t)
+	tn.crossTenant(t, tn.otherOrgID, tn.otherProjectID, tn.otherUserID)
+	if after := tn.snapshot(t); after != before {
+		t.Errorf("another organization changed the fixture's rows:\nbefore %s\nafter  %s", before, after)
+	}
+}
+
+// A repository without an organization must not fall back to every
+// organization: it is bound to organization 0, which does not exist.
+func TestRepositoriesWithoutOrganizationMatchNothing(t *testing.T) {
+	tn := newTenant(t)
+	before := tn.snapshot(t)
+	tn.crossTenant(t, 0, 0, 0)
+	if after := tn.snapshot(t); after != before {
+		t.Errorf("a repository without an organization changed the fixture's rows:\nbefore %s\nafter  %s", before, after)
+	}
+}
+
+func TestCreateUserJoinsOrganization(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	users := UserRepo{DB: f.db, OrgID: f.orgID}
+	id, err := users.CreateUser(ctx, models.User{Name: "Cy", Email: "cy@example.com", Role: "developer", RegistrationDate: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	orgID, orgRole, err := (&OrganizationRepo{DB: f.db}).GetCaller(ctx, id)
+	if err != nil || orgID != f.orgID || orgRole != models.OrgMember {
+		t.Errorf("GetCaller = %d, %q, %v; want %d, %q", orgID, orgRole, err, f.orgID, models.OrgMember)
+	}
+}
+
+func TestEmailIsUniquePerOrganization(t *testing.T) {
+	tn := newTenant(t)
+	ctx := context.Background()
+	now := time.Now()
+	other := UserRepo{DB: tn.db, OrgID: tn.otherOrgID}
+	if _, err := other.CreateUser(ctx, models.User{Name: "Bobby", Email: "bob@example.com", Role: "developer", RegistrationDate: now}); err != nil {
+		t.Fatalf("CreateUser with another organization's email: %v", err)
+	}
+	_, err := other.CreateUser(ctx, models.User{Name: "Robert", Email: "bob@example.com", Role: "developer", RegistrationDate: now})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("CreateUser with an email taken in the organization = %v, want ErrConflict", err)
+	}
+}
@@ -0,0 +1,13 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/allwsaa/project-api/internal/tracing"
+)
+
+// traced returns ctx for the statements of a repository method, named such
+// as "TaskRepo.GetTasks", so that their spans are named after it.
+func traced(ctx context.Context, method string) context.Context {
+	return tracing.WithStatementName(ctx, "repositories."+method)
+}
@@ -1,18 +1,31 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"time"
 
 	"github.com/allwsaa/project-api/internal/models"
 )
 
+// UserRepo works on the users of organization OrgID.
 type UserRepo struct {
-	DB *sql.DB
+	DB    *sql.DB
+	OrgID int
 }
 
-func (r *UserRepo) GetAll() ([]models.User, error) {
-	rows, err := r.DB.Query("SELECT id, name, email, registrationDate, role FROM users")
+// userColumns lists the columns scanUser reads, in order.
+const userColumns = "id, name, email, registrationDate, role, org_id, org_role, version"
+
+func scanUser(row interface{ Scan(...any) error }, user *models.User, extra ...any) error {
+	return row.Scan(append([]any{&user.ID, &user.Name, &user.Email, &user.RegistrationDate, &user.Role, &user.OrgID, &user.OrgRole, &user.Version}, extra...)...)
+}
+
+func (r *UserRepo) GetAll(ctx context.Context, page models.Page) ([]models.User, error) {
+	ctx = traced(ctx, "UserRepo.GetAll")
+	paging, pageArgs := pageClause(page, 2)
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE deleted_at IS NULL AND org_id = $1"+paging,
+		append([]any{r.OrgID}, pageArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -21,7 +34,7 @@ func (r *UserRepo) GetAll() ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.RegistrationDate, &user.Role); err != nil {
+		if err := scanUser(rows, &user); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -29,46 +42,161 @@ func (r *UserRepo) GetAll() ([]models.User, error) {
 	return users, nil
 }
 
-func (r *UserRepo) GetUserByID(id int) (*models.User, error) {
-	row := r.DB.QueryRow("SELECT id, name, email, registrationDate, role FROM users WHERE id = $1", id)
+func (r *UserRepo) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	ctx = traced(ctx, "UserRepo.GetUserByID")
+	row := r.DB.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 AND deleted_at IS NULL AND org_id = $2", id, r.OrgID)
 	var user models.User
-	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.RegistrationDate, &user.Role)
+	err := scanUser(row, &user)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user with this ID %d not found", id)
+			return nil, notFound("User")
 		}
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *UserRepo) CreateUser(user models.User) (int, error) {
+func (r *UserRepo) CreateUser(ctx context.Context, user models.User) (int, error) {
+	ctx = traced(ctx, "UserRepo.CreateUser")
 	var id int
-	err := r.DB.QueryRow(`
-		INSERT INTO users (name, email, registrationDate, role)
-		VALUES ($1, $2, $3, $4) RETURNING id`,
-		user.Name, user.Email, user.RegistrationDate, user.Role).Scan(&id)
+	err := r.DB.QueryRowContext(ctx, `
+		INSERT INTO users (name, email, registrationDate, role, org_id, org_role)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		user.Name, user.Email, user.RegistrationDate, user.Role, r.OrgID, models.OrgMember).Scan(&id)
 	if err != nil {
-		return 0, err
+		return 0, constraintError(err, "A user with this email already exists in the organization", "Organization not found")
 	}
 	return id, nil
 }
 
-func (r *UserRepo) UpdateUser(user models.User) error {
-	_, err := r.DB.Exec(`
-		UPDATE users SET name = $1, email = $2, registrationDate = $3, role = $4
-		WHERE id = $5
-	`, user.Name, user.Email, user.RegistrationDate, user.Role, user.ID)
-	return err
+// UpdateUser saves the user and returns its new version. A non-zero
+// expectedVersion makes the update conditional on the stored version.
+func (r *UserRepo) UpdateUser(ctx context.Context, user models.User, expectedVersion int) (int, error) {
+	ctx = traced(ctx, "UserRepo.UpdateUser")
+	var version int
+	err := r.DB.QueryRowContext(ctx, `
+		UPDATE users SET name = $1, email = $2, registrationDate = $3, role = $4, version = version + 1
+		WHERE id = $5 AND deleted_at IS NULL AND ($6 = 0 OR version = $6) AND org_id = $7
+		RETURNING version
+	`, user.Name, user.Email, user.RegistrationDate, user.Role, user.ID, expectedVersion, r.OrgID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, noRowsError(ctx, r.DB, "users", "org_id = $%d", r.OrgID, user.ID, expectedVersion)
+	}
+	if err != nil {
+		return 0, constraintError(err, "A user with this email already exists in the organization", "Organization not found")
+	}
+	return version, nil
+}
+
+func (r *UserRepo) PatchUser(ctx context.Context, id int, fields map[string]any, expectedVersion int) (int, error) {
+	ctx = traced(ctx, "UserRepo.PatchUser")
+	version, err := patchRow(ctx, r.DB, "users", userPatchColumns, "org_id = $%d", r.OrgID, id, fields, expectedVersion)
+	if err != nil {
+		return 0, constraintError(err, "A user with this email already exists in the organization", "Organization not found")
+	}
+	return version, nil
+}
+
+// DeleteUser moves the user to the trash. The organization's last admin
+// cannot be deleted.
+func (r *UserRepo) DeleteUser(ctx context.Context, id int, deletedBy *int, expectedVersion int) error {
+	ctx = traced(ctx, "UserRepo.DeleteUser")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotLastAdmin(ctx, tx, r.OrgID, id); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users SET deleted_at = $2, deleted_by = $3, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND ($4 = 0 OR version = $4) AND org_id = $5`,
+		id, time.Now(), deletedBy, expectedVersion, r.OrgID)
+	if err != nil {
+		return err
+	}
+	if err := checkUpdated(ctx, tx, res, "users", "org_id = $%d", r.OrgID, id, expectedVersion); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *UserRepo) GetDeletedUsers(ctx context.Context) ([]models.User, error) {
+	ctx = traced(ctx, "UserRepo.GetDeletedUsers")
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+userColumns+", deleted_at, deleted_by FROM users WHERE deleted_at IS NOT NULL AND org_id = $1 ORDER BY deleted_at DESC", r.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user, &user.DeletedAt, &user.DeletedBy); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *UserRepo) RestoreUser(ctx context.Context, id int) error {
+	ctx = traced(ctx, "UserRepo.RestoreUser")
+	res, err := r.DB.ExecContext(ctx, "UPDATE users SET deleted_at = NULL, deleted_by = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL AND org_id = $2", id, r.OrgID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotInTrash
+	}
+	return nil
 }
 
-func (r *UserRepo) DeleteUser(id int) error {
-	_, err := r.DB.Exec("DELETE FROM users WHERE id = $1", id)
-	return err
+// purgeableUsers selects the IDs of the users PurgeDeletedUsers removes; $1
+// is the time they must have been deleted before.
+const purgeableUsers = `SELECT id FROM users WHERE deleted_at < $1
+	AND NOT EXISTS (SELECT 1 FROM tasks WHERE tasks.respId = users.id)
+	AND NOT EXISTS (SELECT 1 FROM recurring_tasks WHERE recurring_tasks.respId = users.id)
+	AND NOT EXISTS (SELECT 1 FROM projects WHERE projects.managerId = users.id)`
+
+// PurgeDeletedUsers permanently removes users of every organization deleted
+// before the given time, together with the filters they saved, except those
+// still referenced as a task assignee, recurring task assignee or project
+// manager.
+func (r *UserRepo) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	ctx = traced(ctx, "UserRepo.PurgeDeletedUsers")
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM saved_filters WHERE owner_id IN ("+purgeableUsers+")", before); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id IN ("+purgeableUsers+")", before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
 }
 
-func (r *UserRepo) GetTasksByUserID(userID int) ([]models.Task, error) {
-	rows, err := r.DB.Query("SELECT id, title, description, priority, status, respId, projectId, creationDate, completionDate FROM tasks WHERE respId = $1", userID)
+// GetTasksByUserID returns the tasks assigned to the user, limited to the
+// projects of memberID unless it is zero.
+func (r *UserRepo) GetTasksByUserID(ctx context.Context, userID int, memberID int) ([]models.Task, error) {
+	ctx = traced(ctx, "UserRepo.GetTasksByUserID")
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE respId = $1 AND deleted_at IS NULL"+inOrg("projectId", orgProjects, 2)+memberScope("projectId", memberID, 3),
+		append([]any{userID, r.OrgID}, memberArgs(memberID)...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +205,7 @@ func (r *UserRepo) GetTasksByUserID(userID int) ([]models.Task, error) {
 	var tasks []models.Task
 	for rows.Next() {
 		var task models.Task
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.Status, &task.RespId, &task.ProjectID, &task.CreationDate, &task.CompletionDate); err != nil {
+		if err := scanTask(rows, &task); err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, task)
@@ -88,8 +216,9 @@ func (r *UserRepo) GetTasksByUserID(userID int) ([]models.Task, error) {
 	return tasks, nil
 }
 
-func (r *UserRepo) FindUsersByName(name string) ([]models.User, error) {
-	rows, err := r.DB.Query("SELECT id, name, email, registrationDate, role FROM users WHERE name ILIKE '%' || $1 || '%'", name)
+func (r *UserRepo) FindUsersByName(ctx context.Context, name string) ([]models.User, error) {
+	ctx = traced(ctx, "UserRepo.FindUsersByName")
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE name ILIKE '%' || $1 || '%' AND deleted_at IS NULL AND org_id = $2", name, r.OrgID)
 	if err != nil {
 		return nil, err
 	}
@@ -98,15 +227,16 @@ func (r *UserRepo) FindUsersByName(name string) ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.RegistrationDate, &user.Role); err != nil {
+		if err := scanUser(rows, &user); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
 	}
 	return users, nil
 }
-func (r *UserRepo) FindUsersByEmail(email string) ([]models.User, error) {
-	rows, err := r.DB.Query("SELECT id, name, email, registrationDate, role FROM users WHERE email ILIKE '%' || $1 || '%'", email)
+func (r *UserRepo) FindUsersByEmail(ctx context.Context, email string) ([]models.User, error) {
+	ctx = traced(ctx, "UserRepo.FindUsersByEmail")
+	rows, err := r.DB.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE email ILIKE '%' || $1 || '%' AND deleted_at IS NULL AND org_id = $2", email, r.OrgID)
 	if err != nil {
 		return nil, err
 	}
@@ -115,7 +245,7 @@ func (r *UserRepo) FindUsersByEmail(email string) ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.RegistrationDate, &user.Role); err != nil {
+		if err := scanUser(rows, &user); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
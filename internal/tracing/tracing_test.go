@@ -0,0 +1,173 @@
+package tracing_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/repositories"
+	"github.com/allwsaa/project-api/internal/tracing"
+	"github.com/go-chi/chi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+)
+
+// recordSpans installs a tracer provider exporting to memory for the test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return exporter
+}
+
+// openDB opens a database whose driver returns no rows, traced like the real
+// one.
+func openDB(t *testing.T) *sql.DB {
+	db := sql.OpenDB(tracing.WrapConnector(emptyConnector{}, "postgresql"))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMiddlewareContinuesTraceAndNamesSpanAfterRoute(t *testing.T) {
+	exporter := recordSpans(t)
+	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Get("/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusInternalServerError, "Internal server error")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/tasks/7", nil)
+	req.Header.Set("traceparent", traceparent)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(tracing.TraceHeader); got != traceID {
+		t.Errorf("%s = %q, want %q", tracing.TraceHeader, got, traceID)
+	}
+	var details problem.Details
+	if err := json.NewDecoder(rec.Body).Decode(&details); err != nil || details.TraceID != traceID {
+		t.Errorf("problem details trace ID = %q (%v), want %q", details.TraceID, err, traceID)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /tasks/{id}" {
+		t.Errorf("span name = %q, want %q", span.Name, "GET /tasks/{id}")
+	}
+	if span.SpanContext.TraceID().String() != traceID {
+		t.Errorf("trace ID = %s, want the incoming %s", span.SpanContext.TraceID(), traceID)
+	}
+	if span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("parent span = %s, want the incoming one", span.Parent.SpanID())
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("status = %v, want error for a 500", span.Status.Code)
+	}
+	if route := attribute(span, string(semconv.HTTPRouteKey)); route != "/tasks/{id}" {
+		t.Errorf("http.route = %q, want %q", route, "/tasks/{id}")
+	}
+}
+
+func TestQueriesAreTracedWithinRequest(t *testing.T) {
+	exporter := recordSpans(t)
+	db := openDB(t)
+	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Get("/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		repo := repositories.TaskRepo{DB: db, OrgID: 1}
+		if task, err := repo.GetTaskByID(r.Context(), 7); err == nil {
+			t.Errorf("GetTaskByID() = %v, want not found", task)
+		}
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/tasks/7", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	query, request := spans[0], spans[1]
+	if query.Name != "repositories.TaskRepo.GetTaskByID" {
+		t.Errorf("query span name = %q, want the repository method", query.Name)
+	}
+	if query.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Errorf("query span is not a child of the request span")
+	}
+	if text := attribute(query, string(semconv.DBQueryTextKey)); !strings.Contains(text, "id = $1") {
+		t.Errorf("query text = %q, want the statement with its placeholders", text)
+	}
+	for _, kv := range query.Attributes {
+		if kv.Value.Emit() == "7" {
+			t.Errorf("query span records the value of a parameter: %v", kv)
+		}
+	}
+}
+
+func TestUnnamedStatementsAreCalledSQL(t *testing.T) {
+	exporter := recordSpans(t)
+	db := openDB(t)
+
+	for _, ctx := range []context.Context{context.Background(), tracing.WithStatementName(context.Background(), "database.SchemaVersion")} {
+		var version int
+		db.QueryRowContext(ctx, "SELECT max(version) FROM schema_migrations").Scan(&version)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].Name != "sql" || spans[1].Name != "database.SchemaVersion" {
+		t.Errorf("span names = %q, %q; want sql and the given name", spans[0].Name, spans[1].Name)
+	}
+}
+
+func attribute(span tracetest.SpanStub, key string) string {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+// emptyConnector connects to a database without rows.
+type emptyConnector struct{}
+
+func (emptyConnector) Connect(context.Context) (driver.Conn, error) { return emptyConn{}, nil }
+func (emptyConnector) Driver() driver.Driver                        { return nil }
+
+type emptyConn struct{}
+
+func (emptyConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (emptyConn) Close() error                        { return nil }
+func (emptyConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (emptyConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
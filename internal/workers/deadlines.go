@@ -0,0 +1,105 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/repositories"
+)
+
+// DeadlineNotifier notifies assignees of tasks that are due within one of the
+// Reminders lead times or overdue, and escalates to the project manager once
+// a task has been overdue for longer than EscalationGrace. Each notification
+// is created at most once per task, recipient, threshold and due date, so
+// several instances can run it side by side. It runs once per Interval.
+type DeadlineNotifier struct {
+	DB              *sql.DB
+	Reminders       []time.Duration
+	EscalationGrace time.Duration
+	Interval        time.Duration
+}
+
+func (n *DeadlineNotifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.Interval)
+	defer ticker.Stop()
+
+	for {
+		n.notify(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (n *DeadlineNotifier) notify(ctx context.Context) {
+	now := time.Now()
+	repo := repositories.NotificationRepo{DB: n.DB}
+
+	// A task only gets the reminder for the shortest lead time it is within,
+	// so that a task created an hour before it is due is not reminded of
+	// being due in 24 hours as well.
+	reminders := append([]time.Duration(nil), n.Reminders...)
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i] < reminders[j] })
+	after := now
+	for _, lead := range reminders {
+		before := now.Add(lead)
+		n.send(ctx, repo, repositories.NotificationReminder, shortDuration(lead), after, before, now, func(task repositories.DueTask) string {
+			return fmt.Sprintf("Task %q is due in less than %s", task.Title, shortDuration(lead))
+		})
+		after = before
+	}
+
+	n.send(ctx, repo, repositories.NotificationOverdue, "0s", time.Time{}, now, now, func(task repositories.DueTask) string {
+		return fmt.Sprintf("Task %q is overdue", task.Title)
+	})
+	n.send(ctx, repo, repositories.NotificationEscalation, shortDuration(n.EscalationGrace), time.Time{}, now.Add(-n.EscalationGrace), now, func(task repositories.DueTask) string {
+		return fmt.Sprintf("Task %q has been overdue for more than %s", task.Title, shortDuration(n.EscalationGrace))
+	})
+}
+
+func (n *DeadlineNotifier) send(ctx context.Context, repo repositories.NotificationRepo, kind, threshold string, dueAfter, dueBefore, now time.Time, message func(repositories.DueTask) string) {
+	tasks, err := repo.GetTasksToNotify(ctx, kind, threshold, dueAfter, dueBefore)
+	if err != nil {
+		slog.Error("Error finding tasks for notifications", "kind", kind, "err", err)
+		return
+	}
+	for _, task := range tasks {
+		created, err := repo.CreateNotification(ctx, models.Notification{
+			UserID:    task.RecipientID,
+			TaskID:    task.TaskID,
+			Kind:      kind,
+			Threshold: threshold,
+			DueAt:     task.DueAt,
+			Message:   message(task),
+			CreatedAt: now,
+		})
+		if err != nil {
+			slog.Error("Error creating notification", "kind", kind, "task_id", task.TaskID, "err", err)
+			continue
+		}
+		if created {
+			slog.Info("Sent notification", "kind", kind, "task_id", task.TaskID, "user_id", task.RecipientID)
+		}
+	}
+}
+
+// shortDuration formats d without trailing zero units, e.g. 24h rather than
+// 24h0m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package workers
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Group runs workers in the background until its context is done, and keeps
+// track of which of them are still running.
+type Group struct {
+	ctx     context.Context
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// NewGroup returns a group whose workers run until ctx is done.
+func NewGroup(ctx context.Context) *Group {
+	return &Group{ctx: ctx, running: make(map[string]bool)}
+}
+
+// Go runs worker in a goroutine under name.
+func (g *Group) Go(name string, worker func(context.Context)) {
+	g.setRunning(name, true)
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.setRunning(name, false)
+		worker(g.ctx)
+	}()
+}
+
+func (g *Group) setRunning(name string, running bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running[name] = running
+}
+
+// Status returns the names of the workers that are running and of those
+// that have stopped.
+func (g *Group) Status() (running, stopped []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for name, ok := range g.running {
+		if ok {
+			running = append(running, name)
+		} else {
+			stopped = append(stopped, name)
+		}
+	}
+	sort.Strings(running)
+	sort.Strings(stopped)
+	return running, stopped
+}
+
+// Wait waits for the workers to return, or for ctx to be done.
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,116 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/notify"
+	"github.com/allwsaa/project-api/internal/repositories"
+)
+
+const (
+	outboxBatch       = 50
+	outboxMaxAttempts = 8
+)
+
+// OutboxSender delivers the emails queued in the outbox through Notifier.
+// Immediate emails go out on every run, once per Interval; digest emails are
+// collected and sent once a day at DigestHour UTC.
+type OutboxSender struct {
+	DB         *sql.DB
+	Notifier   notify.Notifier
+	Interval   time.Duration
+	DigestHour int
+}
+
+func (s *OutboxSender) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.send(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *OutboxSender) send(ctx context.Context) {
+	now := time.Now()
+	repo := repositories.OutboxRepo{DB: s.DB}
+
+	sent, failed, err := repo.SendDue(ctx, now, outboxBatch, outboxMaxAttempts, func(email repositories.OutboxEmail) error {
+		event, err := decodeEvent(email)
+		if err != nil {
+			return err
+		}
+		data := notify.Notification{Recipient: email.Recipient, Event: event}
+		msg, err := notify.Render(email.Event, email.Recipient.Email, data)
+		if err != nil {
+			return err
+		}
+		return s.Notifier.Send(ctx, msg)
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Error("Error sending emails", "err", err)
+		return
+	}
+	if sent+failed > 0 {
+		slog.Info("Sent emails", "sent", sent, "failed", failed)
+	}
+
+	// Digests cover everything queued before today's digest time, once that
+	// time has come.
+	cutoff := time.Date(now.Year(), now.Month(), now.Day(), s.DigestHour, 0, 0, 0, time.UTC)
+	if now.Before(cutoff) {
+		return
+	}
+	digests, err := repo.SendDigests(ctx, now, cutoff, outboxMaxAttempts, func(recipient notify.Recipient, emails []repositories.OutboxEmail) error {
+		digest := notify.Digest{Recipient: recipient}
+		for _, email := range emails {
+			event, err := decodeEvent(email)
+			if err != nil {
+				return err
+			}
+			digest.Items = append(digest.Items, event)
+		}
+		msg, err := notify.Render(notify.EventDigest, recipient.Email, digest)
+		if err != nil {
+			return err
+		}
+		return s.Notifier.Send(ctx, msg)
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.Error("Error sending digests", "err", err)
+		return
+	}
+	if digests > 0 {
+		slog.Info("Sent digest emails", "count", digests)
+	}
+}
+
+func decodeEvent(email repositories.OutboxEmail) (notify.Event, error) {
+	var event notify.Event
+	switch email.Event {
+	case notify.EventTaskAssigned:
+		event.TaskAssigned = new(notify.TaskAssigned)
+		return event, json.Unmarshal(email.Payload, event.TaskAssigned)
+	case notify.EventMentioned:
+		event.Mentioned = new(notify.Mentioned)
+		return event, json.Unmarshal(email.Payload, event.Mentioned)
+	default:
+		return event, fmt.Errorf("unknown email event %q", email.Event)
+	}
+}
@@ -0,0 +1,58 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/repositories"
+)
+
+// TrashPurger permanently deletes users, projects and tasks that have been in
+// the trash for longer than Retention. It runs once per Interval.
+type TrashPurger struct {
+	DB        *sql.DB
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+func (p *TrashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *TrashPurger) purge(ctx context.Context) {
+	before := time.Now().Add(-p.Retention)
+
+	// Tasks go first so that the projects and users they reference can follow.
+	// A table that fails to purge does not hold up the others: what it still
+	// references is kept until the next run.
+	tasks := repositories.TaskRepo{DB: p.DB}
+	n, err := tasks.PurgeDeletedTasks(ctx, before)
+	if err != nil {
+		slog.Error("Error purging deleted tasks", "err", err)
+	}
+	projects := repositories.ProjectRepo{DB: p.DB}
+	m, err := projects.PurgeDeletedProjects(ctx, before)
+	if err != nil {
+		slog.Error("Error purging deleted projects", "err", err)
+	}
+	users := repositories.UserRepo{DB: p.DB}
+	k, err := users.PurgeDeletedUsers(ctx, before)
+	if err != nil {
+		slog.Error("Error purging deleted users", "err", err)
+	}
+	if n+m+k > 0 {
+		slog.Info("Purged the trash", "tasks", n, "projects", m, "users", k)
+	}
+}
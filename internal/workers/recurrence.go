@@ -0,0 +1,46 @@
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/repositories"
+)
+
+// recurrenceBatch is how many recurring tasks are handled per transaction.
+const recurrenceBatch = 100
+
+// RecurrenceScheduler creates the tasks of recurring tasks as their
+// occurrences come due. It runs once per Interval.
+type RecurrenceScheduler struct {
+	DB       *sql.DB
+	Interval time.Duration
+}
+
+func (s *RecurrenceScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.materialize(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *RecurrenceScheduler) materialize(ctx context.Context) {
+	repo := repositories.RecurringTaskRepo{DB: s.DB}
+	n, err := repo.MaterializeDue(ctx, time.Now(), recurrenceBatch)
+	if err != nil {
+		slog.Error("Error creating recurring tasks", "err", err)
+		return
+	}
+	if n > 0 {
+		slog.Info("Created tasks from recurring tasks", "count", n)
+	}
+}
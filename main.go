@@ -1,60 +1,211 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/allwsaa/project-api/database"
-	"github.com/allwsaa/project-api/docs"
+	"github.com/allwsaa/project-api/internal/config"
 	"github.com/allwsaa/project-api/internal/handlers"
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
+	"github.com/allwsaa/project-api/internal/health"
+	"github.com/allwsaa/project-api/internal/idempotency"
+	"github.com/allwsaa/project-api/internal/logging"
+	"github.com/allwsaa/project-api/internal/metrics"
+	"github.com/allwsaa/project-api/internal/notify"
+	"github.com/allwsaa/project-api/internal/ratelimit"
+	"github.com/allwsaa/project-api/internal/tracing"
+	"github.com/allwsaa/project-api/internal/workers"
 	"github.com/joho/godotenv"
-	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 // @title Project API
 // @version 1.0
 // @BasePath /
 func main() {
-	err := godotenv.Load("ex.env")
+	// ex.env is optional; variables already set in the environment win.
+	if err := godotenv.Load("ex.env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fatal("Error loading ex.env", "err", err)
+	}
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// Written as is, so that each invalid setting is on its own line.
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if err := logging.Setup(os.Stdout, cfg.LogLevel, cfg.LogFormat); err != nil {
+		fatal("Error setting up logging", "err", err)
+	}
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		fatal("Error setting up tracing", "err", err)
+	}
+
+	// ctx is cancelled by SIGINT or SIGTERM, which stops the workers and
+	// starts draining the server.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	bg := workers.NewGroup(ctx)
+
+	if err := database.SetupDB(cfg.Database); err != nil {
+		fatal("Error setting up database", "err", err)
+	}
+	handlers.DB = database.GetDB()
+	handlers.RequireIfMatch = cfg.RequireIfMatch
+	handlers.SearchLanguage = cfg.SearchLanguage
+
+	purger := &workers.TrashPurger{
+		DB:        database.GetDB(),
+		Retention: cfg.TrashRetention,
+		Interval:  cfg.TrashPurgeInterval,
+	}
+	bg.Go("trash-purger", purger.Run)
+
+	scheduler := &workers.RecurrenceScheduler{
+		DB:       database.GetDB(),
+		Interval: cfg.RecurrenceInterval,
+	}
+	bg.Go("recurrence-scheduler", scheduler.Run)
+
+	notifier := &workers.DeadlineNotifier{
+		DB:              database.GetDB(),
+		Reminders:       cfg.ReminderLeadTimes,
+		EscalationGrace: cfg.EscalationGrace,
+		Interval:        cfg.ReminderInterval,
+	}
+	bg.Go("deadline-notifier", notifier.Run)
+
+	sender := &workers.OutboxSender{
+		DB:         database.GetDB(),
+		Notifier:   emailNotifier(cfg.SMTP),
+		Interval:   cfg.OutboxInterval,
+		DigestHour: cfg.DigestHour,
+	}
+	bg.Go("outbox-sender", sender.Run)
+
+	limiter := &ratelimit.Limiter{Store: rateLimitStore(cfg, bg)}
+
+	idempotent := &idempotency.Store{
+		DB:     database.GetDB(),
+		Window: cfg.IdempotencyWindow,
+	}
+	bg.Go("idempotency-cleanup", func(ctx context.Context) { idempotent.Run(ctx, time.Hour) })
+
+	m := metrics.New(database.GetDB(), cfg.Database.Driver)
+	r := newRouter(cfg, m, limiter, idempotent)
+
+	expectedSchema, err := database.LatestMigration()
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
-	}
-	database.SetupDB()
-
-	r := chi.NewRouter()
-
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-
-	r.Get("/users", handlers.GetAllUsers)
-	r.Post("/users", handlers.CreateUser)
-	r.Get("/users/{id}", handlers.GetUserByID)
-	r.Put("/users/{id}", handlers.UpdateUser)
-	r.Delete("/users/{id}", handlers.DeleteUser)
-	r.Get("/users/{id}/tasks", handlers.GetTasksByUserID)
-	r.Get("/users/search", handlers.FindUsersByName)
-	r.Get("/users/search", handlers.FindUsersByEmail)
-
-	r.Get("/tasks", handlers.GetTasks)
-	r.Post("/tasks", handlers.CreateTask)
-	r.Get("/tasks/{id}", handlers.GetTaskByID)
-	r.Put("/tasks/{id}", handlers.UpdateTask)
-	r.Delete("/tasks/{id}", handlers.DeleteTask)
-	r.Get("/tasks/search", handlers.SearchTasksHandler)
-
-	r.Get("/projects", handlers.GetProjects)
-	r.Post("/projects", handlers.CreateProject)
-	r.Get("/projects/{id}", handlers.GetProjectByID)
-	r.Put("/projects/{id}", handlers.UpdateProject)
-	r.Delete("/projects/{id}", handlers.DeleteProject)
-	r.Get("/projects/{id}/tasks", handlers.GetTasksByProjectID)
-	r.Get("/projects/search/title", handlers.SearchProjectsByTitle)
-	r.Get("/projects/search/manager", handlers.SearchProjectsByManager)
-
-	docs.SwaggerInfo.BasePath = "/"
-	r.Get("/swagger/*", httpSwagger.WrapHandler)
-	log.Println("Server starting on :8080")
-	http.ListenAndServe(":8080", r)
+		fatal("Error reading migrations", "err", err)
+	}
+	checker := &health.Checker{
+		DB:      database.GetDB(),
+		Timeout: cfg.HealthTimeout,
+		SchemaVersion: func(ctx context.Context) (int, error) {
+			return database.SchemaVersion(ctx, database.GetDB())
+		},
+		ExpectedSchema: expectedSchema,
+		Workers:        bg,
+	}
+	checker.Start()
+
+	root := newRoot(r, checker, cfg.HealthToken)
+
+	srv := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Port),
+		Handler:           root,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelError),
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+	slog.Info("Server starting", "addr", srv.Addr)
+
+	select {
+	case err := <-serveErr:
+		fatal("Server stopped", "err", err)
+	case <-ctx.Done():
+	}
+	// A second signal kills the server without waiting.
+	stop()
+
+	// Keep serving while the platform notices that the server is no longer
+	// ready and stops sending it requests.
+	slog.Info("Shutting down", "delay", cfg.ShutdownDelay, "timeout", cfg.ShutdownTimeout)
+	checker.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+	deadline, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(deadline); err != nil {
+		// Closing the connections cancels the requests' contexts, and with
+		// them their queries.
+		slog.Error("Error draining connections", "err", err)
+		srv.Close()
+	}
+	if err := bg.Wait(deadline); err != nil {
+		slog.Error("Error stopping background workers", "err", err)
+	}
+	if err := database.GetDB().Close(); err != nil {
+		slog.Error("Error closing database", "err", err)
+	}
+	if err := shutdownTracing(deadline); err != nil {
+		slog.Error("Error flushing traces", "err", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// rateLimitStore returns the store chosen by RATE_LIMIT_BACKEND: "memory",
+// "postgres" for deployments with several instances, or "off".
+func rateLimitStore(cfg config.Config, bg *workers.Group) ratelimit.Store {
+	switch cfg.RateLimitBackend {
+	case "postgres":
+		store := &ratelimit.PostgresStore{DB: database.GetDB()}
+		for _, limit := range []ratelimit.Limit{cfg.RateLimitIP, cfg.RateLimit, cfg.RateLimitWrite, cfg.RateLimitSearch} {
+			store.Idle = max(store.Idle, limit.Period)
+		}
+		bg.Go("rate-limit-cleanup", store.Run)
+		return store
+	case "off":
+		slog.Warn("RATE_LIMIT_BACKEND is off, requests are not rate limited")
+		return nil
+	default:
+		return ratelimit.NewMemoryStore()
+	}
+}
+
+// emailNotifier sends email through the SMTP server, or only logs it when no
+// SMTP server is configured.
+func emailNotifier(cfg config.SMTP) notify.Notifier {
+	if cfg.Host == "" {
+		slog.Warn("SMTP_HOST is not set, emails are only logged")
+		return notify.LogNotifier{}
+	}
+	return &notify.SMTPNotifier{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		From:     cfg.From,
+	}
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
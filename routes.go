@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/allwsaa/project-api/docs"
+	"github.com/allwsaa/project-api/internal/auth"
+	"github.com/allwsaa/project-api/internal/config"
+	"github.com/allwsaa/project-api/internal/handlers"
+	"github.com/allwsaa/project-api/internal/health"
+	"github.com/allwsaa/project-api/internal/idempotency"
+	"github.com/allwsaa/project-api/internal/logging"
+	"github.com/allwsaa/project-api/internal/metrics"
+	"github.com/allwsaa/project-api/internal/problem"
+	"github.com/allwsaa/project-api/internal/ratelimit"
+	"github.com/allwsaa/project-api/internal/tracing"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	httpSwagger "github.com/swaggo/http-swagger"
+)
+
+// newRouter returns the API's routes behind its middleware. The handlers use
+// handlers.DB, which must be set first.
+func newRouter(cfg config.Config, m *metrics.Metrics, limiter *ratelimit.Limiter, idempotent *idempotency.Store) *chi.Mux {
+	search := limiter.Limit("search", cfg.RateLimitSearch)
+
+	r := chi.NewRouter()
+	r.NotFound(problem.NotFound)
+	r.MethodNotAllowed(problem.MethodNotAllowed)
+
+	r.Use(tracing.Middleware)
+	r.Use(m.Middleware)
+	if cfg.TrustProxy {
+		r.Use(middleware.RealIP)
+	}
+	r.Use(logging.RequestIDMiddleware)
+	r.Use(logging.AccessLog)
+	r.Use(problem.Recoverer)
+	r.Use(auth.Middleware)
+	// Looking the caller up takes a query, so it is limited per IP address
+	// first.
+	r.Use(limiter.LimitIP("ip", cfg.RateLimitIP))
+	r.Use(handlers.IdentifyCaller)
+	r.Use(limiter.Limit("all", cfg.RateLimit))
+	r.Use(limiter.LimitMethods("write", cfg.RateLimitWrite, http.MethodPost))
+	r.Use(idempotent.Middleware)
+
+	r.Post("/organizations", handlers.CreateOrganization)
+
+	r.Group(func(r chi.Router) {
+		r.Use(handlers.RequireOrg)
+
+		r.Get("/organization", handlers.GetOrganization)
+		r.Put("/organization", handlers.UpdateOrganization)
+
+		r.Get("/users", handlers.GetAllUsers)
+		r.Post("/users", handlers.CreateUser)
+		r.Get("/users/{id}", handlers.GetUserByID)
+		r.Put("/users/{id}", handlers.UpdateUser)
+		r.Patch("/users/{id}", handlers.PatchUser)
+		r.Delete("/users/{id}", handlers.DeleteUser)
+		r.Post("/users/{id}/restore", handlers.RestoreUser)
+		r.Put("/users/{id}/org-role", handlers.SetOrgRole)
+		r.Get("/users/{id}/tasks", handlers.GetTasksByUserID)
+		r.Get("/users/{id}/notification-preferences", handlers.GetNotificationPreferences)
+		r.Put("/users/{id}/notification-preferences", handlers.UpdateNotificationPreferences)
+		r.With(search).Get("/users/search", handlers.FindUsers)
+
+		r.Get("/tasks", handlers.GetTasks)
+		r.Post("/tasks", handlers.CreateTask)
+		r.Get("/tasks/{id}", handlers.GetTaskByID)
+		r.Put("/tasks/{id}", handlers.UpdateTask)
+		r.Patch("/tasks/{id}", handlers.PatchTask)
+		r.Delete("/tasks/{id}", handlers.DeleteTask)
+		r.Post("/tasks/{id}/restore", handlers.RestoreTask)
+		r.Get("/tasks/{id}/comments", handlers.GetTaskComments)
+		r.Post("/tasks/{id}/comments", handlers.CreateTaskComment)
+		r.With(search).Get("/tasks/search", handlers.SearchTasksHandler)
+		r.Post("/tasks/bulk", handlers.BulkTasks)
+
+		r.Get("/projects", handlers.GetProjects)
+		r.Post("/projects", handlers.CreateProject)
+		r.Get("/projects/{id}", handlers.GetProjectByID)
+		r.Put("/projects/{id}", handlers.UpdateProject)
+		r.Patch("/projects/{id}", handlers.PatchProject)
+		r.Delete("/projects/{id}", handlers.DeleteProject)
+		r.Post("/projects/{id}/restore", handlers.RestoreProject)
+		r.Get("/projects/{id}/tasks", handlers.GetTasksByProjectID)
+		r.Get("/projects/{id}/members", handlers.GetProjectMembers)
+		r.Put("/projects/{id}/members/{userId}", handlers.SetProjectMember)
+		r.Delete("/projects/{id}/members/{userId}", handlers.RemoveProjectMember)
+		r.With(search).Get("/projects/search/title", handlers.SearchProjectsByTitle)
+		r.With(search).Get("/projects/search/manager", handlers.SearchProjectsByManager)
+
+		r.Get("/recurring-tasks", handlers.GetRecurringTasks)
+		r.Post("/recurring-tasks", handlers.CreateRecurringTask)
+		r.Get("/recurring-tasks/{id}", handlers.GetRecurringTaskByID)
+		r.Delete("/recurring-tasks/{id}", handlers.DeleteRecurringTask)
+		r.Get("/recurring-tasks/{id}/occurrences", handlers.GetOccurrences)
+		r.Put("/recurring-tasks/{id}/occurrences/{occurrence}", handlers.UpdateOccurrence)
+		r.Delete("/recurring-tasks/{id}/occurrences/{occurrence}", handlers.SkipOccurrence)
+
+		r.Get("/filters", handlers.GetFilters)
+		r.Post("/filters", handlers.CreateFilter)
+		r.Get("/filters/counts", handlers.GetFilterCounts)
+		r.Get("/filters/{id}", handlers.GetFilterByID)
+		r.Delete("/filters/{id}", handlers.DeleteFilter)
+		r.Get("/filters/{id}/tasks", handlers.GetFilterTasks)
+
+		r.Get("/notifications", handlers.GetNotifications)
+		r.Post("/notifications/{id}/read", handlers.MarkNotificationRead)
+
+		r.With(search).Get("/search", handlers.Search)
+		r.Get("/trash", handlers.GetTrash)
+	})
+
+	r.Method(http.MethodGet, "/metrics", m.Handler(cfg.MetricsToken))
+
+	docs.SwaggerInfo.BasePath = "/"
+	r.Get("/swagger/*", httpSwagger.WrapHandler)
+
+	return r
+}
+
+// newRoot returns the server's handler: the health probes, which are answered
+// before the API's middleware so that they are neither rate limited nor
+// logged, and the API.
+func newRoot(api http.Handler, checker *health.Checker, healthToken string) http.Handler {
+	root := http.NewServeMux()
+	root.HandleFunc("GET /healthz", checker.Live)
+	root.HandleFunc("GET /readyz", checker.Ready)
+	root.Handle("GET /health", checker.Handler(healthToken))
+	root.Handle("/", api)
+	return root
+}
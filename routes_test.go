@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/allwsaa/project-api/internal/models"
+	"github.com/allwsaa/project-api/internal/repositories"
+)
+
+// The IDs of the resources seed creates. A fresh database hands out IDs from
+// 1, so they are the same in every test, which lets the table below name
+// them in its paths.
+const (
+	adminID        = 1 // admin of the organization the requests are made in
+	memberID       = 2 // contributor to the project
+	otherAdminID   = 3 // admin of another organization
+	maintainerID   = 4 // maintainer of the project
+	viewerID       = 5 // viewer of the project
+	outsiderID     = 6 // member of the organization but not of the project
+	projectID      = 1
+	otherProjectID = 2
+	taskID         = 1
+	trashedTaskID  = 2
+	otherTaskID    = 3
+	recurringID    = 1
+	filterID       = 1
+	notificationID = 1
+)
+
+// seed fills the API's database with a project, its tasks and everything
+// that hangs off them, plus a second organization whose data must stay out
+// of reach and users in each role of the project.
+func seed(t *testing.T, api *testAPI) {
+	t.Helper()
+	_, admin := api.createOrg("acme")
+	member := api.createUser(admin, "bob")
+	project := api.createProject(admin, admin, "Launch")
+	api.addMember(admin, project, member, models.RoleContributor)
+	task := api.createTask(admin, project, member, "Write release notes")
+	trashed := api.createTask(admin, project, member, "Old task")
+	api.mustDo(http.StatusNoContent, http.MethodDelete, "/tasks/2", admin, nil)
+
+	recurring := api.created("/recurring-tasks", admin, map[string]any{
+		"title": "Stand-up", "priority": "low", "respId": member, "projectId": project,
+		"rrule": "FREQ=DAILY", "timeZone": "UTC", "startsAt": "2030-01-01T09:00:00Z",
+	})
+	filter := api.created("/filters", admin, map[string]any{
+		"name": "Urgent", "projectId": project, "criteria": map[string]any{"priority": "high"},
+	})
+
+	notifications := repositories.NotificationRepo{DB: api.DB}
+	if _, err := notifications.CreateNotification(context.Background(), models.Notification{
+		UserID: member, TaskID: task, Kind: "reminder", Threshold: "24h",
+		DueAt: time.Now().Add(24 * time.Hour), Message: "Write release notes is due soon",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherAdmin := api.createOrg("globex")
+	otherProject := api.createProject(otherAdmin, otherAdmin, "Secret")
+	otherTask := api.createTask(otherAdmin, otherProject, otherAdmin, "Secret task")
+
+	maintainer := api.createUser(admin, "mia")
+	api.addMember(admin, project, maintainer, models.RoleMaintainer)
+	viewer := api.createUser(admin, "vic")
+	api.addMember(admin, project, viewer, models.RoleViewer)
+	outsider := api.createUser(admin, "oscar")
+
+	got := []int{admin, member, otherAdmin, maintainer, viewer, outsider, project, otherProject, task, trashed, otherTask, recurring, filter}
+	want := []int{adminID, memberID, otherAdminID, maintainerID, viewerID, outsiderID, projectID, otherProjectID, taskID, trashedTaskID, otherTaskID, recurringID, filterID}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("seeded IDs = %v, want %v", got, want)
+		}
+	}
+}
+
+var (
+	validTask = map[string]any{
+		"title": "Book a venue", "priority": "medium", "status": "new",
+		"respId": memberID, "projectId": projectID, "completionDate": "2030-01-01T00:00:00Z",
+	}
+	validProject = map[string]any{
+		"projectTitle": "Relaunch", "managerId": adminID, "completed": "2030-01-01T00:00:00Z",
+	}
+	validUser = map[string]any{"name": "Carol", "email": "carol@example.com", "role": "developer"}
+)
+
+func with(base map[string]any, key string, value any) map[string]any {
+	m := make(map[string]any, len(base)+1)
+	for k, v := range base {
+		m[k] = v
+	}
+	m[key] = value
+	return m
+}
+
+// TestRoutes sends one request per case to a freshly seeded API and checks
+// the status of the response. Every route in newRouter has a case for
+// success and for the ways it commonly fails.
+func TestRoutes(t *testing.T) {
+	const merge = "application/merge-patch+json"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		user   int // 0 for an anonymous request
+		body   any
+		header []string
+		want   int
+	}{
+		// Probes, metrics and documentation.
+		{"liveness", "GET", "/healthz", 0, nil, nil, 200},
+		{"readiness", "GET", "/readyz", 0, nil, nil, 200},
+		{"health report", "GET", "/health", 0, nil, nil, 200},
+		{"metrics", "GET", "/metrics", 0, nil, nil, 200},
+		{"swagger", "GET", "/swagger/index.html", 0, nil, nil, 200},
+		{"unknown route", "GET", "/nope", adminID, nil, nil, 404},
+
+		// Callers.
+		{"anonymous", "GET", "/tasks", 0, nil, nil, 401},
+		{"unknown caller", "GET", "/tasks", 999, nil, nil, 401},
+		{"malformed caller", "GET", "/tasks", 0, nil, []string{"X-User-ID", "abc"}, 400},
+
+		// Organizations.
+		{"create organization", "POST", "/organizations", 0, map[string]any{"name": "Initech", "admin": validUser}, nil, 201},
+		{"create organization without name", "POST", "/organizations", 0, map[string]any{"admin": validUser}, nil, 400},
+		{"create organization malformed", "POST", "/organizations", 0, "{", nil, 400},
+		{"create organization with another organization's email", "POST", "/organizations", 0, map[string]any{"name": "Initech", "admin": with(validUser, "email", "bob@example.com")}, nil, 201},
+		{"get organization", "GET", "/organization", memberID, nil, nil, 200},
+		{"rename organization", "PUT", "/organization", adminID, map[string]any{"name": "Acme Inc"}, nil, 200},
+		{"rename organization as member", "PUT", "/organization", memberID, map[string]any{"name": "Acme Inc"}, nil, 403},
+		{"rename organization without name", "PUT", "/organization", adminID, map[string]any{}, nil, 400},
+
+		// Users.
+		{"list users", "GET", "/users", memberID, nil, nil, 200},
+		{"list a page of users", "GET", "/users?limit=1&after=1", memberID, nil, nil, 200},
+		{"list users with invalid limit", "GET", "/users?limit=0", memberID, nil, nil, 400},
+		{"create user", "POST", "/users", adminID, validUser, nil, 201},
+		{"create user as member", "POST", "/users", memberID, validUser, nil, 403},
+		{"create user with a taken email", "POST", "/users", adminID, with(validUser, "email", "bob@example.com"), nil, 409},
+		{"get user", "GET", "/users/2", adminID, nil, nil, 200},
+		{"get user with invalid ID", "GET", "/users/abc", adminID, nil, nil, 400},
+		{"get missing user", "GET", "/users/999", adminID, nil, nil, 404},
+		{"get user of other organization", "GET", "/users/3", adminID, nil, nil, 404},
+		{"update user", "PUT", "/users/2", adminID, with(validUser, "name", "Robert"), nil, 204},
+		{"update user with stale version", "PUT", "/users/2", adminID, validUser, []string{"If-Match", `"99"`}, 412},
+		{"update missing user", "PUT", "/users/999", adminID, validUser, nil, 404},
+		{"patch user", "PATCH", "/users/2", adminID, `{"name":"Robert"}`, []string{"Content-Type", merge}, 200},
+		{"patch user with unsupported type", "PATCH", "/users/2", adminID, `name=Robert`, []string{"Content-Type", "text/plain"}, 415},
+		{"patch user invalid", "PATCH", "/users/2", adminID, `{"email":"nope"}`, []string{"Content-Type", merge}, 422},
+		{"patch user to a taken email", "PATCH", "/users/2", adminID, `{"email":"admin@acme.example.com"}`, []string{"Content-Type", merge}, 409},
+		{"delete user", "DELETE", "/users/2", adminID, nil, nil, 204},
+		{"delete user as member", "DELETE", "/users/2", memberID, nil, nil, 403},
+		{"delete last admin", "DELETE", "/users/1", adminID, nil, nil, 409},
+		{"delete missing user", "DELETE", "/users/999", adminID, nil, nil, 404},
+		{"restore user not in trash", "POST", "/users/2/restore", adminID, nil, nil, 404},
+		{"set org role", "PUT", "/users/2/org-role", adminID, map[string]any{"orgRole": "admin"}, nil, 204},
+		{"set invalid org role", "PUT", "/users/2/org-role", adminID, map[string]any{"orgRole": "king"}, nil, 400},
+		{"set org role as member", "PUT", "/users/2/org-role", memberID, map[string]any{"orgRole": "admin"}, nil, 403},
+		{"set org role of missing user", "PUT", "/users/999/org-role", adminID, map[string]any{"orgRole": "admin"}, nil, 404},
+		{"user's tasks", "GET", "/users/2/tasks", adminID, nil, nil, 200},
+		{"user's tasks with invalid ID", "GET", "/users/abc/tasks", adminID, nil, nil, 400},
+		{"get notification preferences", "GET", "/users/2/notification-preferences", memberID, nil, nil, 200},
+		{"get someone else's preferences", "GET", "/users/2/notification-preferences", adminID, nil, nil, 403},
+		{"set notification preferences", "PUT", "/users/2/notification-preferences", memberID, map[string]any{"email": "digest"}, nil, 200},
+		{"set invalid notification preferences", "PUT", "/users/2/notification-preferences", memberID, map[string]any{"email": "hourly"}, nil, 400},
+		{"search users by name", "GET", "/users/search?name=bo", adminID, nil, nil, 200},
+		{"search users by email", "GET", "/users/search?email=bob@example.com", adminID, nil, nil, 200},
+		{"search users without criteria", "GET", "/users/search", adminID, nil, nil, 400},
+
+		// Tasks.
+		{"list tasks", "GET", "/tasks", memberID, nil, nil, 200},
+		{"create task", "POST", "/tasks", adminID, validTask, nil, 201},
+		{"create task malformed", "POST", "/tasks", adminID, "{", nil, 400},
+		{"create task in missing project", "POST", "/tasks", adminID, with(validTask, "projectId", 999), nil, 422},
+		{"create task for user of other organization", "POST", "/tasks", adminID, with(validTask, "respId", otherAdminID), nil, 422},
+		{"get task", "GET", "/tasks/1", memberID, nil, nil, 200},
+		{"get unchanged task", "GET", "/tasks/1", memberID, nil, []string{"If-None-Match", `"1"`}, 304},
+		{"get task with invalid ID", "GET", "/tasks/abc", adminID, nil, nil, 400},
+		{"get missing task", "GET", "/tasks/999", adminID, nil, nil, 404},
+		{"get task in trash", "GET", "/tasks/2", adminID, nil, nil, 404},
+		{"get task of other organization", "GET", "/tasks/3", adminID, nil, nil, 404},
+		{"get task as viewer", "GET", "/tasks/1", viewerID, nil, nil, 200},
+		{"get task as non-member", "GET", "/tasks/1", outsiderID, nil, nil, 404},
+		{"create task as viewer", "POST", "/tasks", viewerID, validTask, nil, 403},
+		{"create task as non-member", "POST", "/tasks", outsiderID, validTask, nil, 422},
+		{"update task", "PUT", "/tasks/1", adminID, with(validTask, "status", "done"), []string{"If-Match", `"1"`}, 200},
+		{"update task with stale version", "PUT", "/tasks/1", adminID, validTask, []string{"If-Match", `"7"`}, 412},
+		{"update missing task", "PUT", "/tasks/999", adminID, validTask, nil, 404},
+		{"update task as contributor", "PUT", "/tasks/1", memberID, with(validTask, "status", "done"), nil, 200},
+		{"update task as viewer", "PUT", "/tasks/1", viewerID, with(validTask, "status", "done"), nil, 403},
+		{"update task as non-member", "PUT", "/tasks/1", outsiderID, with(validTask, "status", "done"), nil, 404},
+		{"patch task", "PATCH", "/tasks/1", memberID, `{"status":"inprogress"}`, []string{"Content-Type", merge}, 200},
+		{"patch task with JSON Patch", "PATCH", "/tasks/1", memberID, `[{"op":"replace","path":"/priority","value":"low"}]`, []string{"Content-Type", "application/json-patch+json"}, 200},
+		{"patch task with failing test", "PATCH", "/tasks/1", memberID, `[{"op":"test","path":"/priority","value":"low"}]`, []string{"Content-Type", "application/json-patch+json"}, 409},
+		{"patch task malformed", "PATCH", "/tasks/1", memberID, `{`, []string{"Content-Type", merge}, 400},
+		{"patch task invalid", "PATCH", "/tasks/1", memberID, `{"status":"later"}`, []string{"Content-Type", merge}, 422},
+		{"patch missing task", "PATCH", "/tasks/999", memberID, `{"status":"done"}`, []string{"Content-Type", merge}, 404},
+		{"patch task as viewer", "PATCH", "/tasks/1", viewerID, `{"status":"done"}`, []string{"Content-Type", merge}, 403},
+		{"patch task as non-member", "PATCH", "/tasks/1", outsiderID, `{"status":"done"}`, []string{"Content-Type", merge}, 404},
+		{"delete task", "DELETE", "/tasks/1", adminID, nil, nil, 204},
+		{"delete task with stale version", "DELETE", "/tasks/1", adminID, nil, []string{"If-Match", `"7"`}, 412},
+		{"delete task with invalid ID", "DELETE", "/tasks/abc", adminID, nil, nil, 400},
+		{"delete missing task", "DELETE", "/tasks/999", adminID, nil, nil, 404},
+		{"delete task as viewer", "DELETE", "/tasks/1", viewerID, nil, nil, 403},
+		{"delete task as non-member", "DELETE", "/tasks/1", outsiderID, nil, nil, 404},
+		{"restore task", "POST", "/tasks/2/restore", adminID, nil, nil, 200},
+		{"restore task not in trash", "POST", "/tasks/1/restore", adminID, nil, nil, 404},
+		{"restore task with invalid ID", "POST", "/tasks/abc/restore", adminID, nil, nil, 400},
+		{"restore task as contributor", "POST", "/tasks/2/restore", memberID, nil, nil, 200},
+		{"restore task as viewer", "POST", "/tasks/2/restore", viewerID, nil, nil, 403},
+		{"restore task as non-member", "POST", "/tasks/2/restore", outsiderID, nil, nil, 404},
+		{"search tasks", "GET", "/tasks/search?status=new&priority=high", memberID, nil, nil, 200},
+		{"search tasks with invalid assignee", "GET", "/tasks/search?respId=abc", memberID, nil, nil, 400},
+		{"search tasks with invalid after", "GET", "/tasks/search?status=new&after=x", memberID, nil, nil, 400},
+		{"bulk update tasks", "POST", "/tasks/bulk", adminID, map[string]any{"operation": "set_status", "status": "done", "ids": []int{taskID}}, nil, 200},
+		{"bulk update with unknown operation", "POST", "/tasks/bulk", adminID, map[string]any{"operation": "explode", "ids": []int{taskID}}, nil, 400},
+		{"bulk move to missing project", "POST", "/tasks/bulk", adminID, map[string]any{"operation": "move", "projectId": 999, "ids": []int{taskID}}, nil, 422},
+		{"bulk move to project as viewer", "POST", "/tasks/bulk", viewerID, map[string]any{"operation": "move", "projectId": projectID, "ids": []int{taskID}}, nil, 403},
+		{"bulk move to project as non-member", "POST", "/tasks/bulk", outsiderID, map[string]any{"operation": "move", "projectId": projectID, "ids": []int{taskID}}, nil, 422},
+
+		// Comments.
+		{"list comments", "GET", "/tasks/1/comments", viewerID, nil, nil, 200},
+		{"list comments as non-member", "GET", "/tasks/1/comments", outsiderID, nil, nil, 404},
+		{"list comments of task in trash", "GET", "/tasks/2/comments", adminID, nil, nil, 404},
+		{"list comments of other organization", "GET", "/tasks/3/comments", adminID, nil, nil, 404},
+		{"comment", "POST", "/tasks/1/comments", memberID, map[string]any{"body": "@mia please review"}, nil, 201},
+		{"comment without body", "POST", "/tasks/1/comments", memberID, map[string]any{}, nil, 422},
+		{"comment malformed", "POST", "/tasks/1/comments", memberID, "{", nil, 400},
+		{"comment with invalid ID", "POST", "/tasks/abc/comments", memberID, map[string]any{"body": "Hi"}, nil, 400},
+		{"comment as viewer", "POST", "/tasks/1/comments", viewerID, map[string]any{"body": "Hi"}, nil, 403},
+		{"comment as non-member", "POST", "/tasks/1/comments", outsiderID, map[string]any{"body": "Hi"}, nil, 404},
+
+		// Projects.
+		{"list projects", "GET", "/projects", memberID, nil, nil, 200},
+		{"list projects with invalid limit", "GET", "/projects?limit=1001", memberID, nil, nil, 400},
+		{"create project", "POST", "/projects", adminID, validProject, nil, 201},
+		{"get project", "GET", "/projects/1", memberID, nil, nil, 200},
+		{"get project with invalid ID", "GET", "/projects/abc", adminID, nil, nil, 400},
+		{"get missing project", "GET", "/projects/999", adminID, nil, nil, 404},
+		{"get project of other organization", "GET", "/projects/2", adminID, nil, nil, 404},
+		{"update project", "PUT", "/projects/1", adminID, validProject, nil, 200},
+		{"update project with stale version", "PUT", "/projects/1", adminID, validProject, []string{"If-Match", `"7"`}, 412},
+		{"update missing project", "PUT", "/projects/999", adminID, validProject, nil, 404},
+		{"update project as maintainer", "PUT", "/projects/1", maintainerID, validProject, nil, 200},
+		{"update project manager as maintainer", "PUT", "/projects/1", maintainerID, with(validProject, "managerId", maintainerID), nil, 403},
+		{"update project as contributor", "PUT", "/projects/1", memberID, validProject, nil, 403},
+		{"update project as viewer", "PUT", "/projects/1", viewerID, validProject, nil, 403},
+		{"update project as non-member", "PUT", "/projects/1", outsiderID, validProject, nil, 404},
+		{"patch project", "PATCH", "/projects/1", adminID, `{"projectDescription":"New plan"}`, []string{"Content-Type", merge}, 200},
+		{"patch missing project", "PATCH", "/projects/999", adminID, `{"projectDescription":"New plan"}`, []string{"Content-Type", merge}, 404},
+		{"patch project as maintainer", "PATCH", "/projects/1", maintainerID, `{"projectDescription":"New plan"}`, []string{"Content-Type", merge}, 200},
+		{"patch project manager as maintainer", "PATCH", "/projects/1", maintainerID, `{"managerId":4}`, []string{"Content-Type", merge}, 403},
+		{"patch project as viewer", "PATCH", "/projects/1", viewerID, `{"projectDescription":"New plan"}`, []string{"Content-Type", merge}, 403},
+		{"patch project as non-member", "PATCH", "/projects/1", outsiderID, `{"projectDescription":"New plan"}`, []string{"Content-Type", merge}, 404},
+		{"delete project", "DELETE", "/projects/1", adminID, nil, nil, 200},
+		{"delete project with invalid ID", "DELETE", "/projects/abc", adminID, nil, nil, 400},
+		{"delete missing project", "DELETE", "/projects/999", adminID, nil, nil, 404},
+		{"delete project as maintainer", "DELETE", "/projects/1", maintainerID, nil, nil, 403},
+		{"delete project as viewer", "DELETE", "/projects/1", viewerID, nil, nil, 403},
+		{"delete project as non-member", "DELETE", "/projects/1", outsiderID, nil, nil, 404},
+		{"restore project not in trash", "POST", "/projects/1/restore", adminID, nil, nil, 404},
+		{"restore project as maintainer", "POST", "/projects/1/restore", maintainerID, nil, nil, 403},
+		{"restore project as non-member", "POST", "/projects/1/restore", outsiderID, nil, nil, 404},
+		{"project's tasks", "GET", "/projects/1/tasks", memberID, nil, nil, 200},
+		{"project's tasks with invalid ID", "GET", "/projects/abc/tasks", memberID, nil, nil, 400},
+		{"list members", "GET", "/projects/1/members", memberID, nil, nil, 200},
+		{"list members of missing project", "GET", "/projects/999/members", adminID, nil, nil, 404},
+		{"set member", "PUT", "/projects/1/members/2", adminID, map[string]any{"role": "viewer"}, nil, 200},
+		{"set member with invalid role", "PUT", "/projects/1/members/2", adminID, map[string]any{"role": "boss"}, nil, 400},
+		{"set member as contributor", "PUT", "/projects/1/members/2", memberID, map[string]any{"role": "owner"}, nil, 403},
+		{"set member of other organization", "PUT", "/projects/1/members/3", adminID, map[string]any{"role": "viewer"}, nil, 422},
+		{"demote last owner", "PUT", "/projects/1/members/1", adminID, map[string]any{"role": "viewer"}, nil, 409},
+		{"remove member", "DELETE", "/projects/1/members/2", adminID, nil, nil, 204},
+		{"remove last owner", "DELETE", "/projects/1/members/1", adminID, nil, nil, 409},
+		{"remove missing member", "DELETE", "/projects/1/members/999", adminID, nil, nil, 404},
+		{"search projects by title", "GET", "/projects/search/title?title=laun", memberID, nil, nil, 200},
+		{"search projects without title", "GET", "/projects/search/title", memberID, nil, nil, 400},
+		{"search projects by manager", "GET", "/projects/search/manager?managerId=1", memberID, nil, nil, 200},
+		{"search projects by invalid manager", "GET", "/projects/search/manager?managerId=abc", memberID, nil, nil, 400},
+
+		// Recurring tasks.
+		{"list recurring tasks", "GET", "/recurring-tasks", memberID, nil, nil, 200},
+		{"create recurring task", "POST", "/recurring-tasks", adminID, map[string]any{"title": "Retro", "priority": "low", "respId": memberID, "projectId": projectID, "rrule": "FREQ=WEEKLY;BYDAY=FR"}, nil, 201},
+		{"create recurring task with invalid rule", "POST", "/recurring-tasks", adminID, map[string]any{"title": "Retro", "priority": "low", "respId": memberID, "projectId": projectID, "rrule": "FREQ=SOMETIMES"}, nil, 400},
+		{"create recurring task in missing project", "POST", "/recurring-tasks", adminID, map[string]any{"title": "Retro", "priority": "low", "respId": memberID, "projectId": 999, "rrule": "FREQ=DAILY"}, nil, 422},
+		{"create recurring task as viewer", "POST", "/recurring-tasks", viewerID, map[string]any{"title": "Retro", "priority": "low", "respId": memberID, "projectId": projectID, "rrule": "FREQ=DAILY"}, nil, 403},
+		{"get recurring task", "GET", "/recurring-tasks/1", memberID, nil, nil, 200},
+		{"get recurring task with invalid ID", "GET", "/recurring-tasks/abc", memberID, nil, nil, 400},
+		{"get missing recurring task", "GET", "/recurring-tasks/999", memberID, nil, nil, 404},
+		{"get recurring task as non-member", "GET", "/recurring-tasks/1", outsiderID, nil, nil, 404},
+		{"delete recurring task", "DELETE", "/recurring-tasks/1", adminID, nil, nil, 204},
+		{"delete missing recurring task", "DELETE", "/recurring-tasks/999", adminID, nil, nil, 404},
+		{"delete recurring task as viewer", "DELETE", "/recurring-tasks/1", viewerID, nil, nil, 403},
+		{"delete recurring task as non-member", "DELETE", "/recurring-tasks/1", outsiderID, nil, nil, 404},
+		{"list occurrences", "GET", "/recurring-tasks/1/occurrences?limit=3", memberID, nil, nil, 200},
+		{"list occurrences with invalid limit", "GET", "/recurring-tasks/1/occurrences?limit=abc", memberID, nil, nil, 400},
+		{"update occurrence", "PUT", "/recurring-tasks/1/occurrences/2030-01-02T09:00:00Z", adminID, map[string]any{"priority": "high"}, nil, 200},
+		{"update occurrence with invalid time", "PUT", "/recurring-tasks/1/occurrences/tomorrow", adminID, map[string]any{}, nil, 400},
+		{"update time that is no occurrence", "PUT", "/recurring-tasks/1/occurrences/2030-01-02T10:00:00Z", adminID, map[string]any{}, nil, 404},
+		{"skip occurrence", "DELETE", "/recurring-tasks/1/occurrences/2030-01-02T09:00:00Z", adminID, nil, nil, 204},
+		{"skip occurrence of missing recurring task", "DELETE", "/recurring-tasks/999/occurrences/2030-01-02T09:00:00Z", adminID, nil, nil, 404},
+		{"skip occurrence as viewer", "DELETE", "/recurring-tasks/1/occurrences/2030-01-02T09:00:00Z", viewerID, nil, nil, 403},
+		{"update occurrence as viewer", "PUT", "/recurring-tasks/1/occurrences/2030-01-02T09:00:00Z", viewerID, map[string]any{"priority": "high"}, nil, 403},
+
+		// Saved filters.
+		{"list filters", "GET", "/filters", memberID, nil, nil, 200},
+		{"create filter", "POST", "/filters", memberID, map[string]any{"name": "Mine", "criteria": map[string]any{"respId": memberID}}, nil, 201},
+		{"create filter with taken name", "POST", "/filters", adminID, map[string]any{"name": "Urgent", "criteria": map[string]any{"status": "new"}}, nil, 409},
+		{"create filter without name", "POST", "/filters", adminID, map[string]any{"criteria": map[string]any{}}, nil, 400},
+		{"create filter in missing project", "POST", "/filters", adminID, map[string]any{"name": "Lost", "projectId": 999, "criteria": map[string]any{"status": "new"}}, nil, 422},
+		{"count filters", "GET", "/filters/counts", memberID, nil, nil, 200},
+		{"get filter", "GET", "/filters/1", memberID, nil, nil, 200},
+		{"get filter with invalid ID", "GET", "/filters/abc", memberID, nil, nil, 400},
+		{"get missing filter", "GET", "/filters/999", memberID, nil, nil, 404},
+		{"filter's tasks", "GET", "/filters/1/tasks", memberID, nil, nil, 200},
+		{"missing filter's tasks", "GET", "/filters/999/tasks", memberID, nil, nil, 404},
+		{"delete filter", "DELETE", "/filters/1", adminID, nil, nil, 204},
+		{"delete someone else's filter", "DELETE", "/filters/1", memberID, nil, nil, 403},
+		{"delete missing filter", "DELETE", "/filters/999", adminID, nil, nil, 404},
+
+		// Notifications.
+		{"list notifications", "GET", "/notifications?unread=true", memberID, nil, nil, 200},
+		{"list notifications with invalid flag", "GET", "/notifications?unread=maybe", memberID, nil, nil, 400},
+		{"mark notification read", "POST", "/notifications/1/read", memberID, nil, nil, 204},
+		{"mark someone else's notification read", "POST", "/notifications/1/read", adminID, nil, nil, 404},
+		{"mark notification with invalid ID read", "POST", "/notifications/abc/read", memberID, nil, nil, 400},
+
+		// Search and trash.
+		{"search", "GET", "/search?q=release", memberID, nil, nil, 200},
+		{"search without query", "GET", "/search", memberID, nil, nil, 400},
+		{"search unknown type", "GET", "/search?q=release&types=invoices", memberID, nil, nil, 400},
+		{"trash", "GET", "/trash", adminID, nil, nil, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			seed(t, api)
+			res := api.do(tt.method, tt.path, tt.user, tt.body, tt.header...)
+			if res.StatusCode != tt.want {
+				t.Fatalf("%s %s: status %d, want %d: %s", tt.method, tt.path, res.StatusCode, tt.want, res.Body)
+			}
+			if tt.want >= 400 {
+				res.problem(t, tt.want)
+			}
+		})
+	}
+}
+
+// TestProblemDetails checks what error responses tell the client: where and
+// why the request failed, but nothing about the server's internals.
+func TestProblemDetails(t *testing.T) {
+	api := newTestAPI(t)
+	seed(t, api)
+
+	res := api.mustDo(http.StatusNotFound, "GET", "/tasks/999", adminID, nil, "X-Request-ID", "problem-test")
+	details := res.problem(t, http.StatusNotFound)
+	if details.Type != "about:blank" || details.Instance != "/tasks/999" || details.RequestID != "problem-test" {
+		t.Errorf("problem %+v, want the path and the request ID", details)
+	}
+
+	api.mustDo(http.StatusNotFound, "GET", "/no-such-endpoint", adminID, nil).problem(t, http.StatusNotFound)
+	api.mustDo(http.StatusMethodNotAllowed, "PATCH", "/tasks", adminID, nil).problem(t, http.StatusMethodNotAllowed)
+
+	// With the database gone every query fails, and the errors must only
+	// reach the logs.
+	api.DB.Close()
+	res = api.mustDo(http.StatusInternalServerError, "GET", "/tasks", adminID, nil)
+	details = res.problem(t, http.StatusInternalServerError)
+	if details.Detail != "Internal server error" || details.RequestID == "" {
+		t.Errorf("problem %+v, want a generic detail and a request ID", details)
+	}
+	if bytes.Contains(bytes.ToLower(res.Body), []byte("sql")) {
+		t.Errorf("500 reveals the database error: %s", res.Body)
+	}
+}